@@ -0,0 +1,235 @@
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ตารางที่ไม่ต้องเก็บ audit (เป็น log อยู่แล้ว หรือเป็นข้อมูล session)
+var auditSkipTables = map[string]bool{
+	"audit_logs":            true,
+	"operations":            true,
+	"refresh_tokens":        true,
+	"revoked_tokens":        true,
+	"job_runs":              true,
+	"notifications":         true,
+	"email_outboxes":        true,
+	"password_reset_tokens": true,
+	"login_attempts":        true,
+	"login_challenges":      true,
+	"recovery_codes":        true,
+	"parcel_lot_movements":  true,
+}
+
+const auditBeforeKey = "audit:before"
+
+// registerAuditCallbacks ผูก callback ให้ทุก create/update/delete ผ่าน GORM ถูกบันทึกลง audit_logs
+// (และส่ง ChangeEvent ให้ผู้ที่เปิด GET /api/events อยู่ ดู events.go)
+// ผู้กระทำอ่านจาก "mid" ใน context ของ statement (controller ส่ง gin.Context ผ่าน WithContext)
+func registerAuditCallbacks(db *gorm.DB) {
+	db.Callback().Create().After("gorm:create").Register("audit:after_create", auditAfterCreate)
+	db.Callback().Update().Before("gorm:update").Register("audit:before_update", auditSnapshot)
+	db.Callback().Update().After("gorm:update").Register("audit:after_update", auditAfterUpdate)
+	db.Callback().Delete().Before("gorm:delete").Register("audit:before_delete", auditSnapshot)
+	db.Callback().Delete().After("gorm:delete").Register("audit:after_delete", auditAfterDelete)
+}
+
+func auditEnabled(db *gorm.DB) bool {
+	return db.Error == nil && db.Statement.Schema != nil && !auditSkipTables[db.Statement.Table]
+}
+
+func auditActor(db *gorm.DB) *int {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		return nil
+	}
+	switch v := ctx.Value("mid").(type) {
+	case int:
+		return &v
+	case float64:
+		i := int(v)
+		return &i
+	}
+	return nil
+}
+
+// auditRow แปลง struct เป็น map[ชื่อฟิลด์]ค่า เฉพาะคอลัมน์จริง (ไม่รวม association และฟิลด์ json:"-")
+func auditRow(db *gorm.DB, rv reflect.Value) map[string]any {
+	row := map[string]any{}
+	for _, f := range db.Statement.Schema.Fields {
+		if f.DBName == "" || f.Tag.Get("json") == "-" {
+			continue
+		}
+		v, _ := f.ValueOf(db.Statement.Context, rv)
+		row[f.Name] = v
+	}
+	return row
+}
+
+func auditPrimaryKey(db *gorm.DB, rv reflect.Value) string {
+	parts := make([]string, 0, len(db.Statement.Schema.PrimaryFields))
+	for _, f := range db.Statement.Schema.PrimaryFields {
+		v, _ := f.ValueOf(db.Statement.Context, rv)
+		parts = append(parts, fmt.Sprint(v))
+	}
+	return strings.Join(parts, ",")
+}
+
+// auditDiff คืนเฉพาะฟิลด์ที่ค่าเปลี่ยน (before หรือ after เป็น nil ได้)
+func auditDiff(before, after map[string]any) map[string]map[string]any {
+	diff := map[string]map[string]any{}
+	keys := map[string]bool{}
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+	for k := range keys {
+		b, _ := json.Marshal(before[k])
+		a, _ := json.Marshal(after[k])
+		if string(a) == string(b) {
+			continue
+		}
+		diff[k] = map[string]any{"before": before[k], "after": after[k]}
+	}
+	return diff
+}
+
+func writeAudit(db *gorm.DB, action, recordID string, diff map[string]map[string]any) {
+	if len(diff) == 0 {
+		return
+	}
+	changes, _ := json.Marshal(diff)
+	// ใช้ connection เดียวกับ statement เพื่อให้อยู่ใน transaction เดียวกัน
+	db.Session(&gorm.Session{NewDB: true}).Create(&entity.AuditLog{
+		Action:   action,
+		Entity:   db.Statement.Table,
+		RecordID: recordID,
+		Changes:  changes,
+		ActorMID: auditActor(db),
+	})
+}
+
+// eachRow เรียก fn กับทุกแถวใน ReflectValue (struct เดี่ยวหรือ slice)
+func eachRow(rv reflect.Value, fn func(reflect.Value)) {
+	for rv.Kind() == reflect.Ptr {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			eachRow(rv.Index(i), fn)
+		}
+	case reflect.Struct:
+		fn(rv)
+	}
+}
+
+func auditAfterCreate(db *gorm.DB) {
+	if !auditEnabled(db) || db.RowsAffected == 0 {
+		return
+	}
+	eachRow(db.Statement.ReflectValue, func(rv reflect.Value) {
+		pk := auditPrimaryKey(db, rv)
+		writeAudit(db, "create", pk, auditDiff(nil, auditRow(db, rv)))
+		emitChange(db, "create", pk, rv)
+	})
+}
+
+// auditSnapshot โหลดแถวที่จะถูกแก้/ลบ ก่อนคำสั่งจริงทำงาน
+func auditSnapshot(db *gorm.DB) {
+	if !auditEnabled(db) {
+		return
+	}
+	stmt := db.Statement
+	var exprs []clause.Expression
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			exprs = append(exprs, where.Exprs...)
+		}
+	}
+	// เงื่อนไข primary key ที่ GORM จะเติมเองจาก struct ที่ส่งเข้ามา
+	for _, v := range []reflect.Value{stmt.ReflectValue, reflect.ValueOf(stmt.Model)} {
+		if !v.IsValid() {
+			continue
+		}
+		_, values := schema.GetIdentityFieldValuesMap(stmt.Context, v, stmt.Schema.PrimaryFields)
+		column, queryValues := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, values)
+		if len(queryValues) > 0 {
+			exprs = append(exprs, clause.IN{Column: column, Values: queryValues})
+		}
+	}
+	if len(exprs) == 0 {
+		return // ไม่มีเงื่อนไข -> GORM จะปฏิเสธ global update/delete อยู่แล้ว
+	}
+
+	rows := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+	if err := db.Session(&gorm.Session{NewDB: true}).
+		Model(reflect.New(stmt.Schema.ModelType).Interface()).
+		Clauses(clause.Where{Exprs: exprs}).
+		Find(rows.Interface()).Error; err != nil {
+		return
+	}
+	db.InstanceSet(auditBeforeKey, rows.Elem())
+}
+
+func auditBefore(db *gorm.DB) (reflect.Value, bool) {
+	v, ok := db.InstanceGet(auditBeforeKey)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	rows, ok := v.(reflect.Value)
+	return rows, ok && rows.Len() > 0
+}
+
+func auditAfterUpdate(db *gorm.DB) {
+	if !auditEnabled(db) || db.RowsAffected == 0 {
+		return
+	}
+	before, ok := auditBefore(db)
+	if !ok {
+		return
+	}
+	stmt := db.Statement
+	for i := 0; i < before.Len(); i++ {
+		old := before.Index(i)
+		current := reflect.New(stmt.Schema.ModelType)
+		pk := map[string]any{}
+		for _, f := range stmt.Schema.PrimaryFields {
+			v, _ := f.ValueOf(stmt.Context, old)
+			pk[f.DBName] = v
+		}
+		if err := db.Session(&gorm.Session{NewDB: true}).Unscoped().
+			Model(current.Interface()).Where(pk).Take(current.Interface()).Error; err != nil {
+			continue
+		}
+		diff := auditDiff(auditRow(db, old), auditRow(db, current.Elem()))
+		writeAudit(db, "update", auditPrimaryKey(db, old), diff)
+		if len(diff) > 0 {
+			emitChange(db, "update", auditPrimaryKey(db, old), current.Elem())
+		}
+	}
+}
+
+func auditAfterDelete(db *gorm.DB) {
+	if !auditEnabled(db) || db.RowsAffected == 0 {
+		return
+	}
+	before, ok := auditBefore(db)
+	if !ok {
+		return
+	}
+	for i := 0; i < before.Len(); i++ {
+		old := before.Index(i)
+		writeAudit(db, "delete", auditPrimaryKey(db, old), auditDiff(auditRow(db, old), nil))
+		emitChange(db, "delete", auditPrimaryKey(db, old), old)
+	}
+}
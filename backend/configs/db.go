@@ -20,9 +20,25 @@ func ConnectionDB() {
 	if err != nil {
 		panic("Failed to connect to database!")
 	}
+	registerAuditCallbacks(database)
 	db = database
 }
 func SetupDatabase() {
+	// ฐานข้อมูลที่สร้างก่อนมี TOTP: ต้องเปิดบังคับ TOTP ให้แอดมิน/ผู้คุมหนึ่งครั้งหลัง migrate (ดูด้านล่าง)
+	totpColumnAdded := !db.Migrator().HasColumn(&entity.Rank{}, "RequireTOTP")
+	// ฐานข้อมูลที่สร้างก่อนมีการเช็คอิน: การเยี่ยมที่อนุมัติแล้วในอดีตไม่เคยมีใครเช็คอินได้ ไม่ใช่ผู้เยี่ยมไม่มา
+	// ฐานข้อมูลที่สร้างก่อนมีรายชื่อผู้มีสิทธิ์เยี่ยม: ต้องให้ผู้เยี่ยมเดิมยังจองได้ (ดูด้านล่าง)
+	approvedVisitorsAdded := !db.Migrator().HasTable(&entity.ApprovedVisitor{})
+	checkInColumnAdded := db.Migrator().HasTable(&entity.Visitation{}) && !db.Migrator().HasColumn(&entity.Visitation{}, "CheckIn_At")
+
+	// ชื่อห้องเยี่ยมเดิมเป็น UNIQUE ทั้งตาราง (นับแถวที่ลบแล้วด้วย ทำให้ใช้ชื่อเดิมซ้ำไม่ได้)
+	// ลบ constraint เก่าออกก่อน AutoMigrate สร้าง unique index เฉพาะแถวที่ยังไม่ลบ (ดู entity.VisitingArea)
+	if db.Migrator().HasConstraint(&entity.VisitingArea{}, "uni_visiting_areas_area_name") {
+		if err := db.Migrator().DropConstraint(&entity.VisitingArea{}, "uni_visiting_areas_area_name"); err != nil {
+			panic("failed to drop old visiting area name constraint: " + err.Error())
+		}
+	}
+
 	db.AutoMigrate(
 		&entity.Rank{},
 		&entity.Staff{},
@@ -40,6 +56,12 @@ func SetupDatabase() {
 		&entity.Type{},
 		&entity.Status{},
 		&entity.Requesting{},
+		&entity.RequestingLine{},
+		&entity.Supplier{},
+		&entity.PurchaseOrder{},
+		&entity.PurchaseOrderLine{},
+		&entity.GoodsReceipt{},
+		&entity.GoodsReceiptLine{},
 		&entity.Visitor{},
 		&entity.Status{},
 		&entity.Relationship{},
@@ -50,6 +72,32 @@ func SetupDatabase() {
 		&entity.Activity{},
 		&entity.ActivitySchedule{},
 		&entity.Enrollment{},
+		&entity.RefreshToken{},
+		&entity.RevokedToken{},
+		&entity.AuditLog{},
+		&entity.RoomAssignment{},
+		&entity.JobRun{},
+		&entity.AppointmentReminder{},
+		&entity.Release{},
+		&entity.SentenceCharge{},
+		&entity.RemissionPolicy{},
+		&entity.RemissionRate{},
+		&entity.ApprovedVisitor{},
+		&entity.VisitingArea{},
+		&entity.TimeSlotCapacity{},
+		&entity.VisitationRuleSet{},
+		&entity.VisitBlackout{},
+		&entity.VisitSuspension{},
+		&entity.VisitDepositedItem{},
+		&entity.Lockdown{},
+		&entity.Notification{},
+		&entity.EmailOutbox{},
+		&entity.PasswordResetToken{},
+		&entity.LoginAttempt{},
+		&entity.LoginChallenge{},
+		&entity.RecoveryCode{},
+		&entity.ParcelLot{},
+		&entity.ParcelLotMovement{},
 	)
 
 	db.FirstOrCreate(&entity.Gender{Gender_ID: 1}, entity.Gender{Gender_ID: 1, Gender: "ชาย"})
@@ -59,15 +107,41 @@ func SetupDatabase() {
 	db.FirstOrCreate(&entity.Type{Type_ID: 2, Type: "อุปกรณ์"})
 	db.FirstOrCreate(&entity.Type{Type_ID: 3, Type: "ยา"})
 
-	db.FirstOrCreate(&entity.Rank{RankID: 1}, entity.Rank{RankID: 1, RankName: "แอดมิน"})
-	db.FirstOrCreate(&entity.Rank{RankID: 2}, entity.Rank{RankID: 2, RankName: "ผู้คุม"})
+	// แอดมิน/ผู้คุมต้องใช้ TOTP (แก้ได้ที่ PUT /api/ranks/:id/totp)
+	db.FirstOrCreate(&entity.Rank{RankID: 1}, entity.Rank{RankID: 1, RankName: "แอดมิน", RequireTOTP: true})
+	db.FirstOrCreate(&entity.Rank{RankID: 2}, entity.Rank{RankID: 2, RankName: "ผู้คุม", RequireTOTP: true})
 	db.FirstOrCreate(&entity.Rank{RankID: 3}, entity.Rank{RankID: 3, RankName: "ญาติ"})
+	// FirstOrCreate ไม่แก้แถวที่มีอยู่แล้ว: ตั้งค่าให้ฐานข้อมูลเดิมครั้งเดียวตอนเพิ่มคอลัมน์
+	// (หลังจากนั้นแอดมินปิด/เปิดเองได้โดยไม่ถูกเขียนทับตอน restart)
+	if totpColumnAdded {
+		db.Model(&entity.Rank{}).Where("rank_id IN ?", []int{1, 2}).Update("require_totp", true)
+	}
+	// ครั้งเดียวตอนสร้างตาราง: ผู้เยี่ยมที่เคยจองเยี่ยมผู้ต้องขังคนใดไว้ได้รับอนุมัติ (2) ให้เยี่ยมคนนั้นต่อ
+	// (ไม่ทำทุกครั้งที่ start ไม่งั้นชื่อที่เจ้าหน้าที่ถอนออกจะกลับมาเอง)
+	if approvedVisitorsAdded {
+		db.Exec(`
+			INSERT INTO approved_visitors (prisoner_id, visitor_id, relationship_id, status_id, note, approved_at, created_at, updated_at)
+			SELECT inmate_id, visitor_id, MAX(relationship_id), 2, 'ย้อนหลัง: เคยจองเยี่ยมก่อนมีรายชื่อผู้มีสิทธิ์เยี่ยม',
+				CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+			FROM visitations
+			WHERE inmate_id IS NOT NULL AND visitor_id IS NOT NULL AND deleted_at IS NULL
+			GROUP BY inmate_id, visitor_id
+		`)
+	}
+	// ปิดการเยี่ยมที่อนุมัติแล้ว (2) และเลยวันเยี่ยมไปแล้วเป็น สำเร็จ (4) ครั้งเดียว
+	// กัน job mark-visitation-no-shows นับย้อนหลังทั้งหมดเป็นไม่มาตามนัดแล้วระงับสิทธิ์ผู้เยี่ยม
+	if checkInColumnAdded {
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		db.Model(&entity.Visitation{}).Where("status_id = ? AND visit_date < ?", 2, today).Update("status_id", 4)
+	}
 
 	db.FirstOrCreate(&entity.Operator{OperatorID: 1, OperatorName: "เพิ่ม"})
 	db.FirstOrCreate(&entity.Operator{OperatorID: 2, OperatorName: "เบิก"})
 	db.FirstOrCreate(&entity.Operator{OperatorID: 3, OperatorName: "แก้ไข"})
 	db.FirstOrCreate(&entity.Operator{OperatorID: 4, OperatorName: "เพิ่มใหม่"})
 	db.FirstOrCreate(&entity.Operator{OperatorID: 5, OperatorName: "ลบ"})
+	db.FirstOrCreate(&entity.Operator{OperatorID: 6, OperatorName: "รับเข้าตามใบสั่งซื้อ"})
 
 	password := "123456"
 	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -93,12 +167,26 @@ func SetupDatabase() {
 	db.FirstOrCreate(&entity.Status{Status_ID: 2, Status: "อนุมัติ"})
 	db.FirstOrCreate(&entity.Status{Status_ID: 3, Status: "ไม่อนุมัติ"})
 	db.FirstOrCreate(&entity.Status{Status_ID: 4, Status: "สำเร็จ"})
+	db.FirstOrCreate(&entity.Status{Status_ID: 5, Status: "หมดอายุ"})
+	db.FirstOrCreate(&entity.Status{Status_ID: 6, Status: "ยกเลิก"})
+	db.FirstOrCreate(&entity.Status{Status_ID: 7, Status: "ไม่มาตามนัด"})
 	// Seed BehaviorCriterion
 	db.FirstOrCreate(&entity.BehaviorCriterion{BID: 1, Criterion: "ดีมาก"})
 	db.FirstOrCreate(&entity.BehaviorCriterion{BID: 2, Criterion: "ดี"})
 	db.FirstOrCreate(&entity.BehaviorCriterion{BID: 3, Criterion: "ปานกลาง"})
 	db.FirstOrCreate(&entity.BehaviorCriterion{BID: 4, Criterion: "ต้องปรับปรุง"})
 
+	// นโยบายลดวันต้องโทษเริ่มต้น (แก้ได้ที่ PUT /api/sentence-policy)
+	db.FirstOrCreate(&entity.RemissionPolicy{ID: 1}, entity.RemissionPolicy{ID: 1, Enabled: true, MaxPercent: 33})
+	db.FirstOrCreate(&entity.RemissionRate{PolicyID: 1, BID: 1}, entity.RemissionRate{PolicyID: 1, BID: 1, DaysPerEvaluation: 5})
+	db.FirstOrCreate(&entity.RemissionRate{PolicyID: 1, BID: 2}, entity.RemissionRate{PolicyID: 1, BID: 2, DaysPerEvaluation: 3})
+	db.FirstOrCreate(&entity.RemissionRate{PolicyID: 1, BID: 3}, entity.RemissionRate{PolicyID: 1, BID: 3, DaysPerEvaluation: 0})
+	db.FirstOrCreate(&entity.RemissionRate{PolicyID: 1, BID: 4}, entity.RemissionRate{PolicyID: 1, BID: 4, DaysPerEvaluation: 0})
+
+	// กฎการเยี่ยมเริ่มต้น (แก้ได้ที่ PUT /api/visitation-rules)
+	db.FirstOrCreate(&entity.VisitationRuleSet{ID: 1}, entity.VisitationRuleSet{ID: 1, Enabled: true, MaxVisitsPerWeek: 2, MaxVisitorsPerVisit: 3, IsolationDays: 14,
+		NoShowLimit: 3, NoShowWindowDays: 90, NoShowRestrictDays: 30})
+
 	relationships := []entity.Relationship{
 		{Relationship_name: "พ่อ"},
 		{Relationship_name: "แม่"},
@@ -135,4 +223,48 @@ func SetupDatabase() {
 		db.Where(entity.TimeSlot{TimeSlot_Name: ts.TimeSlot_Name}).FirstOrCreate(&ts)
 	}
 
+	// ห้องเยี่ยมเริ่มต้น (สร้างเฉพาะตอนยังไม่มีห้องเยี่ยมเลย)
+	var areaCount int64
+	db.Model(&entity.VisitingArea{}).Count(&areaCount)
+	if areaCount == 0 {
+		db.Create(&entity.VisitingArea{Area_Name: "ห้องเยี่ยมญาติ 1", Booths: 5, Is_Active: true})
+	}
+
+	// อีเมลที่ส่งไปแล้วก่อนมีการล้างเนื้อหา (อาจมีรหัสรีเซ็ตรหัสผ่าน) -> ล้างทิ้ง
+	db.Model(&entity.EmailOutbox{}).Where("status = ? AND body <> ''", entity.EmailSent).Update("body", "")
+
+	// คำขอเบิกแบบเดิม (1 คำขอ 1 พัสดุ) -> สร้างรายการจาก PID/Amount_Request (สถานะ 2 = อนุมัติ, 4 = สำเร็จ)
+	var singles []entity.Requesting
+	db.Where("requesting_id NOT IN (?)", db.Model(&entity.RequestingLine{}).Select("requesting_id")).Find(&singles)
+	for _, r := range singles {
+		if r.PID == nil {
+			continue
+		}
+		line := entity.RequestingLine{Requesting_ID: r.Requesting_ID, PID: *r.PID, Quantity_Requested: r.Amount_Request}
+		if r.Status_ID != nil && (*r.Status_ID == 2 || *r.Status_ID == 4) {
+			line.Quantity_Approved = r.Amount_Request
+		}
+		if r.Status_ID != nil && *r.Status_ID == 4 {
+			line.Quantity_Issued = r.Amount_Request
+		}
+		db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&line).Error; err != nil {
+				return err
+			}
+			// อนุมัติแล้วแต่ยังไม่จ่าย: ต้องจองของไว้ให้ เพราะตอนจ่าย/ปฏิเสธ/ลบจะปลดการจองตามจำนวนที่อนุมัติ
+			if r.Status_ID != nil && *r.Status_ID == 2 {
+				return tx.Model(&entity.Parcel{}).Where("p_id = ?", line.PID).
+					Update("reserved", gorm.Expr("reserved + ?", line.Quantity_Approved)).Error
+			}
+			return nil
+		})
+	}
+
+	// พัสดุที่มีจำนวนอยู่ก่อนมีระบบล็อต -> ยกยอดเป็นล็อตเปิด (ไม่มีวันหมดอายุ) ให้ Quantity ตรงกับผลรวมล็อต
+	var unlotted []entity.Parcel
+	db.Where("quantity > 0 AND p_id NOT IN (?)", db.Model(&entity.ParcelLot{}).Select("p_id")).Find(&unlotted)
+	for _, p := range unlotted {
+		db.Create(&entity.ParcelLot{PID: p.PID, LotNo: "OPENING", Quantity: p.Quantity, Remaining: p.Quantity, ReceivedAt: time.Now()})
+	}
+
 }
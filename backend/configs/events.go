@@ -0,0 +1,89 @@
+package configs
+
+import (
+	"reflect"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ChangeEvent เหตุการณ์ข้อมูลเปลี่ยนที่ส่งให้หน้าจอแบบ real-time (GET /api/events)
+// ส่งทันทีที่คำสั่ง SQL สำเร็จ ถ้าอยู่ใน transaction ที่ rollback ภายหลัง event ก็ออกไปแล้ว
+// หน้าจอจึงควรใช้ event เป็นสัญญาณให้โหลดรายการนั้นใหม่ มากกว่าเชื่อ Data ทั้งหมด
+type ChangeEvent struct {
+	Type     string         `json:"type"`     // เช่น "room.updated", "parcel.created"
+	Entity   string         `json:"entity"`   // ชื่อตาราง เช่น "rooms"
+	Action   string         `json:"action"`   // create | update | delete
+	RecordID string         `json:"recordId"` // primary key ของแถว
+	Data     map[string]any `json:"data"`     // ค่าล่าสุดของแถว (delete = ค่าก่อนลบ)
+	At       time.Time      `json:"at"`
+}
+
+// ตารางที่ส่ง event ออกไป -> ชื่อ entity ที่ใช้ใน Type
+var eventTables = map[string]string{
+	"prisoners":   "prisoner",
+	"rooms":       "room",
+	"visitations": "visitation",
+	"requestings": "requesting",
+	"parcels":     "parcel",
+}
+
+var eventActions = map[string]string{
+	"create": "created",
+	"update": "updated",
+	"delete": "deleted",
+}
+
+// ขนาด buffer ต่อผู้รับ ถ้าผู้รับอ่านไม่ทัน event ที่เกินจะถูกทิ้ง (ไม่ให้ request หลักค้าง)
+const eventBufferSize = 64
+
+var changeHub = struct {
+	sync.RWMutex
+	subs map[chan ChangeEvent]struct{}
+}{subs: map[chan ChangeEvent]struct{}{}}
+
+// SubscribeChanges สมัครรับ event ข้อมูลเปลี่ยน ต้องเรียก cancel เมื่อเลิกใช้
+func SubscribeChanges() (<-chan ChangeEvent, func()) {
+	ch := make(chan ChangeEvent, eventBufferSize)
+	changeHub.Lock()
+	changeHub.subs[ch] = struct{}{}
+	changeHub.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			changeHub.Lock()
+			delete(changeHub.subs, ch)
+			changeHub.Unlock()
+			close(ch)
+		})
+	}
+}
+
+func publishChange(ev ChangeEvent) {
+	changeHub.RLock()
+	defer changeHub.RUnlock()
+	for ch := range changeHub.subs {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// emitChange เรียกจาก audit callback หลังเขียน audit_logs แล้ว (ใช้แถวที่ audit โหลดไว้)
+func emitChange(db *gorm.DB, action, recordID string, rv reflect.Value) {
+	name, ok := eventTables[db.Statement.Table]
+	if !ok {
+		return
+	}
+	publishChange(ChangeEvent{
+		Type:     name + "." + eventActions[action],
+		Entity:   db.Statement.Table,
+		Action:   action,
+		RecordID: recordID,
+		Data:     auditRow(db, rv),
+		At:       time.Now(),
+	})
+}
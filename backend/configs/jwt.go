@@ -17,3 +17,15 @@ func getEnv(k, d string) string {
 func JWTSecret() []byte { return jwtSecret }
 
 func AccessTokenTTL() time.Duration { return 2 * time.Hour }
+
+func RefreshTokenTTL() time.Duration { return 7 * 24 * time.Hour }
+
+func PasswordResetTTL() time.Duration { return 30 * time.Minute }
+
+// จำกัดการขอรีเซ็ตรหัสต่อบัญชี: ห่างกันอย่างน้อย PasswordResetCooldown และไม่เกิน PasswordResetMaxPerHour ครั้งต่อชั่วโมง
+func PasswordResetCooldown() time.Duration { return time.Minute }
+
+func PasswordResetMaxPerHour() int { return 5 }
+
+// PasswordResetURL หน้าเว็บสำหรับตั้งรหัสผ่านใหม่ (ต่อท้ายด้วย token ในอีเมล), ว่าง = ส่งเฉพาะรหัส
+func PasswordResetURL() string { return getEnv("PASSWORD_RESET_URL", "") }
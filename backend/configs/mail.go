@@ -0,0 +1,175 @@
+package configs
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"sync"
+	"time"
+)
+
+// MailSender ส่งอีเมลหนึ่งฉบับ ใช้ผ่าน Mailer() และเปลี่ยนตัวส่งได้ด้วย SetMailer
+type MailSender interface {
+	Send(to, subject, body string) error
+}
+
+// SMTPSender ส่งผ่าน SMTP server ตั้งค่าด้วย env:
+//
+//	SMTP_HOST, SMTP_PORT (587), SMTP_USERNAME, SMTP_PASSWORD, SMTP_FROM
+//
+// ใช้ STARTTLS เมื่อ server รองรับ ทดสอบกับ server จำลองในเครื่องได้ เช่น
+// MailHog/Mailpit: SMTP_HOST=localhost SMTP_PORT=1025
+type SMTPSender struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	Timeout  time.Duration
+}
+
+func (s SMTPSender) Send(to, subject, body string) error {
+	msg, err := buildMailMessage(s.From, to, subject, body)
+	if err != nil {
+		return err
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(s.Host, s.Port), timeout)
+	if err != nil {
+		return err
+	}
+	// ไม่ให้ job ส่งเมลค้างถ้า server ตอบช้า
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c, err := smtp.NewClient(conn, s.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.Host}); err != nil {
+			return err
+		}
+	}
+	if s.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.Username, s.Password, s.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(s.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// logSender ใช้ตอนไม่ได้ตั้ง SMTP_HOST (เครื่อง dev): บันทึกแค่ผู้รับ (และ template ถ้าส่งผ่าน SendMail) ลง log แทนการส่งจริง
+// ไม่พิมพ์หัวเรื่อง/เนื้อหา เพราะอาจมีข้อมูลส่วนตัวหรือรหัสลับ (เช่นรหัสรีเซ็ตรหัสผ่าน)
+type logSender struct{}
+
+func (logSender) Send(to, subject, body string) error {
+	log.Printf("mail (SMTP_HOST not set, not sent): to=%s", to)
+	return nil
+}
+
+// SendMail ส่งอีเมลผ่าน s โดยบอกชื่อ template ไปด้วย (ใช้เฉพาะตอน log แทนการส่งจริง)
+func SendMail(s MailSender, to, template, subject, body string) error {
+	if _, ok := s.(logSender); ok {
+		log.Printf("mail (SMTP_HOST not set, not sent): to=%s template=%s", to, template)
+		return nil
+	}
+	return s.Send(to, subject, body)
+}
+
+// buildMailMessage สร้างข้อความ RFC 5322 แบบ UTF-8 (หัวเรื่องภาษาไทยเข้ารหัสแบบ RFC 2047)
+func buildMailMessage(from, to, subject, body string) ([]byte, error) {
+	// ParseAddress กันที่อยู่ที่มีขึ้นบรรทัดใหม่ (header injection)
+	if _, err := mail.ParseAddress(to); err != nil {
+		return nil, fmt.Errorf("invalid recipient %q: %w", to, err)
+	}
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("invalid sender %q: %w", from, err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes(), nil
+}
+
+var (
+	mailer     MailSender
+	mailerOnce sync.Once
+	mailerMu   sync.RWMutex
+)
+
+// Mailer คืนตัวส่งอีเมล (ถ้ายังไม่ได้ SetMailer ใช้ค่าจาก env, ไม่มี SMTP_HOST = พิมพ์ลง log)
+func Mailer() MailSender {
+	mailerOnce.Do(func() {
+		mailerMu.Lock()
+		defer mailerMu.Unlock()
+		if mailer == nil {
+			mailer = mailerFromEnv()
+		}
+	})
+	mailerMu.RLock()
+	defer mailerMu.RUnlock()
+	return mailer
+}
+
+func mailerFromEnv() MailSender {
+	host := getEnv("SMTP_HOST", "")
+	if host == "" {
+		return logSender{}
+	}
+	return SMTPSender{
+		Host:     host,
+		Port:     getEnv("SMTP_PORT", "587"),
+		Username: getEnv("SMTP_USERNAME", ""),
+		Password: getEnv("SMTP_PASSWORD", ""),
+		From:     getEnv("SMTP_FROM", "no-reply@sa-project.local"),
+	}
+}
+
+// SetMailer เปลี่ยนตัวส่งอีเมล (เช่น ใช้ตัวจำลองตอนทดสอบ)
+func SetMailer(s MailSender) {
+	mailerMu.Lock()
+	mailer = s
+	mailerMu.Unlock()
+}
@@ -0,0 +1,183 @@
+package configs
+
+import (
+	"bufio"
+	"encoding/base64"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession สิ่งที่ server จำลองได้รับจาก client หนึ่ง connection
+type smtpSession struct {
+	from string
+	rcpt []string
+	data string
+}
+
+// startFakeSMTP เปิด SMTP server จำลองในโปรเซส (ไม่รองรับ STARTTLS/AUTH) รับได้ connection เดียว
+func startFakeSMTP(t *testing.T) (host, port string, got <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		var sess smtpSession
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			cmd := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 fake")
+			case strings.HasPrefix(cmd, "MAIL FROM:"):
+				sess.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+				reply("250 OK")
+			case strings.HasPrefix(cmd, "RCPT TO:"):
+				sess.rcpt = append(sess.rcpt, strings.Trim(line[len("RCPT TO:"):], "<> "))
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 end with <CRLF>.<CRLF>")
+				var b strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					b.WriteString(strings.TrimPrefix(l, "."))
+				}
+				sess.data = b.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				ch <- sess
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+
+	host, port, _ = net.SplitHostPort(ln.Addr().String())
+	return host, port, ch
+}
+
+func TestSMTPSenderSend(t *testing.T) {
+	host, port, got := startFakeSMTP(t)
+	s := SMTPSender{Host: host, Port: port, From: "no-reply@sa-project.local", Timeout: 5 * time.Second}
+
+	subject := "รีเซ็ตรหัสผ่านบัญชี admin01"
+	body := "รหัสรีเซ็ตของคุณคือ 123456\nใช้ได้ 30 นาที"
+	if err := s.Send("user@example.com", subject, body); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	var sess smtpSession
+	select {
+	case sess = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fake server did not receive the message")
+	}
+	if sess.from != s.From {
+		t.Errorf("MAIL FROM = %q, want %q", sess.from, s.From)
+	}
+	if len(sess.rcpt) != 1 || sess.rcpt[0] != "user@example.com" {
+		t.Errorf("RCPT TO = %v, want [user@example.com]", sess.rcpt)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(sess.data))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	gotSubject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("decode subject: %v", err)
+	}
+	if gotSubject != subject {
+		t.Errorf("Subject = %q, want %q", gotSubject, subject)
+	}
+	if ct := msg.Header.Get("Content-Type"); ct != "text/plain; charset=UTF-8" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	raw := new(strings.Builder)
+	if _, err := bufio.NewReader(msg.Body).WriteTo(raw); err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(raw.String(), "\r\n", ""))
+	if err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if string(decoded) != body {
+		t.Errorf("body = %q, want %q", decoded, body)
+	}
+}
+
+func TestSMTPSenderServerDown(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+
+	s := SMTPSender{Host: host, Port: port, From: "no-reply@sa-project.local", Timeout: time.Second}
+	if err := s.Send("user@example.com", "subject", "body"); err == nil {
+		t.Fatal("expected error when server is not reachable")
+	}
+}
+
+func TestBuildMailMessageRejectsHeaderInjection(t *testing.T) {
+	cases := []struct{ from, to string }{
+		{"no-reply@sa-project.local", "user@example.com\r\nBcc: evil@example.com"},
+		{"no-reply@sa-project.local\r\nBcc: evil@example.com", "user@example.com"},
+		{"no-reply@sa-project.local", "not an address"},
+	}
+	for _, tc := range cases {
+		if _, err := buildMailMessage(tc.from, tc.to, "subject", "body"); err == nil {
+			t.Errorf("buildMailMessage(%q, %q) should fail", tc.from, tc.to)
+		}
+	}
+}
+
+func TestBuildMailMessageWrapsBody(t *testing.T) {
+	body := strings.Repeat("ก", 200)
+	msg, err := buildMailMessage("no-reply@sa-project.local", "user@example.com", "หัวเรื่อง", body)
+	if err != nil {
+		t.Fatalf("buildMailMessage: %v", err)
+	}
+	parts := strings.SplitN(string(msg), "\r\n\r\n", 2)
+	if len(parts) != 2 {
+		t.Fatal("message has no header/body separator")
+	}
+	if strings.Contains(parts[0], "หัวเรื่อง") {
+		t.Error("subject header should be RFC 2047 encoded")
+	}
+	for _, line := range strings.Split(strings.TrimRight(parts[1], "\r\n"), "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("body line longer than 76 chars: %d", len(line))
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package configs
+
+import "time"
+
+var bangkok = loadBangkok()
+
+// Bangkok เขตเวลาไทย ใช้นับปี พ.ศ. ของเลขที่เอกสาร
+// เครื่องที่ไม่มีฐานข้อมูล timezone (เช่น container ขนาดเล็ก) ใช้ UTC+7 คงที่แทน (ไทยไม่มีเวลาออมแสง)
+func Bangkok() *time.Location { return bangkok }
+
+func loadBangkok() *time.Location {
+	if loc, err := time.LoadLocation("Asia/Bangkok"); err == nil {
+		return loc
+	}
+	return time.FixedZone("ICT", 7*3600)
+}
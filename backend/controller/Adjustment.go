@@ -2,6 +2,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -59,7 +60,7 @@ func CreateAdjustment(c *gin.Context) {
 		return
 	}
 
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 
 	// verify prisoner
 	var prisoner entity.Prisoner
@@ -95,6 +96,9 @@ func CreateAdjustment(c *gin.Context) {
 				return res.Error
 			}
 		} else {
+			if err := ensureScoreNotFrozen(sb); err != nil {
+				return err
+			}
 			oldScore = sb.Score
 			sb.Score = input.NewScore
 			if err := tx.Save(&sb).Error; err != nil {
@@ -123,6 +127,10 @@ func CreateAdjustment(c *gin.Context) {
 		c.Set("adj_result", adj)
 		return nil
 	})
+	if errors.Is(err, errScoreFrozen) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create adjustment: " + err.Error()})
 		return
@@ -150,7 +158,7 @@ func GetAdjustments(c *gin.Context) {
 		MemberLast  *string   `json:"MemberLast"`
 	}
 	var rows []AdjRow
-	err := configs.DB().Raw(`
+	err := configs.DB().WithContext(c).Raw(`
 		SELECT 
 			a.a_id        AS AID,
 			a.old_score   AS OldScore,
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"fmt"
 	"net/http"
 	"strconv"
 	"time"
@@ -8,6 +9,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sa-project/configs"
 	"github.com/sa-project/entity"
+	"gorm.io/gorm"
 )
 
 type MedicalHistoryInput struct {
@@ -20,6 +22,7 @@ type MedicalHistoryInput struct {
 	// frontend ส่งจาก DatePicker.toISOString()
 	Date_Inspection  *string `json:"Date_Inspection"`  // ISO-8601 string
 	Next_appointment *string `json:"Next_appointment"` // ISO-8601 string หรือ null
+	Isolation        *bool   `json:"Isolation"`        // แยกกักตัว
 
 	StaffID     *uint `json:"StaffID"`
 	Prisoner_ID *uint `json:"Prisoner_ID"`
@@ -52,7 +55,7 @@ func parseISODatePtr(s *string) (*time.Time, error) {
 // GET /api/medical_histories
 func GetMedicalHistories(c *gin.Context) {
 	var items []entity.Medical_History
-	if err := configs.DB().
+	if err := configs.DB().WithContext(c).
 		Preload("Prisoner").
 		Preload("Staff").
 		Find(&items).Error; err != nil {
@@ -72,7 +75,7 @@ func GetMedicalHistory(c *gin.Context) {
 	}
 
 	var mh entity.Medical_History
-	if err := configs.DB().
+	if err := configs.DB().WithContext(c).
 		Preload("Prisoner").
 		Preload("Staff").
 		First(&mh, id).Error; err != nil {
@@ -117,17 +120,18 @@ func CreateMedicalHistory(c *gin.Context) {
 		Diagnosis:        *in.Diagnosis,
 		Date_Inspection:  dateInspection,
 		Next_appointment: nextAppt,
+		Isolation:        in.Isolation != nil && *in.Isolation,
 		StaffID:          in.StaffID,
 		Prisoner_ID:      in.Prisoner_ID,
 	}
 
-	if err := configs.DB().Create(&mh).Error; err != nil {
+	if err := configs.DB().WithContext(c).Create(&mh).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create medical history"})
 		return
 	}
 
 	// preload ความสัมพันธ์เพื่อให้ frontend ใช้ได้ทันที
-	if err := configs.DB().
+	if err := configs.DB().WithContext(c).
 		Preload("Prisoner").
 		Preload("Staff").
 		First(&mh, mh.MedicalID).Error; err != nil {
@@ -149,7 +153,7 @@ func UpdateMedicalHistory(c *gin.Context) {
 	}
 
 	var mh entity.Medical_History
-	if err := configs.DB().First(&mh, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&mh, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Medical history not found"})
 		return
 	}
@@ -192,6 +196,9 @@ func UpdateMedicalHistory(c *gin.Context) {
 		}
 		mh.Next_appointment = tp // อนุญาตให้ตั้งเป็น nil ได้
 	}
+	if in.Isolation != nil {
+		mh.Isolation = *in.Isolation
+	}
 	if in.StaffID != nil {
 		mh.StaffID = in.StaffID
 	}
@@ -199,13 +206,13 @@ func UpdateMedicalHistory(c *gin.Context) {
 		mh.Prisoner_ID = in.Prisoner_ID
 	}
 
-	if err := configs.DB().Save(&mh).Error; err != nil {
+	if err := configs.DB().WithContext(c).Save(&mh).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update medical history"})
 		return
 	}
 
 	// preload ให้เหมือนเดิม
-	if err := configs.DB().
+	if err := configs.DB().WithContext(c).
 		Preload("Prisoner").
 		Preload("Staff").
 		First(&mh, id).Error; err != nil {
@@ -225,9 +232,55 @@ func DeleteMedicalHistory(c *gin.Context) {
 		return
 	}
 
-	if err := configs.DB().Delete(&entity.Medical_History{}, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).Delete(&entity.Medical_History{}, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete medical history"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Medical history deleted successfully"})
 }
+
+func init() {
+	RegisterJob(&Job{
+		Name:        "appointment-reminders",
+		Description: "สร้างการแจ้งเตือนนัดตรวจที่จะถึงภายใน 24 ชั่วโมง",
+		Interval:    time.Hour,
+		Run:         createAppointmentReminders,
+	})
+}
+
+func createAppointmentReminders(db *gorm.DB) (int, string, error) {
+	now := time.Now()
+
+	var due []entity.Medical_History
+	if err := db.Preload("Prisoner").
+		Where("next_appointment > ? AND next_appointment <= ?", now, now.Add(24*time.Hour)).
+		Find(&due).Error; err != nil {
+		return 0, "", err
+	}
+
+	created := 0
+	for _, mh := range due {
+		var exists int64
+		db.Model(&entity.AppointmentReminder{}).
+			Where("medical_id = ? AND appointment_at = ?", mh.MedicalID, *mh.Next_appointment).
+			Count(&exists)
+		if exists > 0 {
+			continue
+		}
+		reminder := entity.AppointmentReminder{
+			MedicalID:     mh.MedicalID,
+			AppointmentAt: *mh.Next_appointment,
+			Prisoner_ID:   mh.Prisoner_ID,
+			StaffID:       mh.StaffID,
+			Message: fmt.Sprintf("นัดตรวจ %s %s (%s) วันที่ %s",
+				mh.Prisoner.FirstName, mh.Prisoner.LastName, mh.Prisoner.Inmate_ID,
+				mh.Next_appointment.Format("2006-01-02 15:04")),
+		}
+		if err := db.Create(&reminder).Error; err != nil {
+			return created, "", err
+		}
+		logNotifyError(notifyRanks(db, staffRanks, NotifyAppointmentTomorrow, "นัดตรวจภายใน 24 ชั่วโมง", reminder.Message, "medical_history", uint(mh.MedicalID)))
+		created++
+	}
+	return created, fmt.Sprintf("สร้างการแจ้งเตือนนัด %d รายการ", created), nil
+}
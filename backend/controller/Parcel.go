@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sa-project/configs"
 	"github.com/sa-project/entity"
+	"gorm.io/gorm"
 )
 
 // ดึง mid จาก context (มาจาก JWT ที่ middleware ใส่ให้)
@@ -32,7 +33,7 @@ func midFromContextInt(c *gin.Context) int {
 
 func GetParcels(c *gin.Context) {
 	var parcels []entity.Parcel
-	if err := configs.DB().Find(&parcels).Error; err != nil {
+	if err := configs.DB().WithContext(c).Find(&parcels).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch parcels"})
 		return
 	}
@@ -41,43 +42,64 @@ func GetParcels(c *gin.Context) {
 
 func CreateParcel(c *gin.Context) {
 	var input struct {
-		ParcelName string `json:"parcelName"`
-		Quantity   int    `json:"quantity"`
-		Type_ID    uint   `json:"type_ID"`
+		ParcelName      string `json:"parcelName"`
+		Quantity        int    `json:"quantity"`
+		Type_ID         uint   `json:"type_ID"`
+		stockLevelInput        // ไม่ส่ง = หน่วย "ชิ้น", จุดสั่งซื้อ 20
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.Quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quantity must be >= 0"})
+		return
+	}
+	if input.Quantity > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": errStockViaPO.Error()})
+		return
+	}
 
 	var existing entity.Parcel
-	if err := configs.DB().Where("parcel_name = ?", input.ParcelName).First(&existing).Error; err == nil {
+	if err := configs.DB().WithContext(c).Where("parcel_name = ?", input.ParcelName).First(&existing).Error; err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "Parcel already exists"})
 		return
 	}
 
 	parcel := entity.Parcel{
-		ParcelName: input.ParcelName,
-		Quantity:   input.Quantity,
-		Type_ID:    input.Type_ID,
-		Status:     calculateStatus(input.Quantity),
+		ParcelName:   input.ParcelName,
+		Quantity:     0,
+		Type_ID:      input.Type_ID,
+		Unit:         "ชิ้น",
+		ReorderPoint: 20,
 	}
-	if err := configs.DB().Create(&parcel).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Create parcel failed"})
+	if err := input.stockLevelInput.apply(&parcel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	parcel.Status = calculateStatus(parcel)
 
-	// Log: เพิ่มใหม่ (OperatorID=4)
+	// Log: เพิ่มใหม่ (OperatorID=4) พัสดุใหม่เริ่มที่ 0 รับของครั้งแรกผ่านใบสั่งซื้อ
 	mid := midFromContextInt(c)
-	_ = configs.DB().Create(&entity.Operation{
-		DateTime:     time.Now(),
-		PID:          parcel.PID,
-		OldQuantity:  0,
-		NewQuantity:  parcel.Quantity,
-		ChangeAmount: parcel.Quantity,
-		OperatorID:   4,
-		MID:          mid, // ← ใช้ MID จาก JWT
-	}).Error
+	err := configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&parcel).Error; err != nil {
+			return err
+		}
+		// ReorderPoint มีค่า default ใน DB: ค่า 0 ที่ตั้งใจส่งมาจะถูกแทนด้วย default ตอน Create
+		if input.ReorderPoint != nil && *input.ReorderPoint == 0 {
+			parcel.ReorderPoint = 0
+			parcel.Status = calculateStatus(parcel)
+			if err := tx.Model(&parcel).Updates(map[string]any{"reorder_point": 0, "status": parcel.Status}).Error; err != nil {
+				return err
+			}
+		}
+		_, err := logStockOperation(tx, parcel, 0, operatorCreate, mid, nil)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Create parcel failed"})
+		return
+	}
 
 	c.JSON(http.StatusCreated, parcel)
 }
@@ -90,98 +112,88 @@ func UpdateParcel(c *gin.Context) {
 	}
 
 	var parcel entity.Parcel
-	if err := configs.DB().First(&parcel, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&parcel, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Parcel not found"})
 		return
 	}
 
 	var input struct {
-		ParcelName string `json:"parcelName"`
-		Quantity   int    `json:"quantity"`
-		Type_ID    uint   `json:"type_ID"`
+		ParcelName      string `json:"parcelName"`
+		Quantity        int    `json:"quantity"`
+		Type_ID         uint   `json:"type_ID"`
+		stockLevelInput        // ส่งเฉพาะที่ต้องการแก้
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.Quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quantity must be >= 0"})
+		return
+	}
+	if input.Quantity > parcel.Quantity {
+		c.JSON(http.StatusConflict, gin.H{"error": errStockViaPO.Error()})
+		return
+	}
 
 	oldQty := parcel.Quantity
 	oldName := parcel.ParcelName
 	oldType := parcel.Type_ID
 
 	parcel.ParcelName = input.ParcelName
-	parcel.Quantity = input.Quantity
 	parcel.Type_ID = input.Type_ID
-	parcel.Status = calculateStatus(input.Quantity)
-
-	if err := configs.DB().Save(&parcel).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Save failed"})
+	if err := input.stockLevelInput.apply(&parcel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	parcel.Status = calculateStatus(parcel)
 
-	// Log: แก้ไข (OperatorID=3)
+	// Log: แก้ไข (OperatorID=3) ปรับยอดลดได้อย่างเดียว: ตัดล็อตตาม FEFO (รวมล็อตหมดอายุ)
 	mid := midFromContextInt(c)
-	_ = configs.DB().Create(&entity.Operation{
-		DateTime:      time.Now(),
-		PID:           parcel.PID,
-		OldQuantity:   oldQty,
-		NewQuantity:   parcel.Quantity,
-		ChangeAmount:  input.Quantity - oldQty,
-		OperatorID:    3,
-		MID:           mid, // ← ใช้ MID จาก JWT
-		OldParcelName: oldName,
-		NewParcelName: parcel.ParcelName,
-		OldTypeID:     ptrInt(int(oldType)),
-		NewTypeID:     ptrInt(int(parcel.Type_ID)),
-	}).Error
-
-	c.JSON(http.StatusOK, parcel)
-}
-
-func AddParcel(c *gin.Context) {
-	id, err := atoiParam(c.Param("id"))
+	err = configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&parcel).Updates(map[string]any{
+			"parcel_name":   parcel.ParcelName,
+			"type_id":       parcel.Type_ID,
+			"unit":          parcel.Unit,
+			"min_level":     parcel.MinLevel,
+			"reorder_point": parcel.ReorderPoint,
+			"max_level":     parcel.MaxLevel,
+			"status":        parcel.Status,
+		}).Error; err != nil {
+			return err
+		}
+		var op entity.Operation
+		var err error
+		if input.Quantity < oldQty {
+			op, err = issueStock(tx, &parcel, oldQty-input.Quantity, operatorEdit, mid, true)
+		} else {
+			op, err = logStockOperation(tx, parcel, oldQty, operatorEdit, mid, nil)
+		}
+		if err != nil {
+			return err
+		}
+		return tx.Model(&op).Updates(map[string]any{
+			"old_parcel_name": oldName,
+			"new_parcel_name": parcel.ParcelName,
+			"old_type_id":     int(oldType),
+			"new_type_id":     int(parcel.Type_ID),
+		}).Error
+	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
-		return
-	}
-
-	var parcel entity.Parcel
-	if err := configs.DB().First(&parcel, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Parcel not found"})
-		return
-	}
-
-	var body struct {
-		Amount int `json:"amount"`
-	}
-	if err := c.ShouldBindJSON(&body); err != nil || body.Amount <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be > 0"})
-		return
-	}
-
-	oldQty := parcel.Quantity
-	parcel.Quantity += body.Amount
-	parcel.Status = calculateStatus(parcel.Quantity)
-	if err := configs.DB().Save(&parcel).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Save failed"})
+		c.JSON(stockErrorStatus(err), gin.H{"error": "Save failed: " + err.Error()})
 		return
 	}
 
-	// Log: เพิ่ม (OperatorID=1)
-	mid := midFromContextInt(c)
-	_ = configs.DB().Create(&entity.Operation{
-		DateTime:     time.Now(),
-		PID:          parcel.PID,
-		OldQuantity:  oldQty,
-		NewQuantity:  parcel.Quantity,
-		ChangeAmount: body.Amount,
-		OperatorID:   1,
-		MID:          mid, // ← ใช้ MID จาก JWT
-	}).Error
-
 	c.JSON(http.StatusOK, parcel)
 }
 
+// POST /api/parcels/:id/add  เลิกใช้: ของที่เพิ่มเข้าคลังทุกครั้งต้องอ้างอิงใบสั่งซื้อ
+// (รับของผ่าน POST /api/purchase-orders/:id/receive)
+func AddParcel(c *gin.Context) {
+	c.JSON(http.StatusConflict, gin.H{"error": errStockViaPO.Error()})
+}
+
+// POST /api/parcels/:id/reduce  { "amount": 5 }  เบิกตาม FEFO จากล็อตที่ยังไม่หมดอายุ (ไม่พอ = 409)
 func ReduceParcel(c *gin.Context) {
 	id, err := atoiParam(c.Param("id"))
 	if err != nil {
@@ -190,7 +202,7 @@ func ReduceParcel(c *gin.Context) {
 	}
 
 	var parcel entity.Parcel
-	if err := configs.DB().First(&parcel, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&parcel, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Parcel not found"})
 		return
 	}
@@ -203,29 +215,18 @@ func ReduceParcel(c *gin.Context) {
 		return
 	}
 
-	oldQty := parcel.Quantity
-	if body.Amount > parcel.Quantity {
-		parcel.Quantity = 0
-	} else {
-		parcel.Quantity -= body.Amount
-	}
-	parcel.Status = calculateStatus(parcel.Quantity)
-	if err := configs.DB().Save(&parcel).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Save failed"})
-		return
-	}
-
+	oldStatus := parcel.Status
 	// Log: เบิก (OperatorID=2)
 	mid := midFromContextInt(c)
-	_ = configs.DB().Create(&entity.Operation{
-		DateTime:     time.Now(),
-		PID:          parcel.PID,
-		OldQuantity:  oldQty,
-		NewQuantity:  parcel.Quantity,
-		ChangeAmount: -body.Amount,
-		OperatorID:   2,
-		MID:          mid, // ← ใช้ MID จาก JWT
-	}).Error
+	err = configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		_, err := issueStock(tx, &parcel, body.Amount, operatorIssue, mid, false)
+		return err
+	})
+	if err != nil {
+		c.JSON(stockErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	logNotifyError(notifyStockLow(configs.DB(), parcel, oldStatus))
 
 	c.JSON(http.StatusOK, parcel)
 }
@@ -236,38 +237,66 @@ func DeleteParcel(c *gin.Context) {
 		return
 	}
 
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	var parcel entity.Parcel
 	if err := db.First(&parcel, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Parcel not found"})
 		return
 	}
 
-	// log ก่อนลบ (OperatorID=5 คือ “ลบ”)
-	mid := midFromContextInt(c)
-	_ = db.Create(&entity.Operation{
-		DateTime:      time.Now(),
-		PID:           parcel.PID,
-		OldQuantity:   parcel.Quantity,
-		NewQuantity:   0,
-		ChangeAmount:  -parcel.Quantity,
-		OperatorID:    5,
-		MID:           mid,
-		OldParcelName: parcel.ParcelName,
-		OldTypeID:     ptrInt(int(parcel.Type_ID)),
-	}).Error
+	// ลบไม่ได้ถ้ายังมีของจองให้คำขอเบิก หรือมีใบสั่งซื้อที่ยังไม่ปิดอ้างถึง (ลบแล้วจ่าย/รับของไม่ได้)
+	if parcel.Reserved > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "ลบไม่ได้: มีคำขอเบิกที่อนุมัติแล้วจองพัสดุนี้อยู่"})
+		return
+	}
+	var openLines int64
+	if err := db.Model(&entity.PurchaseOrderLine{}).
+		Joins("JOIN purchase_orders ON purchase_orders.id = purchase_order_lines.purchase_order_id").
+		Where("purchase_order_lines.p_id = ? AND purchase_orders.status IN ?", parcel.PID,
+			[]string{entity.PODraft, entity.POOrdered, entity.POPartiallyReceived}).
+		Count(&openLines).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Delete failed"})
+		return
+	}
+	if openLines > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "ลบไม่ได้: มีใบสั่งซื้อที่ยังไม่ปิดอ้างถึงพัสดุนี้"})
+		return
+	}
 
-	if err := db.Delete(&entity.Parcel{}, id).Error; err != nil {
+	// log ก่อนลบ (OperatorID=5 คือ “ลบ”) ใน transaction เดียวกับการลบ
+	mid := midFromContextInt(c)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&entity.Operation{
+			DateTime:      time.Now(),
+			PID:           parcel.PID,
+			OldQuantity:   parcel.Quantity,
+			NewQuantity:   0,
+			ChangeAmount:  -parcel.Quantity,
+			OperatorID:    operatorDelete,
+			MID:           mid,
+			OldParcelName: parcel.ParcelName,
+			OldTypeID:     ptrInt(int(parcel.Type_ID)),
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("p_id = ?", id).Delete(&entity.ParcelLot{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&entity.Parcel{}, id).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Delete failed"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
 }
 
-func calculateStatus(qty int) string {
-	if qty == 0 {
+// calculateStatus สถานะตามจุดสั่งซื้อของแต่ละรายการ (เดิมใช้ <= 20 กับทุกรายการ)
+// นับเฉพาะของที่ยังไม่หมดอายุ: ล็อตหมดอายุใช้ไม่ได้ ไม่ควรทำให้ดูเหมือนยังมีของ
+func calculateStatus(p entity.Parcel) string {
+	if p.Available == 0 {
 		return "หมดแล้ว"
-	} else if qty <= 20 {
+	} else if p.Available <= p.ReorderPoint {
 		return "ใกล้หมด"
 	}
 	return "คงเหลือ"
@@ -21,7 +21,7 @@ type ScoreBehaviorWithPrisoner struct {
 func GetScoreBehaviors(c *gin.Context) {
 	var results []ScoreBehaviorWithPrisoner
 
-	err := configs.DB().Raw(`
+	err := configs.DB().WithContext(c).Raw(`
 		SELECT
 			sb.s_id                     AS SID,
 			p.prisoner_id               AS Prisoner_ID,
@@ -47,11 +47,16 @@ func UpdateScoreBehavior(c *gin.Context) {
 	id := c.Param("id")
 
 	var scoreBehavior entity.ScoreBehavior
-	if err := configs.DB().First(&scoreBehavior, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&scoreBehavior, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Score behavior not found"})
 		return
 	}
 
+	if err := ensureScoreNotFrozen(scoreBehavior); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
 	var input struct {
 		Score int `json:"score"`
 	}
@@ -61,7 +66,7 @@ func UpdateScoreBehavior(c *gin.Context) {
 	}
 
 	scoreBehavior.Score = input.Score
-	if err := configs.DB().Save(&scoreBehavior).Error; err != nil {
+	if err := configs.DB().WithContext(c).Save(&scoreBehavior).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update score"})
 		return
 	}
@@ -43,7 +43,7 @@ func parseBirthdayFlexible(s string) (time.Time, error) {
 // GET /api/staffs
 func GetStaffs(c *gin.Context) {
 	var staffs []entity.Staff
-	if err := configs.DB().
+	if err := configs.DB().WithContext(c).
 		Preload("Gender").
 		Find(&staffs).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch staffs"})
@@ -56,7 +56,7 @@ func GetStaffs(c *gin.Context) {
 func GetStaffByID(c *gin.Context) {
 	id := c.Param("id")
 	var staff entity.Staff
-	if err := configs.DB().
+	if err := configs.DB().WithContext(c).
 		Preload("Gender").
 		First(&staff, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Staff not found"})
@@ -85,7 +85,7 @@ func CreateStaff(c *gin.Context) {
 			return
 		}
 		var cnt int64
-		if err := configs.DB().Model(&entity.Staff{}).
+		if err := configs.DB().WithContext(c).Model(&entity.Staff{}).
 			Where("staff_id = ?", *input.StaffID).Count(&cnt).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check StaffID"})
 			return
@@ -110,12 +110,12 @@ func CreateStaff(c *gin.Context) {
 		staff.StaffID = *input.StaffID
 	}
 
-	if err := configs.DB().Create(&staff).Error; err != nil {
+	if err := configs.DB().WithContext(c).Create(&staff).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	configs.DB().Preload("Gender").First(&staff, staff.StaffID)
+	configs.DB().WithContext(c).Preload("Gender").First(&staff, staff.StaffID)
 	c.JSON(http.StatusCreated, staff)
 }
 
@@ -124,7 +124,7 @@ func UpdateStaff(c *gin.Context) {
 	id := c.Param("id")
 
 	var current entity.Staff
-	if err := configs.DB().First(&current, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&current, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Staff not found"})
 		return
 	}
@@ -152,12 +152,12 @@ func UpdateStaff(c *gin.Context) {
 		// ไม่แตะ Username/Password/AdminID
 	}
 
-	if err := configs.DB().Model(&current).Updates(update).Error; err != nil {
+	if err := configs.DB().WithContext(c).Model(&current).Updates(update).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update staff"})
 		return
 	}
 
-	configs.DB().Preload("Gender").First(&current, id)
+	configs.DB().WithContext(c).Preload("Gender").First(&current, id)
 	c.JSON(http.StatusOK, current)
 }
 
@@ -167,13 +167,13 @@ func DeleteStaff(c *gin.Context) {
 
 	// กันลบถ้ามีการอ้างอิง
 	var count int64
-	configs.DB().Model(&entity.Requesting{}).Where("staff_id = ?", id).Count(&count)
+	configs.DB().WithContext(c).Model(&entity.Requesting{}).Where("staff_id = ?", id).Count(&count)
 	if count > 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ไม่สามารถลบเจ้าหน้าที่ได้ เนื่องจากมีคำขอเบิกที่อ้างอิงถึงเจ้าหน้าที่คนนี้"})
 		return
 	}
 
-	if err := configs.DB().Delete(&entity.Staff{}, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).Delete(&entity.Staff{}, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete staff"})
 		return
 	}
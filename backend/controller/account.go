@@ -0,0 +1,366 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+type changePasswordInput struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+type forgotPasswordInput struct {
+	// ระบุอย่างใดอย่างหนึ่ง
+	Email    string `json:"email"`
+	Username string `json:"username"`
+}
+
+type resetPasswordInput struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+type updateMeInput struct {
+	Email     *string `json:"email"`
+	FirstName *string `json:"firstName"`
+	LastName  *string `json:"lastName"`
+	Birthday  *string `json:"birthday"`
+	Language  *string `json:"language"`
+	// ต้องใส่รหัสผ่านปัจจุบันเมื่อเปลี่ยนอีเมล (อีเมลใช้รีเซ็ตรหัสผ่านได้)
+	CurrentPassword string `json:"current_password"`
+}
+
+var errResetTokenInvalid = errors.New("invalid or expired reset token")
+
+func memberProfile(m entity.Member) gin.H {
+	return gin.H{
+		"MID":       m.MID,
+		"username":  m.Username,
+		"email":     m.Email,
+		"firstName": m.FirstName,
+		"lastName":  m.LastName,
+		"birthday":  m.Birthday,
+		"language":  m.Language,
+		"rankId":    m.RankID,
+		"citizenId": m.CitizenID,
+	}
+}
+
+// POST /api/auth/change-password  { "old_password": "...", "new_password": "..." }
+// เปลี่ยนรหัสแล้วเพิกถอนทุก session เดิม และออก token คู่ใหม่ให้เครื่องที่เรียก
+func ChangePassword(c *gin.Context) {
+	var in changePasswordInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload: " + err.Error()})
+		return
+	}
+	mid := midFromContext(c)
+	if mid == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	db := configs.DB().WithContext(c)
+	var m entity.Member
+	if err := db.First(&m, "m_id = ?", *mid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(m.Password), []byte(in.OldPassword)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "old password is incorrect"})
+		return
+	}
+	if in.OldPassword == in.NewPassword {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "new password must differ from the old one"})
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(in.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot hash password: " + err.Error()})
+		return
+	}
+
+	jti, _ := c.Get("jti")
+	jtiStr, _ := jti.(string)
+	var signed, rawRefresh string
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&m).Update("password", string(hash)).Error; err != nil {
+			return err
+		}
+		if err := revokeMemberSessions(tx, m.MID); err != nil {
+			return err
+		}
+		if err := revokeAccessJTI(tx, m.MID, jtiStr); err != nil {
+			return err
+		}
+		var err error
+		signed, _, rawRefresh, err = issueSession(tx, m)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to change password: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "password changed",
+		"access_token":  signed,
+		"refresh_token": rawRefresh,
+	})
+}
+
+// passwordResetLimited true ถ้าบัญชีนี้ขอ token ล่าสุดยังไม่พ้น cooldown หรือครบโควตาในชั่วโมงที่ผ่านมาแล้ว
+func passwordResetLimited(db *gorm.DB, mid int) (bool, error) {
+	now := time.Now()
+	var recent []entity.PasswordResetToken
+	if err := db.Select("created_at").
+		Where("m_id = ? AND created_at > ?", mid, now.Add(-time.Hour)).
+		Order("created_at DESC").
+		Find(&recent).Error; err != nil {
+		return false, err
+	}
+	if len(recent) >= configs.PasswordResetMaxPerHour() {
+		return true, nil
+	}
+	return len(recent) > 0 && now.Sub(recent[0].CreatedAt) < configs.PasswordResetCooldown(), nil
+}
+
+// POST /api/auth/forgot-password  { "email": "..." } หรือ { "username": "..." }
+// ตอบเหมือนกันเสมอ ไม่ให้ใช้เดาว่ามีบัญชีนี้หรือไม่; token ส่งทางอีเมลผ่าน outbox
+func ForgotPassword(c *gin.Context) {
+	var in forgotPasswordInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	in.Email = strings.ToLower(strings.TrimSpace(in.Email))
+	in.Username = strings.TrimSpace(in.Username)
+	if in.Email == "" && in.Username == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "email or username is required"})
+		return
+	}
+
+	db := configs.DB().WithContext(c)
+	q := db.Model(&entity.Member{})
+	if in.Email != "" {
+		q = q.Where("email = ?", in.Email)
+	} else {
+		q = q.Where("username = ?", in.Username)
+	}
+	var m entity.Member
+	err := q.First(&m).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("forgot password: member lookup: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "request failed, please try again"})
+		return
+	}
+
+	if err == nil {
+		// ขอถี่เกิน -> ไม่ออก token ใหม่ (ไม่ให้ใช้ยิงอีเมลใส่เจ้าของบัญชี) แต่ตอบเหมือนเดิม
+		limited, lerr := passwordResetLimited(db, m.MID)
+		if lerr != nil {
+			log.Printf("forgot password: rate limit check for %s: %v", m.Username, lerr)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "request failed, please try again"})
+			return
+		}
+		if limited {
+			c.JSON(http.StatusOK, gin.H{"message": "if the account exists, a reset code has been sent to its email"})
+			return
+		}
+
+		raw, err := randomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot generate token"})
+			return
+		}
+		ttl := configs.PasswordResetTTL()
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// token ใหม่ทำให้ token เก่าที่ยังไม่ได้ใช้ใช้ไม่ได้อีก
+			now := time.Now()
+			if err := tx.Model(&entity.PasswordResetToken{}).
+				Where("m_id = ? AND used_at IS NULL", m.MID).
+				Update("used_at", now).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&entity.PasswordResetToken{
+				MID:       m.MID,
+				TokenHash: hashToken(raw),
+				ExpiresAt: now.Add(ttl),
+			}).Error; err != nil {
+				return err
+			}
+			data := map[string]any{
+				"Name":      m.FirstName + " " + m.LastName,
+				"Username":  m.Username,
+				"Token":     raw,
+				"ExpiresIn": fmt.Sprintf("%d นาที", int(ttl.Minutes())),
+			}
+			if emailLanguage(m.Language) == "en" {
+				data["ExpiresIn"] = fmt.Sprintf("%d minutes", int(ttl.Minutes()))
+			}
+			if base := configs.PasswordResetURL(); base != "" {
+				data["Link"] = base + raw
+			}
+			return queueEmail(tx, m.Email, m.Language, EmailPasswordReset, data)
+		})
+		if err != nil {
+			log.Printf("forgot password: create reset token for %s: %v", m.Username, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "request failed, please try again"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "if the account exists, a reset code has been sent to its email"})
+}
+
+// POST /api/auth/reset-password  { "token": "...", "new_password": "..." }
+func ResetPassword(c *gin.Context) {
+	var in resetPasswordInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload: " + err.Error()})
+		return
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(in.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot hash password: " + err.Error()})
+		return
+	}
+
+	err = configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var t entity.PasswordResetToken
+		if err := tx.Where("token_hash = ?", hashToken(strings.TrimSpace(in.Token))).First(&t).Error; err != nil {
+			return errResetTokenInvalid
+		}
+		now := time.Now()
+		if t.UsedAt != nil || now.After(t.ExpiresAt) {
+			return errResetTokenInvalid
+		}
+		// ใช้ได้ครั้งเดียว: ถ้ามีคำขออื่นใช้ token นี้ไปก่อน แถวจะไม่ถูกอัปเดต
+		res := tx.Model(&entity.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", t.ID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errResetTokenInvalid
+		}
+		if err := tx.Model(&entity.Member{}).Where("m_id = ?", t.MID).Update("password", string(hash)).Error; err != nil {
+			return err
+		}
+		// รหัสเดิมอาจรั่ว -> ตัดทุก session
+		return revokeMemberSessions(tx, t.MID)
+	})
+	if errors.Is(err, errResetTokenInvalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset password: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "password has been reset, please login again"})
+}
+
+// PATCH /api/me  แก้ข้อมูลส่วนตัว (อีเมล ชื่อ วันเกิด ภาษา) ส่งเฉพาะฟิลด์ที่ต้องการแก้
+// เปลี่ยนอีเมลต้องแนบ current_password มาด้วย
+// username, rank และเลขบัตรประชาชนแก้เองไม่ได้ (เลขบัตรใช้ผูกกับข้อมูลผู้เยี่ยม)
+func UpdateMe(c *gin.Context) {
+	var in updateMeInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	mid := midFromContext(c)
+	if mid == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+
+	db := configs.DB().WithContext(c)
+	var m entity.Member
+	if err := db.First(&m, "m_id = ?", *mid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+		return
+	}
+
+	updates := map[string]any{}
+	if in.Email != nil {
+		email := strings.ToLower(strings.TrimSpace(*in.Email))
+		if email == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email cannot be empty"})
+			return
+		}
+		if email != m.Email {
+			if in.CurrentPassword == "" {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "current_password is required to change email"})
+				return
+			}
+			if err := bcrypt.CompareHashAndPassword([]byte(m.Password), []byte(in.CurrentPassword)); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "current password is incorrect"})
+				return
+			}
+		}
+		var cnt int64
+		db.Model(&entity.Member{}).Where("email = ? AND m_id <> ?", email, m.MID).Count(&cnt)
+		if cnt > 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "email already exists"})
+			return
+		}
+		updates["email"] = email
+	}
+	if in.FirstName != nil {
+		name := strings.TrimSpace(*in.FirstName)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "firstName cannot be empty"})
+			return
+		}
+		updates["first_name"] = name
+	}
+	if in.LastName != nil {
+		name := strings.TrimSpace(*in.LastName)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "lastName cannot be empty"})
+			return
+		}
+		updates["last_name"] = name
+	}
+	if in.Birthday != nil {
+		bday, err := parseBirthday(*in.Birthday)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates["birthday"] = bday
+	}
+	if in.Language != nil {
+		lang := strings.ToLower(strings.TrimSpace(*in.Language))
+		if lang != "th" && lang != "en" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "language must be th or en"})
+			return
+		}
+		updates["language"] = lang
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "no updatable fields"})
+		return
+	}
+
+	if err := db.Model(&m).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update profile: " + err.Error()})
+		return
+	}
+	db.First(&m, "m_id = ?", m.MID)
+	c.JSON(http.StatusOK, memberProfile(m))
+}
@@ -35,7 +35,7 @@ type activityInput struct {
 
 // POST /activities
 func CreateActivity(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	var input activityInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -57,7 +57,7 @@ func CreateActivity(c *gin.Context) {
 
 // GET /activities
 func GetActivities(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	var activities []entity.Activity
 	if err := db.Order("activity_name ASC").Find(&activities).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -68,7 +68,7 @@ func GetActivities(c *gin.Context) {
 
 // PUT /activities/:id
 func UpdateActivity(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	id := c.Param("id")
 
 	var input activityInput
@@ -96,7 +96,7 @@ func UpdateActivity(c *gin.Context) {
 
 // DELETE /activities/:id
 func DeleteActivity(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	id := c.Param("id")
 
 	// Safety check: prevent deletion if activity is in use by a schedule
@@ -122,7 +122,7 @@ func DeleteActivity(c *gin.Context) {
 
 // GET /schedules
 func GetActivitySchedules(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	var schedules []entity.ActivitySchedule
 	if err := db.
 		Preload("Activity").
@@ -138,7 +138,7 @@ func GetActivitySchedules(c *gin.Context) {
 
 // POST /schedules
 func CreateActivitySchedule(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	var input activityScheduleInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -207,7 +207,7 @@ func CreateActivitySchedule(c *gin.Context) {
 
 // PUT /schedules/:id
 func UpdateActivitySchedule(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	id := c.Param("id")
 	var input activityScheduleInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -282,7 +282,7 @@ func UpdateActivitySchedule(c *gin.Context) {
 
 // DELETE /schedules/:id
 func DeleteActivitySchedule(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	id := c.Param("id")
 
 	err := db.Transaction(func(tx *gorm.DB) error {
@@ -328,7 +328,7 @@ type enrollmentInput struct {
 
 // POST /enrollments
 func EnrollParticipant(c *gin.Context) {
-  db := configs.DB()
+  db := configs.DB().WithContext(c)
 
   var input enrollmentInput
   if err := c.ShouldBindJSON(&input); err != nil {
@@ -346,6 +346,16 @@ func EnrollParticipant(c *gin.Context) {
       return err // ไม่พบ Prisoner
     }
 
+    // ระหว่างปิดควบคุมพิเศษ ห้ามลงทะเบียนกิจกรรม
+    lockdown, err := activeLockdownForPrisoner(tx, p.Prisoner_ID, 0)
+    if err != nil {
+      return err
+    }
+    if lockdown != nil {
+      c.JSON(http.StatusConflict, gin.H{"error": lockdownMessage(tx, lockdown)})
+      return nil // c.JSON ถูกเรียกไปแล้ว
+    }
+
     // ---  ---
     var currentEnrollmentCount int64
     // นับจำนวนผู้ที่ลงทะเบียนใน schedule นี้ และมี status = 1 (เข้าร่วม)
@@ -407,7 +417,7 @@ type statusUpdateInput struct {
 
 // PUT /enrollments/:id/status
 func UpdateEnrollmentStatus(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	id := c.Param("id")
 
 	var input statusUpdateInput
@@ -421,6 +431,21 @@ func UpdateEnrollmentStatus(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "ไม่พบทะเบียนเข้าร่วม"})
 		return
 	}
+	if input.Status == enrollmentJoined && enrollment.Status != enrollmentJoined {
+		lockdown, err := activeLockdownForPrisoner(db, enrollment.Prisoner_ID, 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if lockdown != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": lockdownMessage(db, lockdown)})
+			return
+		}
+	}
+	// เปลี่ยนออกจากสถานะระงับเอง = ไม่ผูกกับ lockdown แล้ว (แก้แค่หมายเหตุยังคงผูกไว้ให้ EndLockdown คืนสถานะ)
+	if enrollment.Status == enrollmentSuspended && input.Status != enrollmentSuspended {
+		enrollment.Lockdown_ID = nil
+	}
 	enrollment.Status = input.Status
 	enrollment.Remarks = input.Remarks
 
@@ -433,7 +458,7 @@ func UpdateEnrollmentStatus(c *gin.Context) {
 
 // DELETE /enrollments/:id
 func DeleteEnrollment(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	id := c.Param("id")
 
 	if err := db.Delete(&entity.Enrollment{}, id).Error; err != nil {
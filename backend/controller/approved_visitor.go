@@ -0,0 +1,349 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+var (
+	errVisitorNotApproved = errors.New("ผู้เยี่ยมยังไม่ได้รับอนุมัติให้เยี่ยมผู้ต้องขังรายนี้ กรุณายื่นคำขอเพิ่มชื่อในรายชื่อผู้มีสิทธิ์เยี่ยม")
+	errVisitorDecided     = errors.New("คำขอนี้ได้รับการพิจารณาไปแล้ว")
+)
+
+type VisitorApplicationInput struct {
+	Inmate_ID       uint   `json:"Inmate_ID" binding:"required"`
+	Relationship_ID *uint  `json:"Relationship_ID"`
+	Note            string `json:"Note"`
+}
+
+type ApprovedVisitorInput struct {
+	Inmate_ID        uint    `json:"Inmate_ID" binding:"required"`
+	Relationship_ID  *uint   `json:"Relationship_ID"`
+	VisitorCitizenID string  `json:"VisitorCitizenID" binding:"required"`
+	VisitorFirstName string  `json:"VisitorFirstName"`
+	VisitorLastName  string  `json:"VisitorLastName"`
+	ExpiresAt        *string `json:"ExpiresAt"` // YYYY-MM-DD
+	Note             string  `json:"Note"`
+}
+
+type ApprovalDecisionInput struct {
+	ExpiresAt *string `json:"ExpiresAt"` // YYYY-MM-DD, ใช้ตอนอนุมัติ
+	Note      string  `json:"Note"`
+}
+
+// -------- Helpers --------
+
+// ensureApprovedVisitor ตรวจว่าผู้เยี่ยมอยู่ในรายชื่อที่อนุมัติแล้วของผู้ต้องขัง และยังไม่หมดอายุ ณ วันเยี่ยม
+func ensureApprovedVisitor(tx *gorm.DB, prisonerID, visitorID uint, visitDate time.Time) error {
+	var count int64
+	if err := tx.Model(&entity.ApprovedVisitor{}).
+		Where("prisoner_id = ? AND visitor_id = ? AND status_id = ?", prisonerID, visitorID, statusApproved).
+		Where("expires_at IS NULL OR expires_at >= ?", visitDate).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errVisitorNotApproved
+	}
+	return nil
+}
+
+// findOrCreateVisitor หา Visitor จากเลขบัตรประชาชน (สร้างใหม่ถ้ายังไม่มี)
+func findOrCreateVisitor(tx *gorm.DB, citizenID, firstName, lastName string) (entity.Visitor, error) {
+	var visitor entity.Visitor
+	err := tx.Where(entity.Visitor{Citizen_ID: citizenID}).
+		FirstOrCreate(&visitor, entity.Visitor{Citizen_ID: citizenID, FirstName: firstName, LastName: lastName}).Error
+	return visitor, err
+}
+
+func preloadApprovedVisitor(db *gorm.DB) *gorm.DB {
+	return db.Preload("Prisoner").Preload("Visitor").Preload("Relationship").Preload("Status").Preload("ApprovedBy")
+}
+
+// -------- Handlers (ญาติ) --------
+
+// POST /api/visitor-applications  ญาติยื่นขอเพิ่มชื่อตัวเองในรายชื่อผู้มีสิทธิ์เยี่ยม
+func ApplyApprovedVisitor(c *gin.Context) {
+	var input VisitorApplicationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	mid := midFromContext(c)
+	db := configs.DB().WithContext(c)
+
+	var member entity.Member
+	if mid == nil || db.First(&member, "m_id = ?", *mid).Error != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var prisoner entity.Prisoner
+	if err := db.First(&prisoner, input.Inmate_ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prisoner not found"})
+		return
+	}
+
+	var entry entity.ApprovedVisitor
+	status := http.StatusCreated
+	err := db.Transaction(func(tx *gorm.DB) error {
+		visitor, err := findOrCreateVisitor(tx, member.CitizenID, member.FirstName, member.LastName)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("prisoner_id = ? AND visitor_id = ?", prisoner.Prisoner_ID, visitor.ID).First(&entry).Error
+		if err == nil {
+			expired := entry.ExpiresAt != nil && entry.ExpiresAt.Before(time.Now())
+			if entry.Status_ID == statusPending || (entry.Status_ID == statusApproved && !expired) {
+				status = http.StatusConflict
+				return errors.New("มีคำขอหรือสิทธิ์เยี่ยมผู้ต้องขังรายนี้อยู่แล้ว")
+			}
+			// เคยถูกปฏิเสธหรือสิทธิ์หมดอายุ -> ยื่นใหม่
+			status = http.StatusOK
+			return tx.Model(&entry).Updates(map[string]interface{}{
+				"status_id":        statusPending,
+				"relationship_id":  input.Relationship_ID,
+				"note":             input.Note,
+				"applied_by_m_id":  *mid,
+				"approved_by_m_id": nil,
+				"approved_at":      nil,
+				"expires_at":       nil,
+			}).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		entry = entity.ApprovedVisitor{
+			Prisoner_ID:     prisoner.Prisoner_ID,
+			Visitor_ID:      visitor.ID,
+			Relationship_ID: input.Relationship_ID,
+			Status_ID:       statusPending,
+			Note:            input.Note,
+			AppliedByMID:    mid,
+		}
+		return tx.Create(&entry).Error
+	})
+	if err != nil {
+		if status == http.StatusConflict {
+			c.JSON(status, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to submit application: " + err.Error()})
+		return
+	}
+
+	preloadApprovedVisitor(configs.DB()).First(&entry, entry.ID)
+	c.JSON(status, entry)
+}
+
+// GET /api/visitor-applications/mine  คำขอ/สิทธิ์เยี่ยมของผู้ใช้ที่ login อยู่
+func GetMyVisitorApplications(c *gin.Context) {
+	citizenID, _ := c.Get("citizenId")
+	cid, _ := citizenID.(string)
+
+	var items []entity.ApprovedVisitor
+	if cid == "" {
+		c.JSON(http.StatusOK, items)
+		return
+	}
+	if err := preloadApprovedVisitor(configs.DB()).
+		Joins("JOIN visitors ON visitors.id = approved_visitors.visitor_id").
+		Where("visitors.citizen_id = ?", cid).
+		Order("approved_visitors.id desc").
+		Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch applications"})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// -------- Handlers (เจ้าหน้าที่) --------
+
+// GET /api/approved-visitors?prisoner_id=&status_id=
+func GetApprovedVisitors(c *gin.Context) {
+	q := preloadApprovedVisitor(configs.DB()).Order("id desc")
+	if v := c.Query("prisoner_id"); v != "" {
+		q = q.Where("prisoner_id = ?", v)
+	}
+	if v := c.Query("status_id"); v != "" {
+		q = q.Where("status_id = ?", v)
+	}
+
+	var items []entity.ApprovedVisitor
+	if err := q.Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch approved visitors"})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// POST /api/approved-visitors  เจ้าหน้าที่เพิ่มผู้เยี่ยมเข้ารายชื่อโดยตรง (อนุมัติทันที)
+func CreateApprovedVisitor(c *gin.Context) {
+	var input ApprovedVisitorInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	input.VisitorCitizenID = strings.TrimSpace(input.VisitorCitizenID)
+	expiresAt, err := parseISODatePtr(input.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ExpiresAt format, use YYYY-MM-DD"})
+		return
+	}
+
+	db := configs.DB().WithContext(c)
+	var prisoner entity.Prisoner
+	if err := db.First(&prisoner, input.Inmate_ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prisoner not found"})
+		return
+	}
+
+	mid := midFromContext(c)
+	now := time.Now()
+	var entry entity.ApprovedVisitor
+	err = db.Transaction(func(tx *gorm.DB) error {
+		visitor, err := findOrCreateVisitor(tx, input.VisitorCitizenID, input.VisitorFirstName, input.VisitorLastName)
+		if err != nil {
+			return err
+		}
+		err = tx.Where("prisoner_id = ? AND visitor_id = ?", prisoner.Prisoner_ID, visitor.ID).First(&entry).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		entry.Prisoner_ID = prisoner.Prisoner_ID
+		entry.Visitor_ID = visitor.ID
+		entry.Relationship_ID = input.Relationship_ID
+		entry.Status_ID = statusApproved
+		entry.ExpiresAt = expiresAt
+		entry.Note = input.Note
+		entry.ApprovedByMID = mid
+		entry.ApprovedAt = &now
+		return tx.Save(&entry).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add approved visitor: " + err.Error()})
+		return
+	}
+
+	preloadApprovedVisitor(configs.DB()).First(&entry, entry.ID)
+	c.JSON(http.StatusCreated, entry)
+}
+
+// PUT /api/approved-visitors/:id/approve  { "ExpiresAt": "2026-12-31" }
+func ApproveVisitor(c *gin.Context) {
+	decideVisitor(c, statusApproved)
+}
+
+// PUT /api/approved-visitors/:id/reject  { "Note": "..." }
+func RejectVisitor(c *gin.Context) {
+	decideVisitor(c, statusRejected)
+}
+
+func decideVisitor(c *gin.Context, statusID uint) {
+	var input ApprovalDecisionInput
+	// body เป็น optional
+	_ = c.ShouldBindJSON(&input)
+	expiresAt, err := parseISODatePtr(input.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ExpiresAt format, use YYYY-MM-DD"})
+		return
+	}
+
+	db := configs.DB().WithContext(c)
+	var entry entity.ApprovedVisitor
+	if err := db.First(&entry, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Approved visitor entry not found"})
+		return
+	}
+	// อนุมัติได้เฉพาะคำขอที่รอพิจารณา; ปฏิเสธได้ทั้งคำขอที่รอ และสิทธิ์ที่อนุมัติไปแล้ว (ถอนสิทธิ์)
+	if entry.Status_ID != statusPending && !(statusID == statusRejected && entry.Status_ID == statusApproved) {
+		c.JSON(http.StatusConflict, gin.H{"error": errVisitorDecided.Error()})
+		return
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC) // visit_date เก็บเป็นเที่ยงคืน UTC
+	updates := map[string]interface{}{
+		"status_id":        statusID,
+		"approved_by_m_id": midFromContext(c),
+		"approved_at":      now,
+	}
+	if input.Note != "" {
+		updates["note"] = input.Note
+	}
+	if statusID == statusApproved {
+		updates["expires_at"] = expiresAt
+	}
+	var cancelledVisits []entity.Visitation
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// เงื่อนไขสถานะเดิมกันคำสั่งพิจารณาซ้อนกันสองครั้ง
+		res := tx.Model(&entity.ApprovedVisitor{}).
+			Where("id = ? AND status_id = ?", entry.ID, entry.Status_ID).
+			Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errVisitorDecided
+		}
+		if entry.Status_ID != statusApproved {
+			return nil
+		}
+		var err error
+		cancelledVisits, err = cancelVisitorUpcomingVisitations(tx, entry.Prisoner_ID, entry.Visitor_ID, today, "ยกเลิกเนื่องจากถูกถอนสิทธิ์เยี่ยมผู้ต้องขัง")
+		return err
+	})
+	if errors.Is(err, errVisitorDecided) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update approved visitor"})
+		return
+	}
+	for _, v := range cancelledVisits {
+		logNotifyError(notifyVisitation(configs.DB(), v, NotifyVisitCancelled, v.Cancel_Reason))
+	}
+
+	preloadApprovedVisitor(configs.DB()).First(&entry, entry.ID)
+	c.JSON(http.StatusOK, entry)
+}
+
+// DELETE /api/approved-visitors/:id  ถอนชื่อออกจากรายชื่อผู้มีสิทธิ์เยี่ยม (ยกเลิกการเยี่ยมที่จองไว้และแจ้งญาติ)
+func DeleteApprovedVisitor(c *gin.Context) {
+	db := configs.DB().WithContext(c)
+	var entry entity.ApprovedVisitor
+	if err := db.First(&entry, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Approved visitor entry not found"})
+		return
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC) // visit_date เก็บเป็นเที่ยงคืน UTC
+	var cancelledVisits []entity.Visitation
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&entity.ApprovedVisitor{}, entry.ID).Error; err != nil {
+			return err
+		}
+		var err error
+		cancelledVisits, err = cancelVisitorUpcomingVisitations(tx, entry.Prisoner_ID, entry.Visitor_ID, today, "ยกเลิกเนื่องจากถูกถอนสิทธิ์เยี่ยมผู้ต้องขัง")
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete approved visitor"})
+		return
+	}
+	for _, v := range cancelledVisits {
+		logNotifyError(notifyVisitation(configs.DB(), v, NotifyVisitCancelled, v.Cancel_Reason))
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Approved visitor removed successfully"})
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+)
+
+// GET /api/audit?entity=prisoners&actor=1&record_id=5&from=2025-01-01&to=2025-01-31&limit=200
+func GetAuditLogs(c *gin.Context) {
+	query := configs.DB().
+		Preload("Actor").
+		Order("created_at desc, id desc")
+
+	if v := c.Query("entity"); v != "" {
+		query = query.Where("entity = ?", v)
+	}
+	if v := c.Query("record_id"); v != "" {
+		query = query.Where("record_id = ?", v)
+	}
+	if v := c.Query("action"); v != "" {
+		query = query.Where("action = ?", v)
+	}
+	if v := c.Query("actor"); v != "" {
+		actor, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid actor"})
+			return
+		}
+		query = query.Where("actor_m_id = ?", actor)
+	}
+	if v := c.Query("from"); v != "" {
+		from, err := parseISODate(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from (use RFC3339 or YYYY-MM-DD)"})
+			return
+		}
+		query = query.Where("created_at >= ?", from)
+	}
+	if v := c.Query("to"); v != "" {
+		to, err := parseISODate(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to (use RFC3339 or YYYY-MM-DD)"})
+			return
+		}
+		// วันที่แบบ YYYY-MM-DD ให้นับรวมทั้งวัน
+		if len(v) == len("2006-01-02") {
+			to = to.AddDate(0, 0, 1)
+		}
+		query = query.Where("created_at < ?", to)
+	}
+
+	limit := 200
+	if v := c.Query("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 1000 {
+			limit = n
+		}
+	}
+
+	var logs []entity.AuditLog
+	if err := query.Limit(limit).Find(&logs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch audit logs"})
+		return
+	}
+	c.JSON(http.StatusOK, logs)
+}
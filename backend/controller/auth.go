@@ -3,14 +3,15 @@ package controller
 import (
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/sa-project/configs"
 	"github.com/sa-project/entity"
+	"github.com/sa-project/middleware"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -25,6 +26,8 @@ type registerInput struct {
 	Birthday  string `json:"birthday"  binding:"required"`
 	// ⭐️ เพิ่ม CitizenID เข้ามาใน struct สำหรับ Register
 	CitizenID string `json:"citizenId" binding:"required"`
+	// ภาษาของอีเมลที่ระบบส่ง: "th" (ค่าเริ่มต้น) หรือ "en"
+	Language string `json:"language"`
 }
 
 type loginInput struct {
@@ -50,7 +53,7 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 
 	// normalize
 	in.Username = strings.TrimSpace(in.Username)
@@ -93,6 +96,14 @@ func Register(c *gin.Context) {
 		rankID = def.RankID
 	} else {
 		rankID = *in.RankID
+		// สมัครเองได้เฉพาะ rank ญาติ; rank อื่นต้องให้ผู้ที่มีสิทธิ์จัดการสมาชิกเป็นคนสร้าง
+		if rankID != middleware.RankRelative {
+			callerRank, _ := middleware.RankFromContext(c)
+			if !middleware.Can(callerRank, middleware.ResMembers, middleware.ActionCreate) {
+				middleware.Forbidden(c, middleware.ResMembers, middleware.ActionCreate)
+				return
+			}
+		}
 		var r entity.Rank
 		if err := db.Where("rank_id = ?", rankID).First(&r).Error; err != nil {
 			if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -126,6 +137,7 @@ func Register(c *gin.Context) {
 		Birthday:  bday,
 		// ⭐️ เพิ่ม CitizenID ตอนสร้าง Member
 		CitizenID: in.CitizenID,
+		Language:  emailLanguage(in.Language),
 	}
 
 	if err := db.Create(&m).Error; err != nil {
@@ -149,50 +161,81 @@ func Login(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
 		return
 	}
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 
 	var m entity.Member
 	if err := db.Where("username = ?", in.Username).First(&m).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// ตรวจ IP ด้วยแม้ไม่พบ username (กันไล่เดาชื่อผู้ใช้)
+			if denied, err := checkLoginAllowed(db, c.ClientIP(), nil); err == nil && denied != nil {
+				recordLoginAttempt(db, c, nil, in.Username, denied.result)
+				abortLogin(c, denied)
+				return
+			}
+			bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(in.Password))
+			recordLoginAttempt(db, c, nil, in.Username, entity.LoginUnknownUser)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error: " + err.Error()})
+		log.Printf("login: member lookup for %s: %v", in.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed, please try again"})
+		return
+	}
+
+	// ล็อกบัญชี / หน่วงเวลา / บล็อก IP ตรวจก่อนเทียบรหัสผ่าน
+	denied, err := checkLoginAllowed(db, c.ClientIP(), &m)
+	if err != nil {
+		log.Printf("login: check login allowed for %s: %v", m.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed, please try again"})
+		return
+	}
+	if denied != nil {
+		recordLoginAttempt(db, c, &m.MID, m.Username, denied.result)
+		abortLogin(c, denied)
 		return
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(m.Password), []byte(in.Password)); err != nil {
+		registerLoginFailure(db, c, m, entity.LoginBadPassword)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid username or password"})
 		return
 	}
 
-	// ⭐️ เพิ่มข้อมูลเข้าไปใน claims ของ Token
-	claims := jwt.MapClaims{
-		"mid":       m.MID,
-		"username":  m.Username,
-		"rankId":    m.RankID,
-		"citizenId": m.CitizenID, // <-- ข้อมูลสำคัญที่ต้องเพิ่ม
-		"exp":       time.Now().Add(configs.AccessTokenTTL()).Unix(),
-		"iat":       time.Now().Unix(),
+	// rank บังคับ TOTP หรือสมาชิกเปิดใช้เอง -> ยังไม่ออก token แต่ให้ challenge ไปยืนยันที่ /auth/login/verify
+	purpose, err := mfaPurpose(db, m)
+	if err != nil {
+		log.Printf("login: mfa lookup for %s: %v", m.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed, please try again"})
+		return
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString(configs.JWTSecret())
+	if purpose != "" {
+		challenge, err := createLoginChallenge(db, m.MID, purpose)
+		if err != nil {
+			log.Printf("login: create challenge for %s: %v", m.Username, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed, please try again"})
+			return
+		}
+		recordLoginAttempt(db, c, &m.MID, m.Username, entity.LoginMFAPending)
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required":    true,
+			"mfa_method":      purpose,
+			"challenge_token": challenge,
+			"expires_in":      int(mfaChallengeTTL.Seconds()),
+		})
+		return
+	}
+
+	// ออก access token (มี citizenId/jti ใน claims) พร้อม refresh token
+	signed, _, rawRefresh, err := issueSession(db, m)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot sign token"})
+		log.Printf("login: issue session for %s: %v", m.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed, please try again"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"access_token": signed,
-		"user": gin.H{
-			"MID":       m.MID,
-			"username":  m.Username,
-			"firstName": m.FirstName,
-			"lastName":  m.LastName,
-			"rankId":    m.RankID,
-			"citizenId": m.CitizenID, // ⭐️ เพิ่มข้อมูลใน object user ที่ส่งกลับไป
-		},
-	})
+	recordLoginAttempt(db, c, &m.MID, m.Username, entity.LoginSuccess)
+
+	c.JSON(http.StatusOK, sessionResponse(m, signed, rawRefresh))
 }
 
 func Me(c *gin.Context) {
@@ -202,7 +245,7 @@ func Me(c *gin.Context) {
 		return
 	}
 	var m entity.Member
-	if err := configs.DB().First(&m, mid).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&m, mid).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
 			return
@@ -210,13 +253,132 @@ func Me(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db error: " + err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"MID":       m.MID,
-		"username":  m.Username,
-		"firstName": m.FirstName,
-		"lastName":  m.LastName,
-		"rankId":    m.RankID,
-		"citizenId": m.CitizenID, // ⭐️ เพิ่ม citizenId ใน /me ด้วย
+	c.JSON(http.StatusOK, memberProfile(m))
+}
+
+
+type refreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// POST /api/auth/refresh  { "refresh_token": "..." }
+// หมุน refresh token: ตัวเก่าถูกเพิกถอนและได้คู่ token ใหม่กลับไป
+func Refresh(c *gin.Context) {
+	var in refreshInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	var (
+		signed     string
+		rawRefresh string
+		m          entity.Member
+		status     = http.StatusUnauthorized
+		reused     bool
+	)
+	err := configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var rt entity.RefreshToken
+		if err := tx.Where("token_hash = ?", hashToken(in.RefreshToken)).First(&rt).Error; err != nil {
+			return errors.New("invalid refresh token")
+		}
+		if rt.RevokedAt != nil {
+			// token ที่ถูก rotate ไปแล้วถูกนำมาใช้ซ้ำ -> ถือว่ารั่ว ตัดทุก session ของสมาชิกนี้
+			// (คืน nil เพื่อให้การเพิกถอนถูก commit แล้วค่อยตอบ 401 ด้านล่าง)
+			if rt.ReplacedByID != nil {
+				reused = true
+				if err := revokeMemberSessions(tx, rt.MID); err != nil {
+					status = http.StatusInternalServerError
+					return err
+				}
+				return nil
+			}
+			return errors.New("refresh token revoked")
+		}
+		if time.Now().After(rt.ExpiresAt) {
+			return errors.New("refresh token expired")
+		}
+		if err := tx.First(&m, "m_id = ?", rt.MID).Error; err != nil {
+			return errors.New("member not found")
+		}
+
+		var next entity.RefreshToken
+		var err error
+		signed, next, rawRefresh, err = issueSession(tx, m)
+		if err != nil {
+			status = http.StatusInternalServerError
+			return err
+		}
+		if err := revokeRefreshToken(tx, &rt); err != nil {
+			status = http.StatusInternalServerError
+			return err
+		}
+		if err := tx.Model(&rt).Update("replaced_by_id", next.ID).Error; err != nil {
+			status = http.StatusInternalServerError
+			return err
+		}
+		return nil
 	})
+	if err != nil && status == http.StatusInternalServerError {
+		log.Printf("refresh: %v", err)
+		c.JSON(status, gin.H{"error": "refresh failed, please try again"})
+		return
+	}
+	if err != nil {
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if reused {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "refresh token reused; all sessions revoked"})
+		return
+	}
+
+	c.JSON(http.StatusOK, sessionResponse(m, signed, rawRefresh))
 }
 
+type logoutInput struct {
+	RefreshToken string `json:"refresh_token"`
+	All          bool   `json:"all"` // true = ออกจากระบบทุกเครื่อง
+}
+
+// POST /api/auth/logout  { "refresh_token": "...", "all": false }
+// เพิกถอน access token ที่ใช้เรียกอยู่ และ refresh token ที่ส่งมา (หรือทุก session ถ้า all=true)
+func Logout(c *gin.Context) {
+	var in logoutInput
+	// body เป็น optional
+	_ = c.ShouldBindJSON(&in)
+
+	mid := midFromContext(c)
+	if mid == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	jti, _ := c.Get("jti")
+	jtiStr, _ := jti.(string)
+
+	err := configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := revokeAccessJTI(tx, *mid, jtiStr); err != nil {
+			return err
+		}
+		if in.All {
+			return revokeMemberSessions(tx, *mid)
+		}
+		if in.RefreshToken == "" {
+			return nil
+		}
+		var rt entity.RefreshToken
+		if err := tx.Where("token_hash = ? AND m_id = ?", hashToken(in.RefreshToken), *mid).
+			First(&rt).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		return revokeRefreshToken(tx, &rt)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to logout: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
@@ -0,0 +1,297 @@
+package controller
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+// template อีเมลที่ระบบส่ง
+const (
+	EmailVisitConfirmed  = "visit_confirmed"
+	EmailPetitionOutcome = "petition_outcome"
+	EmailPasswordReset   = "password_reset"
+)
+
+const (
+	emailBatchSize   = 50
+	emailMaxAttempts = 10
+	emailBaseBackoff = time.Minute
+	emailMaxBackoff  = 6 * time.Hour
+)
+
+type emailTemplate struct {
+	Subject string
+	Body    string
+}
+
+// emailTemplates: template -> ภาษา ("th"/"en") -> หัวเรื่อง/เนื้อหา (text/template)
+var emailTemplates = map[string]map[string]emailTemplate{
+	EmailVisitConfirmed: {
+		"th": {
+			Subject: "ยืนยันการเยี่ยม {{.Prisoner}} วันที่ {{.Date}}",
+			Body: `เรียน คุณ{{.Name}}
+
+การจองเยี่ยม {{.Prisoner}} ได้รับการอนุมัติแล้ว
+วันที่: {{.Date}}
+เวลา: {{.Time}}{{if .Area}}
+ห้องเยี่ยม: {{.Area}}{{end}}
+
+กรุณามาถึงก่อนเวลาอย่างน้อย 15 นาที และนำบัตรประชาชนตัวจริงมาแสดงที่จุดตรวจ
+
+ระบบบริหารจัดการเรือนจำ`,
+		},
+		"en": {
+			Subject: "Visit confirmed: {{.Prisoner}} on {{.Date}}",
+			Body: `Dear {{.Name}},
+
+Your visit to {{.Prisoner}} has been approved.
+Date: {{.Date}}
+Time: {{.Time}}{{if .Area}}
+Visiting room: {{.Area}}{{end}}
+
+Please arrive at least 15 minutes early and bring your national ID card to the checkpoint.
+
+Prison Management System`,
+		},
+	},
+	EmailPetitionOutcome: {
+		"th": {
+			Subject: "ผลการพิจารณาคำร้องหมายเลข {{.ID}}: {{.StatusTH}}",
+			Body: `เรียน คุณ{{.Name}}
+
+คำร้องหมายเลข {{.ID}} ของผู้ต้องขัง {{.Prisoner}}
+"{{.Detail}}"
+ผลการพิจารณา: {{.StatusTH}}
+
+ระบบบริหารจัดการเรือนจำ`,
+		},
+		"en": {
+			Subject: "Petition #{{.ID}} outcome: {{.StatusEN}}",
+			Body: `Dear {{.Name}},
+
+Petition #{{.ID}} for inmate {{.Prisoner}}
+"{{.Detail}}"
+Outcome: {{.StatusEN}}
+
+Prison Management System`,
+		},
+	},
+	EmailPasswordReset: {
+		"th": {
+			Subject: "รีเซ็ตรหัสผ่านบัญชี {{.Username}}",
+			Body: `เรียน คุณ{{.Name}}
+
+มีการขอรีเซ็ตรหัสผ่านสำหรับบัญชี {{.Username}}
+รหัสสำหรับรีเซ็ต: {{.Token}}{{if .Link}}
+หรือเปิดลิงก์: {{.Link}}{{end}}
+
+รหัสนี้ใช้ได้ครั้งเดียวภายใน {{.ExpiresIn}} หากคุณไม่ได้ขอรีเซ็ตรหัสผ่าน ไม่ต้องดำเนินการใด ๆ
+
+ระบบบริหารจัดการเรือนจำ`,
+		},
+		"en": {
+			Subject: "Password reset for {{.Username}}",
+			Body: `Dear {{.Name}},
+
+A password reset was requested for the account {{.Username}}.
+Reset code: {{.Token}}{{if .Link}}
+Or open: {{.Link}}{{end}}
+
+The code can be used once within {{.ExpiresIn}}. If you did not request this, you can ignore this email.
+
+Prison Management System`,
+		},
+	},
+}
+
+// ชื่อสถานะภาษาอังกฤษสำหรับอีเมล (ตาราง statuses เก็บเฉพาะภาษาไทย)
+var statusNamesEN = map[uint]string{
+	statusPending:   "Pending",
+	statusApproved:  "Approved",
+	statusRejected:  "Rejected",
+	statusCompleted: "Completed",
+	statusExpired:   "Expired",
+	statusCancelled: "Cancelled",
+	statusNoShow:    "No-show",
+}
+
+func emailLanguage(lang string) string {
+	if strings.EqualFold(strings.TrimSpace(lang), "en") {
+		return "en"
+	}
+	return "th"
+}
+
+func renderEmail(name, lang string, data any) (string, string, error) {
+	tmpl, ok := emailTemplates[name][lang]
+	if !ok {
+		return "", "", fmt.Errorf("email template %s/%s not found", name, lang)
+	}
+	render := func(part, text string) (string, error) {
+		t, err := template.New(name + "." + part).Option("missingkey=zero").Parse(text)
+		if err != nil {
+			return "", err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return "", err
+		}
+		return buf.String(), nil
+	}
+	subject, err := render("subject", tmpl.Subject)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := render("body", tmpl.Body)
+	return subject, body, err
+}
+
+// queueEmail render template แล้วเก็บลง outbox ให้ job deliver-email-outbox ส่ง (ไม่มีอีเมลปลายทาง = ข้าม)
+func queueEmail(tx *gorm.DB, to, lang, name string, data any) error {
+	to = strings.TrimSpace(to)
+	if to == "" {
+		return nil
+	}
+	lang = emailLanguage(lang)
+	subject, body, err := renderEmail(name, lang, data)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&entity.EmailOutbox{
+		To:            to,
+		Template:      name,
+		Language:      lang,
+		Subject:       subject,
+		Body:          body,
+		Status:        entity.EmailPending,
+		NextAttemptAt: time.Now(),
+	}).Error
+}
+
+// emailBackoff ระยะรอก่อนส่งครั้งถัดไป: 1, 2, 4, ... นาที (ไม่เกิน 6 ชั่วโมง)
+func emailBackoff(attempts int) time.Duration {
+	d := emailBaseBackoff
+	for i := 1; i < attempts && d < emailMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > emailMaxBackoff {
+		d = emailMaxBackoff
+	}
+	return d
+}
+
+// visitationEmailData ข้อมูลสำหรับ template visit_confirmed
+func visitationEmailData(tx *gorm.DB, v entity.Visitation, name string) map[string]any {
+	data := map[string]any{"Name": name, "Date": v.Visit_Date.Format("2006-01-02")}
+	if v.Inmate_ID != nil {
+		var p entity.Prisoner
+		if tx.Select("first_name", "last_name").First(&p, *v.Inmate_ID).Error == nil {
+			data["Prisoner"] = p.FirstName + " " + p.LastName
+		}
+	}
+	if v.TimeSlot_ID != nil {
+		var slot entity.TimeSlot
+		if tx.First(&slot, *v.TimeSlot_ID).Error == nil {
+			data["Time"] = slot.Start_Time + " - " + slot.End_Time
+		}
+	}
+	if v.VisitingArea_ID != nil {
+		var area entity.VisitingArea
+		if tx.First(&area, *v.VisitingArea_ID).Error == nil {
+			data["Area"] = area.Area_Name
+		}
+	}
+	return data
+}
+
+// -------- Handlers --------
+
+// GET /api/email-outbox?status=failed
+func GetEmailOutbox(c *gin.Context) {
+	q := configs.DB().Order("id desc").Limit(200)
+	if status := c.Query("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	var items []entity.EmailOutbox
+	if err := q.Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch email outbox"})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// POST /api/email-outbox/:id/retry  ส่งอีเมลที่ล้มเหลวใหม่ (เริ่มนับจำนวนครั้งใหม่)
+func RetryEmail(c *gin.Context) {
+	db := configs.DB().WithContext(c)
+	var item entity.EmailOutbox
+	if err := db.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Email not found"})
+		return
+	}
+	if item.Status == entity.EmailSent {
+		c.JSON(http.StatusConflict, gin.H{"error": "อีเมลนี้ส่งสำเร็จแล้ว"})
+		return
+	}
+	if err := db.Model(&item).Updates(map[string]interface{}{
+		"status":          entity.EmailPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retry email"})
+		return
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+func init() {
+	RegisterJob(&Job{
+		Name:        "deliver-email-outbox",
+		Description: "ส่งอีเมลที่อยู่ในคิว และส่งใหม่แบบเว้นระยะเมื่อ mail server ล่ม",
+		Interval:    time.Minute,
+		Run:         deliverEmailOutbox,
+	})
+}
+
+func deliverEmailOutbox(db *gorm.DB) (int, string, error) {
+	now := time.Now()
+	var due []entity.EmailOutbox
+	if err := db.Where("status = ? AND next_attempt_at <= ?", entity.EmailPending, now).
+		Order("id").Limit(emailBatchSize).Find(&due).Error; err != nil {
+		return 0, "", err
+	}
+
+	sender := configs.Mailer()
+	sent, failed := 0, 0
+	for _, m := range due {
+		attempts := m.Attempts + 1
+		updates := map[string]interface{}{"attempts": attempts}
+		if err := configs.SendMail(sender, m.To, m.Template, m.Subject, m.Body); err != nil {
+			failed++
+			updates["last_error"] = err.Error()
+			if attempts >= emailMaxAttempts {
+				updates["status"] = entity.EmailFailed
+			} else {
+				updates["next_attempt_at"] = time.Now().Add(emailBackoff(attempts))
+			}
+		} else {
+			sent++
+			updates["status"] = entity.EmailSent
+			updates["sent_at"] = time.Now()
+			updates["last_error"] = ""
+			updates["body"] = "" // ไม่เก็บเนื้อหา (อาจมีรหัสลับ) หลังส่งแล้ว
+		}
+		if err := db.Model(&entity.EmailOutbox{}).Where("id = ?", m.ID).Updates(updates).Error; err != nil {
+			return sent, "", err
+		}
+	}
+	return sent, fmt.Sprintf("ส่งอีเมลสำเร็จ %d ฉบับ, ไม่สำเร็จ %d ฉบับ", sent, failed), nil
+}
@@ -20,7 +20,7 @@ type evaluationInput struct {
 
 // GET /scores/:id   (id = Prisoner_ID)
 func GetScoreByPrisoner(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 
 	id := c.Param("id")
 	var scoreBehavior entity.ScoreBehavior
@@ -35,7 +35,7 @@ func GetScoreByPrisoner(c *gin.Context) {
 
 // POST /evaluations
 func CreateEvaluation(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 
 	var input evaluationInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -50,6 +50,10 @@ func CreateEvaluation(c *gin.Context) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "ไม่พบข้อมูลคะแนนสำหรับผู้ต้องขังรายนี้"})
 			return nil
 		}
+		if err := ensureScoreNotFrozen(sb); err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return nil
+		}
 
 		// 2) ยืนยันว่ามี BehaviorCriterion (BID) และ Member (MID) จริง
 		var bc entity.BehaviorCriterion
@@ -101,7 +105,7 @@ func CreateEvaluation(c *gin.Context) {
 
 // PUT /evaluations/:id
 func UpdateEvaluation(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	id := c.Param("id")
 
 	var input evaluationInput
@@ -136,6 +140,14 @@ func UpdateEvaluation(c *gin.Context) {
 			}
 			ev.SID = sb.SID
 		}
+		// ห้ามแก้การประเมินของผู้ต้องขังที่ปล่อยตัวแล้ว
+		var target entity.ScoreBehavior
+		if err := tx.First(&target, ev.SID).Error; err == nil {
+			if err := ensureScoreNotFrozen(target); err != nil {
+				c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+				return nil
+			}
+		}
 
 		ev.BID = input.BID
 		ev.MID = input.MID
@@ -169,7 +181,7 @@ func UpdateEvaluation(c *gin.Context) {
 
 // GET /evaluations
 func GetEvaluations(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 
 	var evaluations []entity.BehaviorEvaluation
 	if err := db.
@@ -186,7 +198,7 @@ func GetEvaluations(c *gin.Context) {
 
 // DELETE /evaluations/:id
 func DeleteEvaluation(c *gin.Context) {
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	id := c.Param("id")
 
 	if err := db.Transaction(func(tx *gorm.DB) error {
@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"github.com/sa-project/middleware"
+)
+
+// ตาราง -> resource ใน policy ที่ผู้รับต้องมีสิทธิ์ read ถึงจะเห็น event
+var eventResources = map[string]string{
+	"prisoners":   middleware.ResPrisoners,
+	"rooms":       middleware.ResRooms,
+	"visitations": middleware.ResVisitations,
+	"requestings": middleware.ResRequestings,
+	"parcels":     middleware.ResParcels,
+}
+
+// ส่ง comment ว่างเป็นระยะ กัน proxy ตัดการเชื่อมต่อที่เงียบนานเกินไป
+const eventHeartbeat = 25 * time.Second
+
+// eventFilter ตัดสินว่าผู้รับคนนี้ควรเห็น event ไหน (ตามสิทธิ์ของ rank เหมือน GET ของ resource นั้น)
+type eventFilter struct {
+	rank      int
+	citizenID string
+	visitorID uint
+}
+
+func (f *eventFilter) allow(ev configs.ChangeEvent) bool {
+	res, ok := eventResources[ev.Entity]
+	if !ok || !middleware.Can(f.rank, res, middleware.ActionRead) {
+		return false
+	}
+	// ญาติเห็นเฉพาะการเยี่ยมของตัวเอง เหมือน GetVisitations
+	if f.rank == middleware.RankRelative && ev.Entity == "visitations" {
+		visitorID, _ := ev.Data["Visitor_ID"].(*uint)
+		if visitorID == nil {
+			return false
+		}
+		if f.visitorID == 0 {
+			// ผู้เยี่ยมอาจถูกสร้างหลังเปิด stream (จองเยี่ยมครั้งแรก) จึงหาใหม่เมื่อยังไม่พบ
+			var visitor entity.Visitor
+			if err := configs.DB().Select("id").Where("citizen_id = ?", f.citizenID).First(&visitor).Error; err != nil {
+				return false
+			}
+			f.visitorID = visitor.ID
+		}
+		return *visitorID == f.visitorID
+	}
+	return true
+}
+
+// GET /api/events  Server-Sent Events: ข้อมูลผู้ต้องขัง/ห้อง/การเยี่ยม/คำขอเบิก/พัสดุ เปลี่ยน
+// browser ใช้ new EventSource("/api/events?access_token=...") เพราะตั้ง header Authorization ไม่ได้
+func StreamEvents(c *gin.Context) {
+	rank, ok := middleware.RankFromContext(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	filter := &eventFilter{rank: rank, citizenID: c.GetString("citizenId")}
+
+	events, cancel := configs.SubscribeChanges()
+	defer cancel()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("ready", gin.H{"rank": rank})
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case ev, ok := <-events:
+			if !ok {
+				return false
+			}
+			if filter.allow(ev) {
+				c.SSEvent(ev.Type, ev)
+			}
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		}
+	})
+}
@@ -0,0 +1,299 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+// Enrollment.Status (frontend ใช้ 1 = เข้าร่วม, 0 = สละสิทธิ์)
+const (
+	enrollmentJoined    = 1
+	enrollmentSuspended = 2 // ระงับชั่วคราวระหว่างปิดควบคุมพิเศษ
+)
+
+type LockdownInput struct {
+	Scope    string `json:"Scope" binding:"required"` // facility | room | wing
+	Room_ID  *uint  `json:"Room_ID"`
+	Building string `json:"Building"`
+	Wing     string `json:"Wing"`
+	Reason   string `json:"Reason" binding:"required"`
+}
+
+type EndLockdownInput struct {
+	Reason string `json:"Reason"`
+}
+
+// -------- Helpers --------
+
+// lockdownTarget คำอธิบายขอบเขตของการปิดควบคุมเป็นภาษาไทย
+func lockdownTarget(db *gorm.DB, l entity.Lockdown) string {
+	switch l.Scope {
+	case entity.LockdownRoom:
+		var room entity.Room
+		if l.Room_ID != nil && db.First(&room, *l.Room_ID).Error == nil {
+			return "ห้อง " + room.Room_Name
+		}
+		return "ห้องขัง"
+	case entity.LockdownWing:
+		return strings.TrimSpace(fmt.Sprintf("แดน %s %s", l.Building, l.Wing))
+	default:
+		return "ทั้งเรือนจำ"
+	}
+}
+
+// lockdownMessage ข้อความแจ้งเหตุที่ถูกปฏิเสธเพราะปิดควบคุมพิเศษ
+func lockdownMessage(db *gorm.DB, l *entity.Lockdown) string {
+	return fmt.Sprintf("ขณะนี้อยู่ระหว่างปิดควบคุมพิเศษ (%s): %s", lockdownTarget(db, *l), l.Reason)
+}
+
+// activeLockdownForRoom การปิดควบคุมที่ยังมีผลและครอบคลุมห้องนี้ (roomID = nil ตรวจเฉพาะระดับทั้งเรือนจำ)
+func activeLockdownForRoom(tx *gorm.DB, roomID *uint, excludeID uint) (*entity.Lockdown, error) {
+	var active []entity.Lockdown
+	q := tx.Where("ended_at IS NULL").Order("id asc")
+	if excludeID != 0 {
+		q = q.Where("id <> ?", excludeID)
+	}
+	if err := q.Find(&active).Error; err != nil {
+		return nil, err
+	}
+
+	var room *entity.Room
+	for i, l := range active {
+		switch l.Scope {
+		case entity.LockdownFacility:
+			return &active[i], nil
+		case entity.LockdownRoom:
+			if roomID != nil && l.Room_ID != nil && *l.Room_ID == *roomID {
+				return &active[i], nil
+			}
+		case entity.LockdownWing:
+			if roomID == nil {
+				continue
+			}
+			if room == nil {
+				room = &entity.Room{}
+				if err := tx.First(room, *roomID).Error; err != nil {
+					return nil, err
+				}
+			}
+			if room.Building == l.Building && room.Wing == l.Wing {
+				return &active[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// activeLockdownForPrisoner การปิดควบคุมที่ครอบคลุมห้องปัจจุบันของผู้ต้องขัง
+func activeLockdownForPrisoner(tx *gorm.DB, prisonerID uint, excludeID uint) (*entity.Lockdown, error) {
+	var prisoner entity.Prisoner
+	if err := tx.Select("prisoner_id", "room_id").First(&prisoner, prisonerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return activeLockdownForRoom(tx, prisoner.Room_ID, excludeID)
+}
+
+// activeLockdownForTransfer ห้ามย้ายห้องถ้าห้องต้นทางหรือปลายทางอยู่ระหว่างปิดควบคุม
+func activeLockdownForTransfer(tx *gorm.DB, fromRoomID *uint, toRoomID uint) (*entity.Lockdown, error) {
+	l, err := activeLockdownForRoom(tx, fromRoomID, 0)
+	if err != nil || l != nil {
+		return l, err
+	}
+	return activeLockdownForRoom(tx, &toRoomID, 0)
+}
+
+// lockdownPrisonerIDs ผู้ต้องขังที่ยังไม่พ้นโทษในขอบเขตของการปิดควบคุม
+func lockdownPrisonerIDs(tx *gorm.DB, l entity.Lockdown, now time.Time) ([]uint, error) {
+	q := tx.Model(&entity.Prisoner{}).Where("release_date IS NULL OR release_date > ?", now)
+	switch l.Scope {
+	case entity.LockdownRoom:
+		q = q.Where("room_id = ?", *l.Room_ID)
+	case entity.LockdownWing:
+		q = q.Where("room_id IN (?)", tx.Model(&entity.Room{}).Select("room_id").Where("building = ? AND wing = ?", l.Building, l.Wing))
+	}
+	var ids []uint
+	err := q.Pluck("prisoner_id", &ids).Error
+	return ids, err
+}
+
+// -------- Handlers --------
+
+// GET /api/lockdowns?active=true
+func GetLockdowns(c *gin.Context) {
+	q := configs.DB().Preload("StartedBy").Preload("EndedBy").Order("id desc")
+	if c.Query("active") == "true" {
+		q = q.Where("ended_at IS NULL")
+	}
+	var items []entity.Lockdown
+	if err := q.Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lockdowns"})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// POST /api/lockdowns  เริ่มปิดควบคุมพิเศษ: ยกเลิกการเยี่ยมที่จะถึง และระงับการเข้าร่วมกิจกรรมของผู้ต้องขังในขอบเขต
+func StartLockdown(c *gin.Context) {
+	var input LockdownInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format: " + err.Error()})
+		return
+	}
+	input.Reason = strings.TrimSpace(input.Reason)
+	input.Building = strings.TrimSpace(input.Building)
+	input.Wing = strings.TrimSpace(input.Wing)
+
+	db := configs.DB().WithContext(c)
+	l := entity.Lockdown{Scope: input.Scope, Reason: input.Reason}
+	switch input.Scope {
+	case entity.LockdownFacility:
+	case entity.LockdownRoom:
+		if input.Room_ID == nil || db.First(&entity.Room{}, *input.Room_ID).Error != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ไม่พบห้องขังที่ระบุ"})
+			return
+		}
+		l.Room_ID = input.Room_ID
+	case entity.LockdownWing:
+		var rooms int64
+		db.Model(&entity.Room{}).Where("building = ? AND wing = ?", input.Building, input.Wing).Count(&rooms)
+		if input.Wing == "" || rooms == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ไม่พบห้องขังในแดน/ปีกที่ระบุ"})
+			return
+		}
+		l.Building, l.Wing = input.Building, input.Wing
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Scope must be one of facility, room, wing"})
+		return
+	}
+
+	// ห้ามเปิดซ้ำขอบเขตเดิมที่ยังมีผลอยู่
+	var dup int64
+	db.Model(&entity.Lockdown{}).
+		Where("ended_at IS NULL AND scope = ? AND building = ? AND wing = ?", l.Scope, l.Building, l.Wing).
+		Where("(room_id IS NULL AND ? IS NULL) OR room_id = ?", l.Room_ID, l.Room_ID).
+		Count(&dup)
+	if dup > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "ขอบเขตนี้อยู่ระหว่างปิดควบคุมพิเศษอยู่แล้ว"})
+		return
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	l.StartedAt = now
+	l.StartedByMID = midFromContext(c)
+	var cancelledVisits []entity.Visitation
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&l).Error; err != nil {
+			return err
+		}
+		ids, err := lockdownPrisonerIDs(tx, l, now)
+		if err != nil {
+			return err
+		}
+		l.AffectedPrisoners = len(ids)
+		if len(ids) > 0 {
+			// ยกเลิกการเยี่ยมที่จะถึง พร้อมเหตุผลให้ญาติเห็น
+			cancelledVisits, err = cancelUpcomingVisitations(tx, ids, today, "ยกเลิกเนื่องจากปิดควบคุมพิเศษ: "+l.Reason)
+			if err != nil {
+				return err
+			}
+			l.CancelledVisits = len(cancelledVisits)
+
+			// ระงับการเข้าร่วมกิจกรรมที่ยังไม่จบ (คืนสถานะเมื่อยกเลิกการปิดควบคุม)
+			res := tx.Model(&entity.Enrollment{}).
+				Where("prisoner_id IN ? AND status = ?", ids, enrollmentJoined).
+				Where("schedule_id IN (?)", tx.Model(&entity.ActivitySchedule{}).Select("schedule_id").Where("end_date >= ?", today)).
+				Updates(map[string]interface{}{"status": enrollmentSuspended, "lockdown_id": l.ID})
+			if res.Error != nil {
+				return res.Error
+			}
+			l.SuspendedEnrollments = int(res.RowsAffected)
+		}
+		return tx.Model(&l).Updates(map[string]interface{}{
+			"affected_prisoners":    l.AffectedPrisoners,
+			"cancelled_visits":      l.CancelledVisits,
+			"suspended_enrollments": l.SuspendedEnrollments,
+		}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start lockdown: " + err.Error()})
+		return
+	}
+
+	// แจ้งญาติว่าการเยี่ยมถูกยกเลิก
+	for _, v := range cancelledVisits {
+		logNotifyError(notifyVisitation(configs.DB(), v, NotifyVisitCancelled, v.Cancel_Reason))
+	}
+
+	configs.DB().Preload("StartedBy").First(&l, l.ID)
+	c.JSON(http.StatusCreated, l)
+}
+
+// POST /api/lockdowns/:id/end  ยกเลิกการปิดควบคุม คืนสถานะการเข้าร่วมกิจกรรมที่ถูกระงับ
+// (การเยี่ยมที่ถูกยกเลิกไปแล้วไม่คืน ญาติต้องจองใหม่)
+func EndLockdown(c *gin.Context) {
+	var input EndLockdownInput
+	// body เป็น optional
+	_ = c.ShouldBindJSON(&input)
+
+	db := configs.DB().WithContext(c)
+	var l entity.Lockdown
+	if err := db.First(&l, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lockdown not found"})
+		return
+	}
+	if l.EndedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "การปิดควบคุมนี้สิ้นสุดไปแล้ว"})
+		return
+	}
+
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&l).Updates(map[string]interface{}{
+			"ended_at":      now,
+			"ended_by_m_id": midFromContext(c),
+			"end_reason":    strings.TrimSpace(input.Reason),
+		}).Error; err != nil {
+			return err
+		}
+
+		var suspended []entity.Enrollment
+		if err := tx.Where("lockdown_id = ? AND status = ?", l.ID, enrollmentSuspended).Find(&suspended).Error; err != nil {
+			return err
+		}
+		for _, e := range suspended {
+			// ยังมีการปิดควบคุมอื่นครอบคลุมอยู่ -> ระงับต่อภายใต้การปิดควบคุมนั้น
+			other, err := activeLockdownForPrisoner(tx, e.Prisoner_ID, l.ID)
+			if err != nil {
+				return err
+			}
+			updates := map[string]interface{}{"status": enrollmentJoined, "lockdown_id": nil}
+			if other != nil {
+				updates = map[string]interface{}{"lockdown_id": other.ID}
+			}
+			if err := tx.Model(&entity.Enrollment{}).Where("enrollment_id = ?", e.Enrollment_ID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end lockdown: " + err.Error()})
+		return
+	}
+
+	configs.DB().Preload("StartedBy").Preload("EndedBy").First(&l, l.ID)
+	c.JSON(http.StatusOK, l)
+}
@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// นโยบายกัน brute-force ตอน login
+const (
+	loginWindow        = 15 * time.Minute // นับครั้งที่ผิดย้อนหลังภายในช่วงนี้
+	loginFreeFailures  = 3                // ผิดได้กี่ครั้งก่อนเริ่มหน่วงเวลา
+	loginMaxDelay      = time.Minute      // หน่วงนานสุดต่อครั้ง (1, 2, 4, ... วินาที)
+	loginLockThreshold = 5                // ผิดติดกันครบเท่านี้ -> ล็อกบัญชี
+	loginLockDuration  = 15 * time.Minute
+	loginIPMaxFailures = 20 // IP เดียวผิดเกินเท่านี้ในช่วง loginWindow -> บล็อก IP
+)
+
+// dummyPasswordHash ใช้ตรวจรหัสเมื่อไม่พบ username ให้เวลาตอบใกล้เคียงกัน (เดาชื่อผู้ใช้จากเวลาไม่ได้)
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+// loginDenied เหตุที่ปฏิเสธคำขอ login ก่อนตรวจรหัสผ่าน (nil = ให้ลองได้)
+type loginDenied struct {
+	status     int
+	result     string
+	message    string
+	retryAfter time.Duration
+}
+
+func recordLoginAttempt(db *gorm.DB, c *gin.Context, mid *int, username, result string) {
+	ua := c.Request.UserAgent()
+	if len(ua) > 255 {
+		ua = ua[:255]
+	}
+	db.Create(&entity.LoginAttempt{
+		MID:       mid,
+		Username:  username,
+		IP:        c.ClientIP(),
+		UserAgent: ua,
+		Success:   result == entity.LoginSuccess,
+		Result:    result,
+	})
+}
+
+// loginFailureResults ผลที่นับเป็นการใส่รหัสผิดของสมาชิก
+var loginFailureResults = []string{entity.LoginBadPassword, entity.LoginBadTOTP}
+
+// recentFailures ครั้งที่ใส่รหัสผิด (รหัสผ่านหรือ TOTP) ของสมาชิก นับหลัง login สำเร็จ/ปลดล็อกครั้งล่าสุด และภายใน loginWindow
+func recentFailures(db *gorm.DB, mid int, now time.Time) (int64, time.Time, error) {
+	since := now.Add(-loginWindow)
+	var reset entity.LoginAttempt
+	err := db.Where("m_id = ? AND result IN ? AND created_at > ?", mid, []string{entity.LoginSuccess, entity.LoginUnlocked}, since).
+		Order("created_at desc").Limit(1).Find(&reset).Error
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	if reset.ID != 0 {
+		since = reset.CreatedAt
+	}
+
+	var count int64
+	if err := db.Model(&entity.LoginAttempt{}).
+		Where("m_id = ? AND result IN ? AND created_at > ?", mid, loginFailureResults, since).
+		Count(&count).Error; err != nil || count == 0 {
+		return 0, time.Time{}, err
+	}
+	var last entity.LoginAttempt
+	if err := db.Where("m_id = ? AND result IN ?", mid, loginFailureResults).
+		Order("created_at desc").Limit(1).Find(&last).Error; err != nil {
+		return 0, time.Time{}, err
+	}
+	return count, last.CreatedAt, nil
+}
+
+// loginDelay ระยะที่ต้องรอหลังผิดครั้งที่ n: ไม่หน่วงใน loginFreeFailures ครั้งแรก แล้วเพิ่มเป็นเท่าตัว
+func loginDelay(failures int64) time.Duration {
+	if failures < loginFreeFailures {
+		return 0
+	}
+	d := time.Second << uint(failures-loginFreeFailures)
+	if d <= 0 || d > loginMaxDelay {
+		return loginMaxDelay
+	}
+	return d
+}
+
+// checkLoginAllowed ตรวจ IP, การล็อกบัญชี และการหน่วงเวลา ก่อนตรวจรหัสผ่าน (m = nil คือไม่พบ username)
+func checkLoginAllowed(db *gorm.DB, ip string, m *entity.Member) (*loginDenied, error) {
+	now := time.Now()
+
+	var ipFailures int64
+	var oldest entity.LoginAttempt
+	q := db.Model(&entity.LoginAttempt{}).
+		Where("ip = ? AND result IN ? AND created_at > ?", ip, []string{entity.LoginBadPassword, entity.LoginUnknownUser}, now.Add(-loginWindow))
+	if err := q.Count(&ipFailures).Error; err != nil {
+		return nil, err
+	}
+	if ipFailures >= loginIPMaxFailures {
+		db.Where("ip = ? AND result IN ? AND created_at > ?", ip, []string{entity.LoginBadPassword, entity.LoginUnknownUser}, now.Add(-loginWindow)).
+			Order("created_at").Limit(1).Find(&oldest)
+		return &loginDenied{
+			status:     http.StatusTooManyRequests,
+			result:     entity.LoginIPBlocked,
+			message:    "too many failed login attempts from this address, try again later",
+			retryAfter: oldest.CreatedAt.Add(loginWindow).Sub(now),
+		}, nil
+	}
+
+	if m == nil {
+		return nil, nil
+	}
+	if m.LockedUntil != nil && now.Before(*m.LockedUntil) {
+		return &loginDenied{
+			status:     http.StatusLocked,
+			result:     entity.LoginLocked,
+			message:    "account is temporarily locked after repeated failed logins",
+			retryAfter: m.LockedUntil.Sub(now),
+		}, nil
+	}
+
+	failures, last, err := recentFailures(db, m.MID, now)
+	if err != nil {
+		return nil, err
+	}
+	if wait := last.Add(loginDelay(failures)).Sub(now); failures > 0 && wait > 0 {
+		return &loginDenied{
+			status:     http.StatusTooManyRequests,
+			result:     entity.LoginThrottled,
+			message:    "too many failed login attempts, wait before trying again",
+			retryAfter: wait,
+		}, nil
+	}
+	return nil, nil
+}
+
+// registerLoginFailure บันทึกการใส่รหัสผิด (result = LoginBadPassword/LoginBadTOTP)
+// และล็อกบัญชีเมื่อผิดติดกันครบ loginLockThreshold ครั้ง
+func registerLoginFailure(db *gorm.DB, c *gin.Context, m entity.Member, result string) {
+	recordLoginAttempt(db, c, &m.MID, m.Username, result)
+
+	now := time.Now()
+	failures, _, err := recentFailures(db, m.MID, now)
+	if err != nil || failures < loginLockThreshold {
+		return
+	}
+	until := now.Add(loginLockDuration)
+	if err := db.Model(&entity.Member{}).Where("m_id = ?", m.MID).Update("locked_until", until).Error; err != nil {
+		return
+	}
+	logNotifyError(notifyRanks(db, []int{1}, NotifyAccountLocked,
+		"บัญชีถูกล็อก: "+m.Username,
+		fmt.Sprintf("บัญชี %s ใส่รหัสผ่าน/รหัสยืนยันผิด %d ครั้ง (IP ล่าสุด %s) ถูกล็อกถึง %s",
+			m.Username, failures, c.ClientIP(), until.Format("2006-01-02 15:04")),
+		"member", uint(m.MID)))
+}
+
+// abortLogin ตอบคำขอที่ถูกปฏิเสธพร้อม Retry-After (วินาที)
+func abortLogin(c *gin.Context, d *loginDenied) {
+	secs := int(math.Ceil(d.retryAfter.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(secs))
+	c.JSON(d.status, gin.H{"error": d.message, "retry_after": secs})
+}
+
+// -------- Handlers --------
+
+// POST /api/members/:id/unlock  แอดมินปลดล็อกบัญชีและเริ่มนับครั้งที่ผิดใหม่
+func UnlockMember(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid member id"})
+		return
+	}
+	db := configs.DB().WithContext(c)
+	var m entity.Member
+	if err := db.First(&m, "m_id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+		return
+	}
+	if err := db.Model(&m).Update("locked_until", nil).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to unlock member"})
+		return
+	}
+	recordLoginAttempt(db, c, &m.MID, m.Username, entity.LoginUnlocked)
+
+	db.Preload("Rank").First(&m, "m_id = ?", id)
+	c.JSON(http.StatusOK, m)
+}
+
+// GET /api/members/:id/logins?limit=100  ประวัติการ login ของสมาชิก (ใหม่สุดก่อน)
+func GetMemberLogins(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid member id"})
+		return
+	}
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		limit = n
+	}
+
+	var items []entity.LoginAttempt
+	if err := configs.DB().Where("m_id = ?", id).Order("id desc").Limit(limit).Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch login history"})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
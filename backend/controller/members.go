@@ -7,11 +7,12 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sa-project/configs"
 	"github.com/sa-project/entity"
+	"gorm.io/gorm"
 )
 
 func GetMember(c *gin.Context) {
 	var members []entity.Member
-	if err := configs.DB().
+	if err := configs.DB().WithContext(c).
 		Preload("Rank").
 		Find(&members).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch members"})
@@ -37,14 +38,21 @@ func UpdateMemberRank(c *gin.Context) {
 		return
 	}
 
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	var m entity.Member
 	if err := db.First(&m, "m_id = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
 		return
 	}
 
-	if err := db.Model(&m).Update("rank_id", in.RankID).Error; err != nil {
+	// rankId อยู่ใน claims ของ token เดิม -> บังคับให้ login ใหม่ (ตัด session ไม่ได้ = ไม่เปลี่ยน rank)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&m).Update("rank_id", in.RankID).Error; err != nil {
+			return err
+		}
+		return revokeMemberSessions(tx, id)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update rank"})
 		return
 	}
@@ -69,7 +77,7 @@ func UpdateMember(c *gin.Context) {
 		return
 	}
 
-	db := configs.DB()
+	db := configs.DB().WithContext(c)
 	var m entity.Member
 	if err := db.First(&m, "m_id = ?", id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
@@ -85,7 +93,16 @@ func UpdateMember(c *gin.Context) {
 		return
 	}
 
-	if err := db.Model(&m).Updates(updates).Error; err != nil {
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&m).Updates(updates).Error; err != nil {
+			return err
+		}
+		if in.RankID != nil {
+			return revokeMemberSessions(tx, id)
+		}
+		return nil
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update member"})
 		return
 	}
@@ -100,7 +117,13 @@ func DeleteMemberById(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid member id"})
 		return
 	}
-	tx := configs.DB().Exec("DELETE FROM members WHERE m_id = ?", id)
+	// ตัด session ก่อนลบ เพื่อไม่ให้ token ที่ออกไปแล้วใช้ต่อได้จนหมดอายุ
+	if err := revokeMemberSessions(configs.DB().WithContext(c), id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to revoke sessions"})
+		return
+	}
+	// ใช้ Delete ของ GORM (ไม่ใช่ Exec) เพื่อให้ผ่าน audit callback
+	tx := configs.DB().WithContext(c).Delete(&entity.Member{}, "m_id = ?", id)
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to delete member"})
 		return
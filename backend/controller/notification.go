@@ -0,0 +1,335 @@
+package controller
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+// ประเภทการแจ้งเตือน (Notification.Type)
+const (
+	NotifyRequestApproved     = "request_approved"
+	NotifyRequestRejected     = "request_rejected"
+	NotifyRequestCompleted    = "request_completed"
+	NotifyPetitionUpdated     = "petition_updated"
+	NotifyVisitConfirmed      = "visit_confirmed"
+	NotifyVisitCancelled      = "visit_cancelled"
+	NotifyAppointmentTomorrow = "appointment_tomorrow"
+	NotifyStockLow            = "stock_low"
+	NotifyAccountLocked       = "account_locked"
+)
+
+// staffRanks ผู้รับการแจ้งเตือนงานภายใน (นัดตรวจ, พัสดุใกล้หมด)
+var staffRanks = []int{1, 2}
+
+// -------- Service --------
+
+// notifyMembers สร้างการแจ้งเตือนให้สมาชิกตาม MID (ข้ามค่าซ้ำ)
+func notifyMembers(tx *gorm.DB, mids []int, kind, title, message, refType string, refID uint) error {
+	seen := map[int]bool{}
+	for _, mid := range mids {
+		if mid == 0 || seen[mid] {
+			continue
+		}
+		seen[mid] = true
+		n := entity.Notification{MID: mid, Type: kind, Title: title, Message: message, RefType: refType, RefID: refID}
+		if err := tx.Create(&n).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notifyRanks แจ้งเตือนสมาชิกทุกคนในระดับสิทธิ์ที่กำหนด
+func notifyRanks(tx *gorm.DB, ranks []int, kind, title, message, refType string, refID uint) error {
+	var mids []int
+	if err := tx.Model(&entity.Member{}).Where("rank_id IN ?", ranks).Pluck("m_id", &mids).Error; err != nil {
+		return err
+	}
+	return notifyMembers(tx, mids, kind, title, message, refType, refID)
+}
+
+// notifyMID แจ้งเตือนสมาชิกคนเดียว (mid = nil คือไม่รู้ผู้รับ ข้ามไป)
+func notifyMID(tx *gorm.DB, mid *int, kind, title, message, refType string, refID uint) error {
+	if mid == nil {
+		return nil
+	}
+	return notifyMembers(tx, []int{*mid}, kind, title, message, refType, refID)
+}
+
+// visitationLabel คำอธิบายการเยี่ยม เช่น "การเยี่ยม สมชาย ใจดี วันที่ 2026-10-22 เวลา 09:00 - 09:30"
+func visitationLabel(tx *gorm.DB, v entity.Visitation) string {
+	label := "การเยี่ยม"
+	if v.Inmate_ID != nil {
+		var p entity.Prisoner
+		if tx.Select("first_name", "last_name").First(&p, *v.Inmate_ID).Error == nil {
+			label += fmt.Sprintf(" %s %s", p.FirstName, p.LastName)
+		}
+	}
+	label += " วันที่ " + v.Visit_Date.Format("2006-01-02")
+	if v.TimeSlot_ID != nil {
+		var slot entity.TimeSlot
+		if tx.First(&slot, *v.TimeSlot_ID).Error == nil {
+			label += fmt.Sprintf(" เวลา %s - %s", slot.Start_Time, slot.End_Time)
+		}
+	}
+	return label
+}
+
+// notifyVisitation แจ้งญาติ (สมาชิกที่เลขบัตรตรงกับผู้เยี่ยม) เรื่องการเยี่ยม
+// การยืนยันการเยี่ยมส่งอีเมลด้วย (ถึงสมาชิก หรือถึงอีเมลของผู้เยี่ยมถ้ายังไม่มีบัญชี)
+func notifyVisitation(tx *gorm.DB, v entity.Visitation, kind, reason string) error {
+	if v.Visitor_ID == nil {
+		return nil
+	}
+	var visitor entity.Visitor
+	if err := tx.First(&visitor, *v.Visitor_ID).Error; err != nil {
+		return err
+	}
+	var members []entity.Member
+	if err := tx.Select("m_id", "email", "language", "first_name", "last_name").
+		Where("citizen_id = ?", visitor.Citizen_ID).Find(&members).Error; err != nil {
+		return err
+	}
+
+	if kind == NotifyVisitConfirmed {
+		if len(members) == 0 {
+			name := visitor.FirstName + " " + visitor.LastName
+			if err := queueEmail(tx, visitor.Email, "th", EmailVisitConfirmed, visitationEmailData(tx, v, name)); err != nil {
+				return err
+			}
+		}
+		for _, m := range members {
+			name := m.FirstName + " " + m.LastName
+			if err := queueEmail(tx, m.Email, m.Language, EmailVisitConfirmed, visitationEmailData(tx, v, name)); err != nil {
+				return err
+			}
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+
+	mids := make([]int, 0, len(members))
+	for _, m := range members {
+		mids = append(mids, m.MID)
+	}
+	label := visitationLabel(tx, v)
+	var title, message string
+	switch kind {
+	case NotifyVisitConfirmed:
+		title = "การเยี่ยมได้รับการอนุมัติแล้ว"
+		message = label + " ได้รับการอนุมัติแล้ว กรุณานำบัตรประชาชนมาแสดงที่จุดตรวจ"
+	default:
+		title = "การเยี่ยมถูกยกเลิก"
+		message = label + " ถูกยกเลิก"
+		if reason != "" {
+			message += " (" + reason + ")"
+		}
+	}
+	return notifyMembers(tx, mids, kind, title, message, "visitation", v.ID)
+}
+
+// notifyVisitationStatus แจ้งญาติเมื่อสถานะการเยี่ยมเปลี่ยนเป็นอนุมัติ/ไม่อนุมัติ/ยกเลิก
+func notifyVisitationStatus(tx *gorm.DB, v entity.Visitation, oldStatus *uint) error {
+	if v.Status_ID == nil || (oldStatus != nil && *oldStatus == *v.Status_ID) {
+		return nil
+	}
+	switch *v.Status_ID {
+	case statusApproved:
+		return notifyVisitation(tx, v, NotifyVisitConfirmed, "")
+	case statusRejected:
+		return notifyVisitation(tx, v, NotifyVisitCancelled, "ไม่ได้รับการอนุมัติ")
+	case statusCancelled:
+		return notifyVisitation(tx, v, NotifyVisitCancelled, v.Cancel_Reason)
+	}
+	return nil
+}
+
+// notifyStockLow แจ้งเจ้าหน้าที่เมื่อพัสดุเปลี่ยนเป็น ใกล้หมด/หมดแล้ว
+func notifyStockLow(tx *gorm.DB, parcel entity.Parcel, oldStatus string) error {
+	if parcel.Status == oldStatus || parcel.Status == "คงเหลือ" {
+		return nil
+	}
+	return notifyRanks(tx, staffRanks, NotifyStockLow,
+		fmt.Sprintf("พัสดุ%s: %s", parcel.Status, parcel.ParcelName),
+		fmt.Sprintf("%s คงเหลือที่ใช้ได้ %d หน่วย กรุณาสั่งซื้อเพิ่ม", parcel.ParcelName, parcel.Available),
+		"parcel", uint(parcel.PID))
+}
+
+// notifyRequestingStatus แจ้งผู้ยื่นคำขอเบิกเมื่อคำขอได้รับอนุมัติ/ไม่อนุมัติ/เบิกสำเร็จ
+// (requesting ต้อง preload Lines.Parcel มาแล้ว)
+func notifyRequestingStatus(tx *gorm.DB, r entity.Requesting) error {
+	if r.Status_ID == nil {
+		return nil
+	}
+	var kind string
+	switch *r.Status_ID {
+	case statusApproved:
+		kind = NotifyRequestApproved
+	case statusRejected:
+		kind = NotifyRequestRejected
+	case statusCompleted:
+		kind = NotifyRequestCompleted
+	default:
+		return nil
+	}
+	var status entity.Status
+	if err := tx.First(&status, *r.Status_ID).Error; err != nil {
+		return err
+	}
+	items := fmt.Sprintf("%d รายการ", len(r.Lines))
+	if len(r.Lines) == 1 {
+		items = fmt.Sprintf("%s จำนวน %d %s", r.Lines[0].Parcel.ParcelName, r.Lines[0].Quantity_Requested, r.Lines[0].Parcel.Unit)
+	}
+	return notifyMID(tx, r.RequestedByMID, kind,
+		fmt.Sprintf("คำขอเบิก %s: %s", r.Requesting_NO, status.Status),
+		fmt.Sprintf("คำขอเบิก %s เปลี่ยนสถานะเป็น %s", items, status.Status),
+		"requesting", r.Requesting_ID)
+}
+
+// notifyPetitionStatus แจ้งผู้บันทึกคำร้องเมื่อสถานะคำร้องเปลี่ยน (ผลพิจารณาส่งอีเมลด้วย)
+func notifyPetitionStatus(tx *gorm.DB, p entity.Petition) error {
+	if p.Status_ID == nil {
+		return nil
+	}
+	var status entity.Status
+	if err := tx.First(&status, *p.Status_ID).Error; err != nil {
+		return err
+	}
+	if err := notifyMID(tx, p.CreatedByMID, NotifyPetitionUpdated,
+		fmt.Sprintf("คำร้องหมายเลข %d: %s", p.ID, status.Status),
+		fmt.Sprintf("คำร้อง \"%s\" เปลี่ยนสถานะเป็น %s", p.Detail, status.Status),
+		"petition", p.ID); err != nil {
+		return err
+	}
+
+	switch status.Status_ID {
+	case statusApproved, statusRejected, statusCompleted:
+	default:
+		return nil
+	}
+	if p.CreatedByMID == nil {
+		return nil
+	}
+	var m entity.Member
+	if err := tx.Select("email", "language", "first_name", "last_name").First(&m, "m_id = ?", *p.CreatedByMID).Error; err != nil {
+		return err
+	}
+	data := map[string]any{
+		"Name":     m.FirstName + " " + m.LastName,
+		"ID":       p.ID,
+		"Detail":   p.Detail,
+		"StatusTH": status.Status,
+		"StatusEN": statusNamesEN[status.Status_ID],
+	}
+	if p.Inmate_ID != nil {
+		var prisoner entity.Prisoner
+		if tx.Select("first_name", "last_name").First(&prisoner, *p.Inmate_ID).Error == nil {
+			data["Prisoner"] = prisoner.FirstName + " " + prisoner.LastName
+		}
+	}
+	return queueEmail(tx, m.Email, m.Language, EmailPetitionOutcome, data)
+}
+
+// logNotifyError การแจ้งเตือนไม่ควรทำให้งานหลักล้ม บันทึก log ไว้แทน
+func logNotifyError(err error) {
+	if err != nil {
+		log.Printf("notification: %v", err)
+	}
+}
+
+// -------- Handlers --------
+
+// GET /api/notifications?unread=true&limit=50
+func GetNotifications(c *gin.Context) {
+	mid := midFromContext(c)
+	if mid == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 500 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 500"})
+			return
+		}
+		limit = n
+	}
+
+	q := configs.DB().Where("m_id = ?", *mid).Order("id desc").Limit(limit)
+	if c.Query("unread") == "true" {
+		q = q.Where("read_at IS NULL")
+	}
+	var items []entity.Notification
+	if err := q.Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// GET /api/notifications/unread-count
+func GetUnreadNotificationCount(c *gin.Context) {
+	mid := midFromContext(c)
+	if mid == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	var count int64
+	if err := configs.DB().Model(&entity.Notification{}).Where("m_id = ? AND read_at IS NULL", *mid).Count(&count).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread": count})
+}
+
+// PUT /api/notifications/:id/read
+func MarkNotificationRead(c *gin.Context) {
+	mid := midFromContext(c)
+	if mid == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	db := configs.DB().WithContext(c)
+	var n entity.Notification
+	// ค้นด้วย m_id ด้วย: ไม่ให้เห็น/แก้การแจ้งเตือนของคนอื่น
+	if err := db.Where("id = ? AND m_id = ?", c.Param("id"), *mid).First(&n).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	if n.ReadAt == nil {
+		now := time.Now()
+		if err := db.Model(&n).Update("read_at", now).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+			return
+		}
+		n.ReadAt = &now
+	}
+	c.JSON(http.StatusOK, n)
+}
+
+// PUT /api/notifications/read-all
+func MarkAllNotificationsRead(c *gin.Context) {
+	mid := midFromContext(c)
+	if mid == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	res := configs.DB().WithContext(c).Model(&entity.Notification{}).
+		Where("m_id = ? AND read_at IS NULL", *mid).
+		Update("read_at", time.Now())
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notifications"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"updated": res.RowsAffected})
+}
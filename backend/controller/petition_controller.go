@@ -62,9 +62,10 @@ func CreatePetition(c *gin.Context) {
 		Staff_ID:     &input.Staff_ID,
 		Status_ID:    &input.Status_ID,
 		Type_cum_ID:  &input.Type_cum_ID,
+		CreatedByMID: midFromContext(c),
 	}
 
-	if err := configs.DB().Create(&petition).Error; err != nil {
+	if err := configs.DB().WithContext(c).Create(&petition).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create petition: " + err.Error()})
 		return
 	}
@@ -75,7 +76,7 @@ func CreatePetition(c *gin.Context) {
 // GET /petitions
 func GetPetitions(c *gin.Context) {
 	var petitions []entity.Petition
-	if err := configs.DB().
+	if err := configs.DB().WithContext(c).
 		Preload("Inmate").
 		Preload("Staff").
 		Preload("Status").
@@ -97,7 +98,7 @@ func UpdatePetition(c *gin.Context) {
 
 	id := c.Param("id")
 	var petition entity.Petition
-	if err := configs.DB().First(&petition, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&petition, id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Petition not found."})
 			return
@@ -118,6 +119,7 @@ func UpdatePetition(c *gin.Context) {
 		return
 	}
 
+	oldStatus := petition.Status_ID
 	petition.Detail = input.Detail
 	petition.Date_created = dateCreated
 	petition.Inmate_ID = &input.Inmate_ID
@@ -125,10 +127,13 @@ func UpdatePetition(c *gin.Context) {
 	petition.Status_ID = &input.Status_ID
 	petition.Type_cum_ID = &input.Type_cum_ID
 
-	if err := configs.DB().Save(&petition).Error; err != nil {
+	if err := configs.DB().WithContext(c).Save(&petition).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update petition: " + err.Error()})
 		return
 	}
+	if oldStatus == nil || *oldStatus != input.Status_ID {
+		logNotifyError(notifyPetitionStatus(configs.DB(), petition))
+	}
 
 	c.JSON(http.StatusOK, petition)
 }
@@ -141,7 +146,7 @@ func DeletePetition(c *gin.Context) {
 	}
 
 	id := c.Param("id")
-	if err := configs.DB().Delete(&entity.Petition{}, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).Delete(&entity.Petition{}, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete petition."})
 		return
 	}
@@ -154,7 +159,7 @@ func GetTypeCums(c *gin.Context) {
 	// ⭐️ แก้ไข: ต้องใช้ชื่อ struct ที่ถูกต้องตาม entity ของคุณ
 	// สมมติว่าใน entity ชื่อ Type_cum หรือ PetitionTypeCum
 	var types []entity.Type_cum
-	if err := configs.DB().Find(&types).Error; err != nil {
+	if err := configs.DB().WithContext(c).Find(&types).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve petition types."})
 		return
 	}
@@ -30,34 +30,55 @@ type PrisonerInput struct {
 
 // -------- Helpers --------
 
-// อัปเดตสถานะห้องจากจำนวนผู้ต้องขังที่ยังไม่ปล่อยตัว
+// อัปเดตสถานะห้องจากจำนวนผู้ต้องขังที่ยังไม่ปล่อยตัวเทียบกับความจุของห้อง
 func updateRoomStatus(tx *gorm.DB, roomID uint) error {
-	var count int64
-	
-	// --- LOGIC ที่แก้ไข ---
+	var room entity.Room
+	if err := tx.First(&room, roomID).Error; err != nil {
+		return fmt.Errorf("failed to load room: %w", err)
+	}
+
 	// นับจำนวนนักโทษที่ยัง "คุมขังอยู่" จริงๆ
 	// เงื่อนไข: release_date เป็น NULL หรือ release_date เป็นวันในอนาคต
-	now := time.Now()
-	if err := tx.Model(&entity.Prisoner{}).
-		Where("room_id = ? AND (release_date IS NULL OR release_date > ?)", roomID, now).
-		Count(&count).Error; err != nil {
+	count, err := countActivePrisoners(tx, roomID)
+	if err != nil {
 		return fmt.Errorf("failed to count prisoners in room: %w", err)
 	}
 
-	newStatus := "ว่าง"
-	if count >= 2 { // ความจุห้องคือ 2 คน
-		newStatus = "เต็ม"
-	}
-
 	if err := tx.Model(&entity.Room{}).
 		Where("room_id = ?", roomID).
-		Update("room_status", newStatus).Error; err != nil {
+		Update("room_status", roomStatusFor(count, room.Capacity)).Error; err != nil {
 		return fmt.Errorf("failed to update room status: %w", err)
 	}
 	return nil
 }
 
-// ตรวจความสอดคล้องของเพศกับห้อง (ชายต้องขึ้นต้น M, หญิงต้องขึ้นต้น F)
+// roomStatusFor คำนวณ Room_Status จากจำนวนผู้พักเทียบกับความจุ
+func roomStatusFor(count int64, capacity int) string {
+	if count >= int64(capacity) {
+		return "เต็ม"
+	}
+	return "ว่าง"
+}
+
+// checkRoomCapacity คืน error ถ้าห้องไม่มีที่ว่างเหลือ (ใช้ภายใน transaction ได้)
+func checkRoomCapacity(tx *gorm.DB, roomID uint) error {
+	var room entity.Room
+	if err := tx.First(&room, roomID).Error; err != nil {
+		return errors.New("ไม่พบข้อมูลห้องที่ระบุ")
+	}
+	count, err := countActivePrisoners(tx, roomID)
+	if err != nil {
+		return err
+	}
+	if count >= int64(room.Capacity) {
+		return errRoomFull
+	}
+	return nil
+}
+
+var errRoomFull = errors.New("ห้องขังเต็มแล้ว")
+
+// ตรวจความสอดคล้องของเพศกับห้องตามเพศที่กำหนดไว้ในห้อง (ห้อง Is_Mixed รับได้ทุกเพศ)
 func validateGenderAndRoom(genderID uint, roomID uint) error {
 	db := configs.DB()
 
@@ -71,17 +92,17 @@ func validateGenderAndRoom(genderID uint, roomID uint) error {
 		return errors.New("ไม่พบข้อมูลห้องที่ระบุ")
 	}
 
-	isMale := gender.Gender_ID == 1   // ชาย
-	isFemale := gender.Gender_ID == 2 // หญิง
-
-	roomIsForMale := strings.HasPrefix(room.Room_Name, "M")
-	roomIsForFemale := strings.HasPrefix(room.Room_Name, "F")
-
-	if isMale && !roomIsForMale {
-		return errors.New("นักโทษชายสามารถเข้าได้เฉพาะห้องประเภท 'M' เท่านั้น")
+	if room.Is_Mixed {
+		return nil
+	}
+	// ห้องเก่าที่ยังไม่ได้กำหนดเพศ (ชื่อไม่ขึ้นต้นด้วย M/F) ต้องกำหนดก่อนจึงรับผู้ต้องขังได้
+	if room.Gender_ID == nil {
+		return fmt.Errorf("ห้อง %s ยังไม่ได้กำหนดเพศ กรุณากำหนดเพศของห้องหรือตั้งเป็นห้องรวมก่อน", room.Room_Name)
 	}
-	if isFemale && !roomIsForFemale {
-		return errors.New("นักโทษหญิงสามารถเข้าได้เฉพาะห้องประเภท 'F' เท่านั้น")
+	if *room.Gender_ID != gender.Gender_ID {
+		var roomGender entity.Gender
+		db.First(&roomGender, *room.Gender_ID)
+		return fmt.Errorf("ห้อง %s สำหรับผู้ต้องขัง%sเท่านั้น", room.Room_Name, roomGender.Gender)
 	}
 	return nil
 }
@@ -104,16 +125,14 @@ func CreatePrisoner(c *gin.Context) {
 		}
 	}
 
-	// --- LOGIC ที่แก้ไข ---
-	// เช็คห้องเต็มหรือยัง (ด้วยเงื่อนไขใหม่)
+	// เช็คห้องเต็มหรือยัง ตามความจุของห้อง
 	if input.Room_ID != nil {
-		var count int64
-		now := time.Now()
-		configs.DB().Model(&entity.Prisoner{}).
-			Where("room_id = ? AND (release_date IS NULL OR release_date > ?)", *input.Room_ID, now).
-			Count(&count)
-		if count >= 2 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "ไม่สามารถเพิ่มนักโทษได้ เนื่องจากห้องขังเต็มแล้ว"})
+		if err := checkRoomCapacity(configs.DB().WithContext(c), *input.Room_ID); err != nil {
+			if errors.Is(err, errRoomFull) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "ไม่สามารถเพิ่มนักโทษได้ เนื่องจากห้องขังเต็มแล้ว"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 	}
@@ -158,20 +177,25 @@ func CreatePrisoner(c *gin.Context) {
 		ReleaseDate: releaseDate,
 	}
 
-	tx := configs.DB().Begin()
+	tx := configs.DB().WithContext(c).Begin()
 	if err := tx.Create(&prisoner).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create prisoner: " + err.Error()})
 		return
 	}
 
-	// อัปเดตสถานะห้อง
+	// อัปเดตสถานะห้อง และเริ่มประวัติห้องตั้งแต่วันรับเข้า
 	if prisoner.Room_ID != nil {
 		if err := updateRoomStatus(tx, *prisoner.Room_ID); err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		if err := openRoomAssignment(tx, prisoner.Prisoner_ID, *prisoner.Room_ID, prisoner.EntryDate, "รับเข้า", midFromContext(c)); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
 	// สร้างคะแนนเริ่มต้น (0) สำหรับผู้ต้องขังที่เพิ่งเพิ่ม
@@ -201,7 +225,7 @@ func UpdatePrisoner(c *gin.Context) {
 	id := c.Param("id")
 
 	var prisoner entity.Prisoner
-	if err := configs.DB().First(&prisoner, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&prisoner, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Prisoner not found"})
 		return
 	}
@@ -221,20 +245,8 @@ func UpdatePrisoner(c *gin.Context) {
 		}
 	}
 
-	// --- LOGIC ที่แก้ไข ---
-	// เช็คห้องใหม่เต็มหรือยัง (ถ้าย้ายห้อง) ด้วยเงื่อนไขใหม่
 	newRoomID := input.Room_ID
-	if newRoomID != nil && (oldRoomID == nil || *oldRoomID != *newRoomID) {
-		var count int64
-		now := time.Now()
-		configs.DB().Model(&entity.Prisoner{}).
-			Where("room_id = ? AND (release_date IS NULL OR release_date > ?)", *newRoomID, now).
-			Count(&count)
-		if count >= 2 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "ไม่สามารถย้ายนักโทษได้ เนื่องจากห้องขังปลายทางเต็มแล้ว"})
-			return
-		}
-	}
+	moved := newRoomID != nil && (oldRoomID == nil || *oldRoomID != *newRoomID)
 
 	layout := "2006-01-02"
 	birthday, err := time.Parse(layout, input.Birthday)
@@ -274,13 +286,45 @@ func UpdatePrisoner(c *gin.Context) {
 		ReleaseDate: releaseDate,
 	}
 
-	tx := configs.DB().Begin()
+	tx := configs.DB().WithContext(c).Begin()
+
+	// เช็คห้องใหม่ (ถ้าย้ายห้อง) ภายใน transaction เพื่อกันการย้ายเข้าห้องเดียวกันพร้อมกัน
+	if moved {
+		if lockdown, err := activeLockdownForTransfer(tx, oldRoomID, *newRoomID); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check lockdown"})
+			return
+		} else if lockdown != nil {
+			tx.Rollback()
+			c.JSON(http.StatusConflict, gin.H{"error": "ไม่สามารถย้ายห้องได้ " + lockdownMessage(configs.DB(), lockdown)})
+			return
+		}
+		if err := checkRoomCapacity(tx, *newRoomID); err != nil {
+			tx.Rollback()
+			if errors.Is(err, errRoomFull) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "ไม่สามารถย้ายนักโทษได้ เนื่องจากห้องขังปลายทางเต็มแล้ว"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	if err := tx.Model(&prisoner).Updates(updateData).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update prisoner"})
 		return
 	}
 
+	// ย้ายห้องผ่านการแก้ไขข้อมูล -> เก็บประวัติห้องไว้ด้วย (การย้ายปกติควรใช้ /transfer)
+	if moved {
+		if err := openRoomAssignment(tx, prisoner.Prisoner_ID, *newRoomID, time.Now(), "แก้ไขข้อมูลผู้ต้องขัง", midFromContext(c)); err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	// อัปเดตสถานะห้องเก่า/ใหม่ ถ้ามีการย้าย หรือมีการเปลี่ยนแปลง release_date
 	if oldRoomID != nil && (newRoomID == nil || *oldRoomID != *newRoomID) {
 		// ย้ายออกจากห้องเก่า -> อัปเดตห้องเก่า
@@ -304,7 +348,7 @@ func UpdatePrisoner(c *gin.Context) {
 		return
 	}
 
-	configs.DB().Preload("Gender").Preload("Room").Preload("Work").First(&prisoner, id)
+	configs.DB().WithContext(c).Preload("Gender").Preload("Room").Preload("Work").First(&prisoner, id)
 	c.JSON(http.StatusOK, prisoner)
 }
 
@@ -313,19 +357,26 @@ func DeletePrisoner(c *gin.Context) {
 	id := c.Param("id")
 
 	var prisoner entity.Prisoner
-	if err := configs.DB().First(&prisoner, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&prisoner, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Prisoner not found"})
 		return
 	}
 	roomIDToUpdate := prisoner.Room_ID
 
-	tx := configs.DB().Begin()
+	tx := configs.DB().WithContext(c).Begin()
 	if err := tx.Delete(&entity.Prisoner{}, id).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete prisoner"})
 		return
 	}
 
+	// เก็บประวัติห้องไว้สำหรับการสอบสวนย้อนหลัง แค่ปิดรายการที่ยังเปิดอยู่
+	if err := closeRoomAssignment(tx, prisoner.Prisoner_ID, time.Now()); err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	if roomIDToUpdate != nil {
 		if err := updateRoomStatus(tx, *roomIDToUpdate); err != nil {
 			tx.Rollback()
@@ -345,7 +396,7 @@ func DeletePrisoner(c *gin.Context) {
 // GetPrisoners - ดึงนักโทษทั้งหมด
 func GetPrisoners(c *gin.Context) {
 	var prisoners []entity.Prisoner
-	if err := configs.DB().
+	if err := configs.DB().WithContext(c).
 		Preload("Gender").
 		Preload("Room").
 		Preload("Work").
@@ -361,7 +412,7 @@ func GetPrisoners(c *gin.Context) {
 func GetPrisonerByID(c *gin.Context) {
 	id := c.Param("id")
 	var prisoner entity.Prisoner
-	if err := configs.DB().
+	if err := configs.DB().WithContext(c).
 		Preload("Gender").
 		Preload("Room").
 		Preload("Work").
@@ -375,7 +426,7 @@ func GetPrisonerByID(c *gin.Context) {
 // GetNextInmateID - สร้าง Inmate_ID ใหม่
 func GetNextInmateID(c *gin.Context) {
 	var latest entity.Prisoner
-	err := configs.DB().
+	err := configs.DB().WithContext(c).
 		Order("inmate_id DESC").
 		First(&latest).Error
 
@@ -407,7 +458,7 @@ func GetNextInmateID(c *gin.Context) {
 // รายการเกณฑ์พฤติกรรม
 func GetBehaviorCriteria(c *gin.Context) {
 	var criteria []entity.BehaviorCriterion
-	if err := configs.DB().Find(&criteria).Error; err != nil {
+	if err := configs.DB().WithContext(c).Find(&criteria).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch behavior criteria"})
 		return
 	}
@@ -0,0 +1,451 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+type purchaseOrderLineInput struct {
+	PID       *int    `json:"PID" binding:"required"`
+	Quantity  int     `json:"Quantity" binding:"required,min=1"`
+	UnitPrice float64 `json:"UnitPrice" binding:"min=0"`
+}
+
+type purchaseOrderInput struct {
+	SupplierID   uint                     `json:"SupplierID" binding:"required"`
+	OrderDate    string                   `json:"OrderDate" binding:"required"` // YYYY-MM-DD
+	ExpectedDate *string                  `json:"ExpectedDate"`
+	Note         string                   `json:"Note"`
+	Lines        []purchaseOrderLineInput `json:"Lines" binding:"required,min=1,dive"`
+}
+
+type receiveLineInput struct {
+	LineID   uint    `json:"LineID" binding:"required"`
+	Quantity int     `json:"Quantity" binding:"required,min=1"`
+	LotNo    string  `json:"LotNo"`
+	Expiry   *string `json:"ExpiryDate"` // ยาต้องระบุ
+}
+
+type receiveInput struct {
+	DeliveryNoteNo string  `json:"DeliveryNoteNo"`
+	ReceivedDate   *string `json:"ReceivedDate"` // ไม่ส่ง = วันนี้
+	Note           string  `json:"Note"`
+	// ผู้ขายส่งเกินจำนวนที่สั่ง: ต้องยืนยันรับเกินด้วย AllowOver=true ไม่เช่นนั้นปฏิเสธทั้งใบรับ
+	AllowOver bool               `json:"AllowOver"`
+	Lines     []receiveLineInput `json:"Lines" binding:"required,min=1,dive"`
+}
+
+var errPOStatus = errors.New("purchase order status does not allow this action")
+
+// overDeliveryError รับเกินจำนวนค้างรับโดยไม่ได้ยืนยัน AllowOver
+type overDeliveryError struct {
+	LineID      uint
+	ParcelName  string
+	Quantity    int
+	Outstanding int
+}
+
+func (e *overDeliveryError) Error() string {
+	return fmt.Sprintf("%s: รับ %d เกินจำนวนค้างรับ %d (ยืนยันรับเกินด้วย AllowOver)", e.ParcelName, e.Quantity, e.Outstanding)
+}
+
+func (e *overDeliveryError) respond(c *gin.Context) {
+	c.JSON(http.StatusConflict, gin.H{"error": e.Error(), "line_id": e.LineID, "outstanding": e.Outstanding})
+}
+
+// generateNextPONo เลขที่ใบสั่งซื้อรูปแบบ PO-0001/2569 เริ่มนับใหม่ทุกปี พ.ศ. (แบบเดียวกับ generateNextRequestNo)
+func generateNextPONo(db *gorm.DB) (string, error) {
+	year := time.Now().In(configs.Bangkok()).Year() + 543
+
+	var latest entity.PurchaseOrder
+	err := db.Where("po_no LIKE ?", fmt.Sprintf("PO-%%/%d", year)).Order("po_no desc").First(&latest).Error
+	next := 1
+	if err == nil {
+		var n int
+		if _, err := fmt.Sscanf(latest.PONo, "PO-%d/", &n); err != nil {
+			return "", fmt.Errorf("failed to parse sequence number from: %s", latest.PONo)
+		}
+		next = n + 1
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", fmt.Errorf("failed to query latest PO number: %w", err)
+	}
+	return fmt.Sprintf("PO-%04d/%d", next, year), nil
+}
+
+// buildPurchaseOrder ตรวจข้อมูลใบสั่งซื้อ (ผู้ขายต้องใช้งานอยู่, พัสดุต้องมีจริงและไม่ซ้ำ)
+func buildPurchaseOrder(db *gorm.DB, in purchaseOrderInput, po *entity.PurchaseOrder) error {
+	var supplier entity.Supplier
+	if err := db.First(&supplier, in.SupplierID).Error; err != nil {
+		return errors.New("supplier not found")
+	}
+	if !supplier.IsActive {
+		return errors.New("supplier is inactive")
+	}
+	orderDate, err := time.Parse("2006-01-02", in.OrderDate)
+	if err != nil {
+		return errors.New("invalid OrderDate format, use YYYY-MM-DD")
+	}
+	expected, err := parseISODatePtr(in.ExpectedDate)
+	if err != nil {
+		return errors.New("invalid ExpectedDate format, use YYYY-MM-DD")
+	}
+	if expected != nil && expected.Before(orderDate) {
+		return errors.New("ExpectedDate must not be before OrderDate")
+	}
+
+	seen := map[int]bool{}
+	lines := make([]entity.PurchaseOrderLine, 0, len(in.Lines))
+	for _, l := range in.Lines {
+		if seen[*l.PID] {
+			return fmt.Errorf("พัสดุรหัส %d ซ้ำกันในใบสั่งซื้อ", *l.PID)
+		}
+		seen[*l.PID] = true
+		var parcel entity.Parcel
+		if err := db.Select("p_id").First(&parcel, *l.PID).Error; err != nil {
+			return fmt.Errorf("ไม่พบพัสดุรหัส %d", *l.PID)
+		}
+		lines = append(lines, entity.PurchaseOrderLine{PID: *l.PID, QuantityOrdered: l.Quantity, UnitPrice: l.UnitPrice})
+	}
+
+	po.SupplierID = supplier.ID
+	po.OrderDate = orderDate
+	po.ExpectedDate = expected
+	po.Note = strings.TrimSpace(in.Note)
+	po.Lines = lines
+	return nil
+}
+
+// purchaseOrderStatusAfterReceipt รับครบทุกรายการ = received, ยังค้างบางรายการ = partially_received
+func purchaseOrderStatusAfterReceipt(lines []entity.PurchaseOrderLine) string {
+	for _, l := range lines {
+		if l.QuantityReceived < l.QuantityOrdered {
+			return entity.POPartiallyReceived
+		}
+	}
+	return entity.POReceived
+}
+
+// setPurchaseOrderStatus เปลี่ยนสถานะเมื่อสถานะปัจจุบันอยู่ใน from เท่านั้น
+func setPurchaseOrderStatus(c *gin.Context, to string, from ...string) {
+	db := configs.DB().WithContext(c)
+	var po entity.PurchaseOrder
+	if err := db.First(&po, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+	res := db.Model(&entity.PurchaseOrder{}).Where("id = ? AND status IN ?", po.ID, from).Update("status", to)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase order"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("ใบสั่งซื้อสถานะ %s ไม่สามารถเปลี่ยนเป็น %s ได้", po.Status, to)})
+		return
+	}
+	loadPurchaseOrder(db, &po, po.ID)
+	c.JSON(http.StatusOK, po)
+}
+
+func loadPurchaseOrder(db *gorm.DB, po *entity.PurchaseOrder, id any) error {
+	return db.Preload("Supplier").Preload("Lines.Parcel").Preload("Receipts.Lines").First(po, id).Error
+}
+
+// -------- Handlers --------
+
+// GET /api/purchase-orders?status=ordered&supplier_id=1
+func GetPurchaseOrders(c *gin.Context) {
+	q := configs.DB().Preload("Supplier").Preload("Lines.Parcel").Order("id desc")
+	if status := c.Query("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if sid := c.Query("supplier_id"); sid != "" {
+		q = q.Where("supplier_id = ?", sid)
+	}
+	var items []entity.PurchaseOrder
+	if err := q.Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch purchase orders"})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// purchaseOrderLineDetail รายการพร้อมจำนวนค้างรับ/รับเกิน
+type purchaseOrderLineDetail struct {
+	entity.PurchaseOrderLine
+	Outstanding int `json:"Outstanding"`
+	Over        int `json:"Over"`
+}
+
+// GET /api/purchase-orders/:id  ใบสั่งซื้อพร้อมรายการ ยอดค้างรับ/รับเกิน และประวัติการรับของ
+func GetPurchaseOrder(c *gin.Context) {
+	var po entity.PurchaseOrder
+	if err := loadPurchaseOrder(configs.DB(), &po, c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+	lines := make([]purchaseOrderLineDetail, 0, len(po.Lines))
+	var total float64
+	for _, l := range po.Lines {
+		lines = append(lines, purchaseOrderLineDetail{
+			PurchaseOrderLine: l,
+			Outstanding:       max(l.QuantityOrdered-l.QuantityReceived, 0),
+			Over:              max(l.QuantityReceived-l.QuantityOrdered, 0),
+		})
+		total += float64(l.QuantityOrdered) * l.UnitPrice
+	}
+	c.JSON(http.StatusOK, struct {
+		entity.PurchaseOrder
+		Lines       []purchaseOrderLineDetail `json:"Lines"`
+		TotalAmount float64                   `json:"TotalAmount"`
+	}{po, lines, total})
+}
+
+// POST /api/purchase-orders  สร้างใบสั่งซื้อสถานะร่าง
+func CreatePurchaseOrder(c *gin.Context) {
+	var in purchaseOrderInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload: " + err.Error()})
+		return
+	}
+	db := configs.DB().WithContext(c)
+	po := entity.PurchaseOrder{Status: entity.PODraft, CreatedByMID: midFromContext(c)}
+	if err := buildPurchaseOrder(db, in, &po); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		no, err := generateNextPONo(tx)
+		if err != nil {
+			return err
+		}
+		po.PONo = no
+		return tx.Create(&po).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Create purchase order failed: " + err.Error()})
+		return
+	}
+	loadPurchaseOrder(db, &po, po.ID)
+	c.JSON(http.StatusCreated, po)
+}
+
+// PUT /api/purchase-orders/:id  แก้ไขได้เฉพาะใบร่าง (รายการทั้งหมดถูกแทนที่)
+func UpdatePurchaseOrder(c *gin.Context) {
+	db := configs.DB().WithContext(c)
+	var po entity.PurchaseOrder
+	if err := db.First(&po, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+	if po.Status != entity.PODraft {
+		c.JSON(http.StatusConflict, gin.H{"error": "แก้ไขได้เฉพาะใบสั่งซื้อที่ยังเป็นร่าง"})
+		return
+	}
+	var in purchaseOrderInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload: " + err.Error()})
+		return
+	}
+	if err := buildPurchaseOrder(db, in, &po); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lines := po.Lines
+	po.Lines = nil
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&po).Updates(map[string]any{
+			"supplier_id":   po.SupplierID,
+			"order_date":    po.OrderDate,
+			"expected_date": po.ExpectedDate,
+			"note":          po.Note,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("purchase_order_id = ?", po.ID).Delete(&entity.PurchaseOrderLine{}).Error; err != nil {
+			return err
+		}
+		for i := range lines {
+			lines[i].PurchaseOrderID = po.ID
+		}
+		return tx.Create(&lines).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update purchase order: " + err.Error()})
+		return
+	}
+	loadPurchaseOrder(db, &po, po.ID)
+	c.JSON(http.StatusOK, po)
+}
+
+// POST /api/purchase-orders/:id/submit  ร่าง -> ส่งสั่งซื้อแล้ว
+func SubmitPurchaseOrder(c *gin.Context) {
+	setPurchaseOrderStatus(c, entity.POOrdered, entity.PODraft)
+}
+
+// POST /api/purchase-orders/:id/cancel  ยกเลิกได้ก่อนรับของครั้งแรกเท่านั้น
+func CancelPurchaseOrder(c *gin.Context) {
+	setPurchaseOrderStatus(c, entity.POCancelled, entity.PODraft, entity.POOrdered)
+}
+
+// POST /api/purchase-orders/:id/close  ปิดใบที่รับไม่ครบ (ส่วนที่ขาดไม่รอรับแล้ว)
+func ClosePurchaseOrder(c *gin.Context) {
+	setPurchaseOrderStatus(c, entity.POClosed, entity.POPartiallyReceived)
+}
+
+// POST /api/purchase-orders/:id/receive
+// { "DeliveryNoteNo": "...", "Lines": [{ "LineID": 1, "Quantity": 10, "LotNo": "...", "ExpiryDate": "2027-01-31" }] }
+// บันทึกการรับของ: แต่ละรายการเข้าเป็นล็อตใหม่ + Operation "รับเข้าตามใบสั่งซื้อ"; ส่งขาดได้ (ใบสั่งซื้อค้างรับต่อ),
+// ส่งเกินต้องยืนยันด้วย AllowOver
+func ReceivePurchaseOrder(c *gin.Context) {
+	var in receiveInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload: " + err.Error()})
+		return
+	}
+	db := configs.DB().WithContext(c)
+	var po entity.PurchaseOrder
+	if err := db.Preload("Supplier").Preload("Lines.Parcel").First(&po, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Purchase order not found"})
+		return
+	}
+	if po.Status != entity.POOrdered && po.Status != entity.POPartiallyReceived {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("ใบสั่งซื้อสถานะ %s รับของไม่ได้", po.Status)})
+		return
+	}
+
+	receivedAt := time.Now()
+	if d, err := parseISODatePtr(in.ReceivedDate); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ReceivedDate format, use YYYY-MM-DD"})
+		return
+	} else if d != nil {
+		if d.After(receivedAt) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ReceivedDate cannot be in the future"})
+			return
+		}
+		receivedAt = *d
+	}
+
+	// ตรวจทุกรายการก่อนเริ่มบันทึก: ไม่ให้รับเกินโดยไม่ยืนยัน และข้อมูลล็อตต้องถูกต้อง
+	// (จำนวนค้างรับตรวจซ้ำใน transaction อีกครั้ง เผื่อมีการรับของใบเดียวกันพร้อมกัน)
+	byID := make(map[uint]int, len(po.Lines))
+	for i, l := range po.Lines {
+		byID[l.ID] = i
+	}
+	lots := make([]entity.ParcelLot, len(in.Lines))
+	seen := map[uint]bool{}
+	for i, rl := range in.Lines {
+		idx, ok := byID[rl.LineID]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ไม่พบรายการ %d ในใบสั่งซื้อนี้", rl.LineID)})
+			return
+		}
+		if seen[rl.LineID] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("รายการ %d ซ้ำกันในใบรับ", rl.LineID)})
+			return
+		}
+		seen[rl.LineID] = true
+		line := po.Lines[idx]
+		if outstanding := line.QuantityOrdered - line.QuantityReceived; rl.Quantity > outstanding && !in.AllowOver {
+			(&overDeliveryError{line.ID, line.Parcel.ParcelName, rl.Quantity, max(outstanding, 0)}).respond(c)
+			return
+		}
+		lot, err := lotInput{LotNo: rl.LotNo, ExpiryDate: rl.Expiry, Supplier: po.Supplier.Name}.toLot(line.Parcel, rl.Quantity)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": line.Parcel.ParcelName + ": " + err.Error()})
+			return
+		}
+		lot.ReceivedAt = receivedAt
+		if lot.ExpiryDate != nil && lot.ExpiryDate.Before(stockDay(receivedAt)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": line.Parcel.ParcelName + ": expiryDate is before the received date"})
+			return
+		}
+		lots[i] = lot
+	}
+
+	mid := midFromContextInt(c)
+	receipt := entity.GoodsReceipt{
+		PurchaseOrderID: po.ID,
+		DeliveryNoteNo:  strings.TrimSpace(in.DeliveryNoteNo),
+		ReceivedAt:      receivedAt,
+		ReceivedByMID:   mid,
+		Note:            strings.TrimSpace(in.Note),
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// สถานะต้องยังรับของได้ (อาจถูกปิด/รับครบไปแล้วระหว่างนี้)
+		res := tx.Model(&entity.PurchaseOrder{}).
+			Where("id = ? AND status IN ?", po.ID, []string{entity.POOrdered, entity.POPartiallyReceived}).
+			Update("updated_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errPOStatus
+		}
+		if err := tx.Create(&receipt).Error; err != nil {
+			return err
+		}
+		for i, rl := range in.Lines {
+			line := &po.Lines[byID[rl.LineID]]
+			var parcel entity.Parcel
+			if err := tx.First(&parcel, line.PID).Error; err != nil {
+				return err
+			}
+			op, err := receiveStock(tx, &parcel, &lots[i], operatorReceive, mid)
+			if err != nil {
+				return err
+			}
+			// เพิ่มแบบสัมพัทธ์แล้วอ่านยอดล่าสุด: ใบรับอื่นที่บันทึกไปก่อนจะไม่ถูกเขียนทับ
+			if err := tx.Model(&entity.PurchaseOrderLine{}).Where("id = ?", line.ID).
+				Update("quantity_received", gorm.Expr("quantity_received + ?", rl.Quantity)).Error; err != nil {
+				return err
+			}
+			if err := tx.Select("quantity_received").First(line, line.ID).Error; err != nil {
+				return err
+			}
+			if line.QuantityReceived > line.QuantityOrdered && !in.AllowOver {
+				outstanding := line.QuantityOrdered - (line.QuantityReceived - rl.Quantity)
+				return &overDeliveryError{line.ID, line.Parcel.ParcelName, rl.Quantity, max(outstanding, 0)}
+			}
+			if err := tx.Create(&entity.GoodsReceiptLine{
+				GoodsReceiptID:      receipt.ID,
+				PurchaseOrderLineID: line.ID,
+				PID:                 line.PID,
+				Quantity:            rl.Quantity,
+				LotID:               lots[i].ID,
+				OPID:                op.OPID,
+			}).Error; err != nil {
+				return err
+			}
+		}
+		var lines []entity.PurchaseOrderLine
+		if err := tx.Where("purchase_order_id = ?", po.ID).Find(&lines).Error; err != nil {
+			return err
+		}
+		po.Status = purchaseOrderStatusAfterReceipt(lines)
+		return tx.Model(&entity.PurchaseOrder{}).Where("id = ?", po.ID).Update("status", po.Status).Error
+	})
+	var over *overDeliveryError
+	if errors.As(err, &over) {
+		over.respond(c)
+		return
+	}
+	if errors.Is(err, errPOStatus) {
+		c.JSON(http.StatusConflict, gin.H{"error": "ใบสั่งซื้อนี้ถูกเปลี่ยนไปแล้ว กรุณาโหลดข้อมูลใหม่"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to receive goods: " + err.Error()})
+		return
+	}
+
+	db.Preload("Lines").First(&receipt, receipt.ID)
+	c.JSON(http.StatusCreated, gin.H{"receipt": receipt, "status": po.Status})
+}
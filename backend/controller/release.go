@@ -0,0 +1,344 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+var releaseTypeLabels = map[string]string{
+	entity.ReleaseSentenceServed: "พ้นโทษ",
+	entity.ReleaseParole:         "พักการลงโทษ",
+	entity.ReleaseTransferOut:    "ย้ายไปเรือนจำอื่น",
+	entity.ReleaseCourtOrder:     "ศาลสั่งปล่อย",
+}
+
+var (
+	errAlreadyReleased = errors.New("ผู้ต้องขังรายนี้ได้รับการปล่อยตัวแล้ว")
+	errScoreFrozen     = errors.New("คะแนนความประพฤติถูกระงับแล้ว เนื่องจากผู้ต้องขังได้รับการปล่อยตัว")
+)
+
+type ReleaseInput struct {
+	ReleaseType string `json:"ReleaseType" binding:"required"`
+	ReleaseDate string `json:"ReleaseDate"` // YYYY-MM-DD (ไม่ระบุ = วันนี้)
+	Reference   string `json:"Reference"`
+	Remarks     string `json:"Remarks"`
+}
+
+// ReleaseSummary เนื้อหาเอกสารสรุปการปล่อยตัว (เก็บเป็น JSON ใน Release.Summary)
+type ReleaseSummary struct {
+	DocumentNo       string    `json:"DocumentNo"`
+	IssuedAt         time.Time `json:"IssuedAt"`
+	Inmate_ID        string    `json:"Inmate_ID"`
+	Citizen_ID       string    `json:"Citizen_ID"`
+	FullName         string    `json:"FullName"`
+	Case_ID          string    `json:"Case_ID"`
+	ReleaseType      string    `json:"ReleaseType"`
+	ReleaseTypeLabel string    `json:"ReleaseTypeLabel"`
+	Reference        string    `json:"Reference"`
+	Remarks          string    `json:"Remarks"`
+	EntryDate        time.Time `json:"EntryDate"`
+	ReleaseDate      time.Time `json:"ReleaseDate"`
+	DaysServed       int       `json:"DaysServed"`
+
+	RoomHistory []ReleaseRoomStay `json:"RoomHistory"`
+	FinalScore  int               `json:"FinalScore"`
+	Evaluations int64             `json:"Evaluations"`
+
+	CancelledEnrollments int64  `json:"CancelledEnrollments"`
+	CancelledVisitations int64  `json:"CancelledVisitations"`
+	ProcessedBy          string `json:"ProcessedBy"`
+}
+
+type ReleaseRoomStay struct {
+	Room_Name string     `json:"Room_Name"`
+	FromDate  time.Time  `json:"FromDate"`
+	ToDate    *time.Time `json:"ToDate"`
+	Reason    string     `json:"Reason"`
+}
+
+// -------- Helpers --------
+
+// ensureScoreNotFrozen ใช้ก่อนแก้คะแนน/เพิ่มการประเมินของผู้ต้องขัง
+func ensureScoreNotFrozen(sb entity.ScoreBehavior) error {
+	if sb.Frozen {
+		return errScoreFrozen
+	}
+	return nil
+}
+
+// generateReleaseDocumentNo เลขที่เอกสาร RL-<ปี พ.ศ.>/<ลำดับ 4 หลัก> เริ่มนับใหม่ทุกปี
+func generateReleaseDocumentNo(tx *gorm.DB) (string, error) {
+	prefix := fmt.Sprintf("RL-%d/", time.Now().In(configs.Bangkok()).Year()+543)
+
+	var last entity.Release
+	err := tx.Where("document_no LIKE ?", prefix+"%").Order("document_no desc").First(&last).Error
+	next := 1
+	if err == nil {
+		n, convErr := strconv.Atoi(last.DocumentNo[len(prefix):])
+		if convErr != nil {
+			return "", fmt.Errorf("failed to parse document number: %s", last.DocumentNo)
+		}
+		next = n + 1
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", err
+	}
+	return fmt.Sprintf("%s%04d", prefix, next), nil
+}
+
+// -------- Handlers --------
+
+// POST /api/prisoners/:id/release
+func ReleasePrisoner(c *gin.Context) {
+	id := c.Param("id")
+
+	var input ReleaseInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format: " + err.Error()})
+		return
+	}
+	label, ok := releaseTypeLabels[input.ReleaseType]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ReleaseType must be one of sentence_served, parole, transfer_out, court_order"})
+		return
+	}
+	if input.ReleaseType == entity.ReleaseCourtOrder && input.Reference == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "กรุณาระบุเลขที่คำสั่งศาล (Reference)"})
+		return
+	}
+
+	now := time.Now()
+	releaseDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if input.ReleaseDate != "" {
+		d, err := time.Parse("2006-01-02", input.ReleaseDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ReleaseDate format, use YYYY-MM-DD"})
+			return
+		}
+		if d.After(releaseDate) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ไม่สามารถบันทึกการปล่อยตัวล่วงหน้าได้"})
+			return
+		}
+		releaseDate = d
+	}
+
+	db := configs.DB().WithContext(c)
+
+	var prisoner entity.Prisoner
+	if err := db.First(&prisoner, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prisoner not found"})
+		return
+	}
+	if releaseDate.Before(prisoner.EntryDate) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "วันปล่อยตัวต้องไม่ก่อนวันรับตัว"})
+		return
+	}
+
+	mid := midFromContext(c)
+	var release entity.Release
+	var cancelledVisits []entity.Visitation
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var exists int64
+		if err := tx.Model(&entity.Release{}).Where("prisoner_id = ?", prisoner.Prisoner_ID).Count(&exists).Error; err != nil {
+			return err
+		}
+		if exists > 0 {
+			return errAlreadyReleased
+		}
+
+		// 1) วันปล่อยตัว + ปิดประวัติห้อง
+		if err := tx.Model(&prisoner).Update("release_date", releaseDate).Error; err != nil {
+			return err
+		}
+		if err := closeRoomAssignment(tx, prisoner.Prisoner_ID, releaseDate); err != nil {
+			return err
+		}
+		if prisoner.Room_ID != nil {
+			if err := updateRoomStatus(tx, *prisoner.Room_ID); err != nil {
+				return err
+			}
+		}
+
+		// 2) ยกเลิกกิจกรรมที่ยังไม่จบ (status 0 = สละสิทธิ์ ตามหน้าตารางกิจกรรม)
+		// รวมที่ถูกระงับระหว่างปิดควบคุม และตัด lockdown_id ออก ไม่ให้ EndLockdown คืนสิทธิ์ให้ภายหลัง
+		resEnroll := tx.Model(&entity.Enrollment{}).
+			Where("prisoner_id = ? AND status IN ?", prisoner.Prisoner_ID, []int{enrollmentJoined, enrollmentSuspended}).
+			Where("schedule_id IN (?)", tx.Model(&entity.ActivitySchedule{}).Select("schedule_id").Where("end_date >= ?", releaseDate)).
+			Updates(map[string]interface{}{"status": 0, "remarks": "ยกเลิกเนื่องจากปล่อยตัว", "lockdown_id": nil})
+		if resEnroll.Error != nil {
+			return resEnroll.Error
+		}
+
+		// 3) ยกเลิกการเยี่ยมตั้งแต่วันนี้เป็นต้นไปที่ยังไม่เสร็จสิ้น
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC) // visit_date เก็บเป็นเที่ยงคืน UTC
+		var err error
+		cancelledVisits, err = cancelUpcomingVisitations(tx, []uint{prisoner.Prisoner_ID}, today, "ยกเลิกเนื่องจากผู้ต้องขังได้รับการปล่อยตัว")
+		if err != nil {
+			return err
+		}
+
+		// 4) ระงับคะแนนความประพฤติ
+		var sb entity.ScoreBehavior
+		if err := tx.Where("prisoner_id = ?", prisoner.Prisoner_ID).First(&sb).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		var evaluations int64
+		if sb.SID != 0 {
+			if err := tx.Model(&sb).Updates(map[string]interface{}{"frozen": true, "frozen_at": now}).Error; err != nil {
+				return err
+			}
+			tx.Model(&entity.BehaviorEvaluation{}).Where("s_id = ?", sb.SID).Count(&evaluations)
+		}
+
+		// 5) เอกสารสรุปการปล่อยตัว
+		docNo, err := generateReleaseDocumentNo(tx)
+		if err != nil {
+			return err
+		}
+		var stays []entity.RoomAssignment
+		if err := tx.Preload("Room").Where("prisoner_id = ?", prisoner.Prisoner_ID).
+			Order("from_date asc, assignment_id asc").Find(&stays).Error; err != nil {
+			return err
+		}
+		summary := ReleaseSummary{
+			DocumentNo:           docNo,
+			IssuedAt:             now,
+			Inmate_ID:            prisoner.Inmate_ID,
+			Citizen_ID:           prisoner.Citizen_ID,
+			FullName:             prisoner.FirstName + " " + prisoner.LastName,
+			Case_ID:              prisoner.Case_ID,
+			ReleaseType:          input.ReleaseType,
+			ReleaseTypeLabel:     label,
+			Reference:            input.Reference,
+			Remarks:              input.Remarks,
+			EntryDate:            prisoner.EntryDate,
+			ReleaseDate:          releaseDate,
+			DaysServed:           int(releaseDate.Sub(prisoner.EntryDate).Hours() / 24),
+			RoomHistory:          []ReleaseRoomStay{},
+			FinalScore:           sb.Score,
+			Evaluations:          evaluations,
+			CancelledEnrollments: resEnroll.RowsAffected,
+			CancelledVisitations: int64(len(cancelledVisits)),
+		}
+		for _, s := range stays {
+			stay := ReleaseRoomStay{FromDate: s.FromDate, ToDate: s.ToDate, Reason: s.Reason}
+			if s.Room != nil {
+				stay.Room_Name = s.Room.Room_Name
+			}
+			summary.RoomHistory = append(summary.RoomHistory, stay)
+		}
+		if mid != nil {
+			var m entity.Member
+			if err := tx.First(&m, "m_id = ?", *mid).Error; err == nil {
+				summary.ProcessedBy = m.FirstName + " " + m.LastName
+			}
+		}
+		doc, err := json.Marshal(summary)
+		if err != nil {
+			return err
+		}
+
+		release = entity.Release{
+			Prisoner_ID:    prisoner.Prisoner_ID,
+			ReleaseType:    input.ReleaseType,
+			ReleaseDate:    releaseDate,
+			Reference:      input.Reference,
+			Remarks:        input.Remarks,
+			DocumentNo:     docNo,
+			Summary:        doc,
+			ProcessedByMID: mid,
+		}
+		return tx.Create(&release).Error
+	})
+	if err != nil {
+		if errors.Is(err, errAlreadyReleased) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release prisoner: " + err.Error()})
+		return
+	}
+
+	for _, v := range cancelledVisits {
+		logNotifyError(notifyVisitation(configs.DB(), v, NotifyVisitCancelled, v.Cancel_Reason))
+	}
+
+	c.JSON(http.StatusCreated, release)
+}
+
+// GET /api/prisoners/:id/release  เอกสารสรุปการปล่อยตัว
+func GetPrisonerRelease(c *gin.Context) {
+	var release entity.Release
+	if err := configs.DB().Preload("ProcessedBy").
+		Where("prisoner_id = ?", c.Param("id")).First(&release).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Release record not found"})
+		return
+	}
+	c.JSON(http.StatusOK, release)
+}
+
+// GET /api/releases/upcoming?days=30
+// ผู้ต้องขังที่ครบกำหนดปล่อยภายใน N วัน และยังไม่ได้ทำเรื่องปล่อยตัว (รวมที่เลยกำหนดแล้ว)
+func GetUpcomingReleases(c *gin.Context) {
+	days := 30
+	if v := c.Query("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 3650 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 0 and 3650"})
+			return
+		}
+		days = n
+	}
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	until := today.AddDate(0, 0, days+1)
+
+	db := configs.DB()
+	var prisoners []entity.Prisoner
+	if err := db.
+		Where("release_date IS NOT NULL AND release_date < ?", until).
+		Where("prisoner_id NOT IN (?)", db.Model(&entity.Release{}).Select("prisoner_id")).
+		Order("release_date asc").
+		Find(&prisoners).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch upcoming releases"})
+		return
+	}
+
+	// โหลดชื่อห้องแยก (Preload("Room") ของ Prisoner จับคู่ผิดเพราะทั้งสองฝั่งมี Room_ID)
+	var rooms []entity.Room
+	db.Find(&rooms)
+	roomNames := map[uint]string{}
+	for _, r := range rooms {
+		roomNames[r.Room_ID] = r.Room_Name
+	}
+
+	out := make([]gin.H, 0, len(prisoners))
+	for _, p := range prisoners {
+		roomName := ""
+		if p.Room_ID != nil {
+			roomName = roomNames[*p.Room_ID]
+		}
+		daysLeft := int(p.ReleaseDate.Sub(today).Hours() / 24)
+		out = append(out, gin.H{
+			"Prisoner_ID": p.Prisoner_ID,
+			"Inmate_ID":   p.Inmate_ID,
+			"FirstName":   p.FirstName,
+			"LastName":    p.LastName,
+			"Room_Name":   roomName,
+			"ReleaseDate": p.ReleaseDate,
+			"DaysLeft":    daysLeft,
+			"Overdue":     daysLeft < 0,
+		})
+	}
+	c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+// stockLevelInput ระดับสต็อกของพัสดุ (ส่งเฉพาะที่ต้องการแก้) ใช้ร่วมกับ CreateParcel/UpdateParcel
+type stockLevelInput struct {
+	Unit         *string `json:"unit"`
+	MinLevel     *int    `json:"minLevel"`
+	ReorderPoint *int    `json:"reorderPoint"`
+	MaxLevel     *int    `json:"maxLevel"`
+}
+
+// apply ใส่ค่าที่ส่งมาลงใน parcel แล้วตรวจว่า 0 <= MinLevel <= ReorderPoint <= MaxLevel (MaxLevel 0 = ไม่กำหนด)
+func (in stockLevelInput) apply(p *entity.Parcel) error {
+	if in.Unit != nil {
+		unit := strings.TrimSpace(*in.Unit)
+		if unit == "" {
+			return errors.New("unit cannot be empty")
+		}
+		p.Unit = unit
+	}
+	if in.MinLevel != nil {
+		p.MinLevel = *in.MinLevel
+	}
+	if in.ReorderPoint != nil {
+		p.ReorderPoint = *in.ReorderPoint
+	}
+	if in.MaxLevel != nil {
+		p.MaxLevel = *in.MaxLevel
+	}
+	if p.MinLevel < 0 || p.ReorderPoint < 0 || p.MaxLevel < 0 {
+		return errors.New("stock levels must be >= 0")
+	}
+	if p.MinLevel > p.ReorderPoint {
+		return errors.New("minLevel must not exceed reorderPoint")
+	}
+	if p.MaxLevel > 0 && p.ReorderPoint >= p.MaxLevel {
+		return errors.New("reorderPoint must be less than maxLevel")
+	}
+	return nil
+}
+
+// dailyUsage อัตราเบิกเฉลี่ยต่อวันของแต่ละพัสดุ จากประวัติ Operation ที่เป็นการเบิกในช่วง window วันล่าสุด
+func dailyUsage(db *gorm.DB, window int, now time.Time) (map[int]float64, error) {
+	var rows []struct {
+		PID    int
+		Issued int
+	}
+	if err := db.Model(&entity.Operation{}).
+		Select("p_id AS p_id, SUM(-change_amount) AS issued").
+		Where("operator_id = ? AND date_time >= ?", operatorIssue, now.AddDate(0, 0, -window)).
+		Group("p_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	usage := make(map[int]float64, len(rows))
+	for _, r := range rows {
+		if r.Issued > 0 {
+			usage[r.PID] = float64(r.Issued) / float64(window)
+		}
+	}
+	return usage, nil
+}
+
+// onOrderQuantities จำนวนที่สั่งซื้อไปแล้วแต่ยังไม่ได้รับ แยกตามพัสดุ (ใบสั่งซื้อที่รอรับของ)
+func onOrderQuantities(db *gorm.DB) (map[int]int, error) {
+	var rows []struct {
+		PID     int
+		OnOrder int
+	}
+	if err := db.Model(&entity.PurchaseOrderLine{}).
+		Select("purchase_order_lines.p_id AS p_id, SUM(MAX(quantity_ordered - quantity_received, 0)) AS on_order").
+		Joins("JOIN purchase_orders ON purchase_orders.id = purchase_order_lines.purchase_order_id").
+		Where("purchase_orders.status IN ?", []string{entity.POOrdered, entity.POPartiallyReceived}).
+		Group("purchase_order_lines.p_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[int]int, len(rows))
+	for _, r := range rows {
+		out[r.PID] = r.OnOrder
+	}
+	return out, nil
+}
+
+type reorderSuggestion struct {
+	PID               int      `json:"PID"`
+	ParcelName        string   `json:"ParcelName"`
+	Type              string   `json:"Type"`
+	Unit              string   `json:"Unit"`
+	Quantity          int      `json:"Quantity"`
+	Available         int      `json:"Available"` // ไม่นับล็อตหมดอายุ ใช้คำนวณทั้งหมดด้านล่าง
+	Reserved          int      `json:"Reserved"`
+	OnOrder           int      `json:"OnOrder"` // สั่งซื้อแล้วยังไม่ได้รับ
+	Status            string   `json:"Status"`
+	MinLevel          int      `json:"MinLevel"`
+	ReorderPoint      int      `json:"ReorderPoint"`
+	MaxLevel          int      `json:"MaxLevel"`
+	AvgDailyUsage     float64  `json:"AvgDailyUsage"`
+	DaysUntilStockout *float64 `json:"DaysUntilStockout"` // nil = ไม่มีการเบิกในช่วงที่คำนวณ
+	BelowMin          bool     `json:"BelowMin"`
+	SuggestedQuantity int      `json:"SuggestedQuantity"`
+}
+
+// suggestReorder คำนวณจำนวนที่ควรสั่งของพัสดุหนึ่งรายการ ภายในช่วง horizon วันข้างหน้า
+// ต้องสั่งเมื่อคงเหลือที่คาดว่าจะเหลือตอนสิ้นช่วง <= ReorderPoint; สั่งให้ถึง MaxLevel
+// (ไม่กำหนด MaxLevel = ReorderPoint + ปริมาณที่คาดว่าจะใช้ใน horizon วัน)
+func suggestReorder(p entity.Parcel, usage float64, onOrder, horizon int) reorderSuggestion {
+	s := reorderSuggestion{
+		PID:           p.PID,
+		ParcelName:    p.ParcelName,
+		Type:          p.Type.Type,
+		Unit:          p.Unit,
+		Quantity:      p.Quantity,
+		Available:     p.Available,
+		Reserved:      p.Reserved,
+		OnOrder:       onOrder,
+		Status:        p.Status,
+		MinLevel:      p.MinLevel,
+		ReorderPoint:  p.ReorderPoint,
+		MaxLevel:      p.MaxLevel,
+		AvgDailyUsage: math.Round(usage*100) / 100,
+		BelowMin:      p.Available < p.MinLevel,
+	}
+	if usage > 0 {
+		days := math.Round(float64(p.Available)/usage*10) / 10
+		s.DaysUntilStockout = &days
+	}
+
+	// ส่วนที่จองให้คำขอเบิกที่อนุมัติแล้วถือว่าใช้ไปแล้ว ส่วนที่สั่งซื้อค้างรับถือว่าจะเข้ามา ล็อตหมดอายุไม่นับ
+	onHand := p.Available - p.Reserved + onOrder
+	need := int(math.Ceil(usage * float64(horizon)))
+	if onHand-need > p.ReorderPoint {
+		return s
+	}
+	target := p.MaxLevel
+	if target == 0 {
+		target = p.ReorderPoint + need
+	}
+	if target > onHand {
+		s.SuggestedQuantity = target - onHand
+	}
+	return s
+}
+
+// -------- Handlers --------
+
+// GET /api/parcels/reorder-suggestions?days=7&window=30&all=false
+// days   = ช่วงเวลาที่ต้องการให้ของพอใช้ (รอบสั่งซื้อ, ค่าเริ่มต้น 7 วัน)
+// window = จำนวนวันย้อนหลังที่ใช้คำนวณอัตราเบิกเฉลี่ย (ค่าเริ่มต้น 30 วัน)
+// all    = true แสดงทุกรายการพร้อมอัตราเบิก/วันที่คาดว่าจะหมด แม้ยังไม่ต้องสั่ง
+func GetReorderSuggestions(c *gin.Context) {
+	horizon, window := 7, 30
+	for _, q := range []struct {
+		name string
+		dst  *int
+	}{{"days", &horizon}, {"window", &window}} {
+		if v := c.Query(q.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 || n > 365 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": q.name + " must be between 1 and 365"})
+				return
+			}
+			*q.dst = n
+		}
+	}
+	all := c.Query("all") == "true" || c.Query("all") == "1"
+
+	db := configs.DB()
+	usage, err := dailyUsage(db, window, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute consumption"})
+		return
+	}
+	onOrder, err := onOrderQuantities(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch open purchase orders"})
+		return
+	}
+	var parcels []entity.Parcel
+	if err := db.Preload("Type").Find(&parcels).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch parcels"})
+		return
+	}
+
+	out := make([]reorderSuggestion, 0, len(parcels))
+	for _, p := range parcels {
+		s := suggestReorder(p, usage[p.PID], onOrder[p.PID], horizon)
+		if all || s.SuggestedQuantity > 0 {
+			out = append(out, s)
+		}
+	}
+	// ใกล้หมดเร็วที่สุดก่อน รายการที่ไม่มีการเบิกไว้ท้าย
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].DaysUntilStockout, out[j].DaysUntilStockout
+		switch {
+		case a != nil && b != nil:
+			return *a < *b
+		case a != nil || b != nil:
+			return a != nil
+		}
+		return out[i].Available < out[j].Available
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"days":   horizon,
+		"window": window,
+		"items":  out,
+	})
+}
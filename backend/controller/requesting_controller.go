@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -13,29 +14,46 @@ import (
 	"gorm.io/gorm"
 )
 
+// RequestingLineInput - One parcel line of a requisition
+type RequestingLineInput struct {
+	PID      *uint `json:"PID" binding:"required"`
+	Quantity uint  `json:"Quantity" binding:"required,min=1"`
+}
+
 // RequestingInput - Struct for receiving JSON from Frontend (for creating/editing main data)
 type RequestingInput struct {
 	// Requesting_NO is generated by the server, so it's removed from input.
-	PID            *uint  `json:"PID" binding:"required"`
-	Amount_Request uint   `json:"Amount_Request" binding:"required,min=1"`
-	Request_Date   string `json:"Request_Date" binding:"required"`
-	Staff_ID       *uint  `json:"Staff_ID" binding:"required"`
+	// Send Lines for a multi-item requisition, or PID + Amount_Request for a single item (old form).
+	Lines          []RequestingLineInput `json:"Lines" binding:"omitempty,dive"`
+	PID            *uint                 `json:"PID"`
+	Amount_Request uint                  `json:"Amount_Request"`
+	Request_Date   string                `json:"Request_Date" binding:"required"`
+	Staff_ID       *uint                 `json:"Staff_ID" binding:"required"`
+}
+
+// LineQuantityInput - Quantity for one line when approving (approved) or completing (issued)
+type LineQuantityInput struct {
+	Line_ID  uint  `json:"Line_ID" binding:"required"`
+	Quantity *uint `json:"Quantity" binding:"required"`
 }
 
 // StatusUpdateInput - Struct for receiving JSON (for updating status only)
 type StatusUpdateInput struct {
 	Status_ID *uint `json:"Status_ID" binding:"required"`
+	// อนุมัติ = จำนวนที่อนุมัติรายบรรทัด, สำเร็จ = จำนวนที่จ่ายจริง; บรรทัดที่ไม่ส่ง = เต็มจำนวนที่ขอ/ที่อนุมัติ
+	Lines []LineQuantityInput `json:"Lines" binding:"omitempty,dive"`
 }
 
+var errRequestingChanged = errors.New("คำร้องนี้ถูกเปลี่ยนสถานะไปแล้ว กรุณาโหลดข้อมูลใหม่")
+
 // --- Helper Function ---
 
 // generateNextRequestNo генерує наступний номер запиту на основі останнього запису в БД за поточний рік.
 // Він розроблений, щоб бути безпечним для транзакцій, приймаючи дескриптор *gorm.DB.
 func generateNextRequestNo(db *gorm.DB) (string, error) {
 	var latestRequesting entity.Requesting
-	loc, _ := time.LoadLocation("Asia/Bangkok")
 	// Отримати поточний рік за буддійською ерою (พ.ศ.)
-	currentYear := time.Now().In(loc).Year() + 543
+	currentYear := time.Now().In(configs.Bangkok()).Year() + 543
 
 	// Запит на останній запит у поточному буддійському році.
 	// Ми сортуємо за requesting_no за спаданням і беремо перший.
@@ -69,15 +87,80 @@ func generateNextRequestNo(db *gorm.DB) (string, error) {
 }
 
 
+// buildRequestingLines - Validates the input lines (or the single PID/Amount_Request) against existing parcels
+func buildRequestingLines(db *gorm.DB, in RequestingInput) ([]entity.RequestingLine, error) {
+	items := in.Lines
+	if len(items) == 0 {
+		if in.PID == nil || in.Amount_Request == 0 {
+			return nil, fmt.Errorf("ต้องระบุรายการพัสดุอย่างน้อย 1 รายการ")
+		}
+		items = []RequestingLineInput{{PID: in.PID, Quantity: in.Amount_Request}}
+	}
+	seen := map[uint]bool{}
+	lines := make([]entity.RequestingLine, 0, len(items))
+	for _, it := range items {
+		if seen[*it.PID] {
+			return nil, fmt.Errorf("พัสดุรหัส %d ซ้ำกันในใบเบิก", *it.PID)
+		}
+		seen[*it.PID] = true
+		var parcel entity.Parcel
+		if err := db.Select("p_id").First(&parcel, *it.PID).Error; err != nil {
+			return nil, fmt.Errorf("ไม่พบพัสดุรหัส %d", *it.PID)
+		}
+		lines = append(lines, entity.RequestingLine{PID: *it.PID, Quantity_Requested: it.Quantity})
+	}
+	return lines, nil
+}
+
+// lineQuantities - Resolves the per-line quantity for approving (≤ requested) or completing (≤ approved)
+func lineQuantities(r entity.Requesting, to uint, in []LineQuantityInput) (map[uint]uint, error) {
+	given := map[uint]uint{}
+	for _, l := range in {
+		given[l.Line_ID] = *l.Quantity
+	}
+	out := map[uint]uint{}
+	var total uint
+	for _, line := range r.Lines {
+		limit := line.Quantity_Requested
+		if to == statusCompleted {
+			limit = line.Quantity_Approved
+		}
+		q, ok := given[line.Line_ID]
+		if !ok {
+			q = limit
+		}
+		if q > limit {
+			return nil, fmt.Errorf("รายการ %d: จำนวน %d เกินกว่า %d", line.Line_ID, q, limit)
+		}
+		delete(given, line.Line_ID)
+		out[line.Line_ID] = q
+		total += q
+	}
+	for id := range given {
+		return nil, fmt.Errorf("ไม่พบรายการ %d ในใบเบิกนี้", id)
+	}
+	if to == statusApproved && total == 0 {
+		return nil, fmt.Errorf("ต้องอนุมัติอย่างน้อย 1 รายการ (ถ้าไม่อนุมัติทั้งใบให้ใช้สถานะไม่อนุมัติ)")
+	}
+	return out, nil
+}
+
+// stockChange - Parcel after a requesting moved its stock, with the status before (for low-stock notification)
+type stockChange struct {
+	Parcel    entity.Parcel
+	OldStatus string
+}
+
 // --- API Handlers ---
 
 // GetRequestings - Fetches all requesting records
 func GetRequestings(c *gin.Context) {
 	var requestings []entity.Requesting
-	if err := configs.DB().
+	if err := configs.DB().WithContext(c).
 		Preload("Parcel").
 		Preload("Staff").
 		Preload("Status").
+		Preload("Lines.Parcel").
 		Order("requesting_no desc"). // Order by newest first
 		Find(&requestings).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -86,9 +169,47 @@ func GetRequestings(c *gin.Context) {
 	c.JSON(http.StatusOK, requestings)
 }
 
+// requestingLineDetail - A line with the quantity that can still be reserved right now
+type requestingLineDetail struct {
+	entity.RequestingLine
+	Available int `json:"Available"`
+}
+
+// GetRequesting - Fetches one requisition with its full line breakdown and totals
+func GetRequesting(c *gin.Context) {
+	db := configs.DB()
+	var requesting entity.Requesting
+	if err := db.Preload("Parcel").Preload("Staff").Preload("Status").Preload("Lines.Parcel").
+		First(&requesting, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Requesting not found"})
+		return
+	}
+
+	lines := make([]requestingLineDetail, 0, len(requesting.Lines))
+	var requested, approved, issued uint
+	for _, l := range requesting.Lines {
+		free, err := freeStock(db, l.Parcel)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		lines = append(lines, requestingLineDetail{RequestingLine: l, Available: max(free, 0)})
+		requested += l.Quantity_Requested
+		approved += l.Quantity_Approved
+		issued += l.Quantity_Issued
+	}
+	c.JSON(http.StatusOK, struct {
+		entity.Requesting
+		Lines           []requestingLineDetail
+		Total_Requested uint
+		Total_Approved  uint
+		Total_Issued    uint
+	}{requesting, lines, requested, approved, issued})
+}
+
 // GetNextRequestNo - Generates the next request number (XXXX/YYYY)
 func GetNextRequestNo(c *gin.Context) {
-	newRequestNo, err := generateNextRequestNo(configs.DB())
+	newRequestNo, err := generateNextRequestNo(configs.DB().WithContext(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -110,8 +231,14 @@ func CreateRequesting(c *gin.Context) {
 		return
 	}
 
+	lines, err := buildRequestingLines(configs.DB(), input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Start a new database transaction
-	tx := configs.DB().Begin()
+	tx := configs.DB().WithContext(c).Begin()
 	if tx.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start transaction"})
 		return
@@ -130,11 +257,13 @@ func CreateRequesting(c *gin.Context) {
 
 	requesting := entity.Requesting{
 		Requesting_NO:  newRequestNo,
-		PID:            input.PID,
-		Amount_Request: input.Amount_Request,
+		PID:            &lines[0].PID,
+		Amount_Request: lines[0].Quantity_Requested,
+		Lines:          lines,
 		Request_Date:   requestDate,
 		StaffID:        input.Staff_ID,
 		Status_ID:      &statusID,
+		RequestedByMID: midFromContext(c),
 	}
 
 	if err := tx.Create(&requesting).Error; err != nil {
@@ -151,7 +280,7 @@ func CreateRequesting(c *gin.Context) {
 	}
 
 	// Preload associations for the response
-	configs.DB().Preload("Parcel").Preload("Staff").Preload("Status").First(&requesting, requesting.Requesting_ID)
+	configs.DB().WithContext(c).Preload("Parcel").Preload("Staff").Preload("Status").Preload("Lines.Parcel").First(&requesting, requesting.Requesting_ID)
 	c.JSON(http.StatusCreated, requesting)
 }
 
@@ -159,7 +288,7 @@ func CreateRequesting(c *gin.Context) {
 func UpdateRequesting(c *gin.Context) {
 	id := c.Param("id")
 	var requesting entity.Requesting
-	if err := configs.DB().First(&requesting, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&requesting, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Requesting not found"})
 		return
 	}
@@ -182,27 +311,115 @@ func UpdateRequesting(c *gin.Context) {
 		return
 	}
 
+	lines, err := buildRequestingLines(configs.DB(), input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	updateData := map[string]interface{}{
-		"PID":            input.PID,
-		"Amount_Request": input.Amount_Request,
+		"PID":            lines[0].PID,
+		"Amount_Request": lines[0].Quantity_Requested,
 		"Request_Date":   requestDate,
 		"Staff_ID":       input.Staff_ID,
 	}
 
-	if err := configs.DB().Model(&requesting).Updates(updateData).Error; err != nil {
+	// รายการทั้งหมดถูกแทนที่ด้วยชุดที่ส่งมา
+	err = configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&requesting).Updates(updateData).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("requesting_id = ?", requesting.Requesting_ID).Delete(&entity.RequestingLine{}).Error; err != nil {
+			return err
+		}
+		for i := range lines {
+			lines[i].Requesting_ID = requesting.Requesting_ID
+		}
+		return tx.Create(&lines).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update requesting: " + err.Error()})
 		return
 	}
 
-	configs.DB().Preload("Parcel").Preload("Staff").Preload("Status").First(&requesting, id)
+	configs.DB().WithContext(c).Preload("Parcel").Preload("Staff").Preload("Status").Preload("Lines.Parcel").First(&requesting, id)
 	c.JSON(http.StatusOK, requesting)
 }
 
-// UpdateRequestingStatus - Updates only the status of a requesting record
+// requestingTransitions - Allowed status changes: pending→approved→completed, pending→rejected
+// (an approved request that is no longer needed is deleted, which releases the reservation)
+var requestingTransitions = map[uint][]uint{
+	statusPending:  {statusApproved, statusRejected},
+	statusApproved: {statusCompleted},
+}
+
+func canTransitionRequesting(from, to uint) bool {
+	for _, next := range requestingTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRequestingStock - Moves stock line by line for a status change: approve reserves the approved quantity,
+// complete releases the reservation and issues via FEFO (same path as ReduceParcel), reject releases the reservation
+// of an approved request (used when it is deleted).
+// r must have Lines loaded; qty comes from lineQuantities (nil for reject).
+func applyRequestingStock(tx *gorm.DB, r entity.Requesting, to uint, qty map[uint]uint, mid int) ([]stockChange, error) {
+	from := uint(statusPending)
+	if r.Status_ID != nil {
+		from = *r.Status_ID
+	}
+	var changes []stockChange
+	for _, line := range r.Lines {
+		var parcel entity.Parcel
+		if err := tx.First(&parcel, line.PID).Error; err != nil {
+			return nil, err
+		}
+		old := parcel.Status
+		updates := map[string]any{}
+		switch to {
+		case statusApproved:
+			q := qty[line.Line_ID]
+			if err := reserveStock(tx, &parcel, int(q)); err != nil {
+				return nil, fmt.Errorf("%s: %w", parcel.ParcelName, err)
+			}
+			updates["quantity_approved"] = q
+		case statusCompleted:
+			q := qty[line.Line_ID]
+			if err := reserveStock(tx, &parcel, -int(line.Quantity_Approved)); err != nil {
+				return nil, err
+			}
+			if q > 0 {
+				if _, err := issueStock(tx, &parcel, int(q), operatorIssue, mid, false); err != nil {
+					return nil, fmt.Errorf("%s: %w", parcel.ParcelName, err)
+				}
+			}
+			updates["quantity_issued"] = q
+		case statusRejected:
+			if from != statusApproved {
+				continue
+			}
+			if err := reserveStock(tx, &parcel, -int(line.Quantity_Approved)); err != nil {
+				return nil, err
+			}
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&entity.RequestingLine{}).Where("line_id = ?", line.Line_ID).Updates(updates).Error; err != nil {
+				return nil, err
+			}
+		}
+		changes = append(changes, stockChange{Parcel: parcel, OldStatus: old})
+	}
+	return changes, nil
+}
+
+// UpdateRequestingStatus - Updates the status of a requesting record and moves stock accordingly
 func UpdateRequestingStatus(c *gin.Context) {
 	id := c.Param("id")
 	var requesting entity.Requesting
-	if err := configs.DB().First(&requesting, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).Preload("Lines").First(&requesting, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Requesting not found"})
 		return
 	}
@@ -214,17 +431,63 @@ func UpdateRequestingStatus(c *gin.Context) {
 	}
 
 	var status entity.Status
-	if err := configs.DB().First(&status, *input.Status_ID).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&status, *input.Status_ID).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Status ID"})
 		return
 	}
 
-	if err := configs.DB().Model(&requesting).Update("status_id", input.Status_ID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update requesting status"})
+	from := uint(statusPending)
+	if requesting.Status_ID != nil {
+		from = *requesting.Status_ID
+	}
+	if !canTransitionRequesting(from, status.Status_ID) {
+		var current entity.Status
+		configs.DB().First(&current, from)
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("ไม่สามารถเปลี่ยนสถานะจาก %s เป็น %s ได้", current.Status, status.Status)})
+		return
+	}
+
+	var qty map[uint]uint
+	if status.Status_ID == statusApproved || status.Status_ID == statusCompleted {
+		var err error
+		if qty, err = lineQuantities(requesting, status.Status_ID, input.Lines); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var changes []stockChange
+	err := configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		// เปลี่ยนสถานะแบบมีเงื่อนไข กันสองคำขอเปลี่ยนสถานะเดียวกันพร้อมกันแล้วตัดสต็อกซ้ำ
+		res := tx.Model(&entity.Requesting{}).
+			Where("requesting_id = ? AND status_id = ?", requesting.Requesting_ID, from).
+			Update("status_id", status.Status_ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errRequestingChanged
+		}
+		var err error
+		changes, err = applyRequestingStock(tx, requesting, status.Status_ID, qty, midFromContextInt(c))
+		return err
+	})
+	if errors.Is(err, errRequestingChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(stockErrorStatus(err), gin.H{"error": "Failed to update requesting status: " + err.Error()})
 		return
 	}
 
-	configs.DB().Preload("Parcel").Preload("Staff").Preload("Status").First(&requesting, id)
+	configs.DB().WithContext(c).Preload("Parcel").Preload("Staff").Preload("Status").Preload("Lines.Parcel").First(&requesting, id)
+	logNotifyError(notifyRequestingStatus(configs.DB(), requesting))
+	if status.Status_ID == statusCompleted {
+		for _, ch := range changes {
+			logNotifyError(notifyStockLow(configs.DB(), ch.Parcel, ch.OldStatus))
+		}
+	}
 	c.JSON(http.StatusOK, requesting)
 }
 
@@ -232,7 +495,7 @@ func UpdateRequestingStatus(c *gin.Context) {
 func DeleteRequesting(c *gin.Context) {
 	id := c.Param("id")
 	var requesting entity.Requesting
-	if err := configs.DB().First(&requesting, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).Preload("Lines").First(&requesting, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Requesting not found"})
 		return
 	}
@@ -243,7 +506,19 @@ func DeleteRequesting(c *gin.Context) {
 	// 	return
 	// }
 
-	if err := configs.DB().Delete(&entity.Requesting{}, id).Error; err != nil {
+	// ลบคำขอที่อนุมัติแล้ว (ยังไม่จ่าย) ต้องปลดของที่จองไว้คืน
+	err := configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if requesting.Status_ID != nil && *requesting.Status_ID == statusApproved {
+			if _, err := applyRequestingStock(tx, requesting, statusRejected, nil, midFromContextInt(c)); err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("requesting_id = ?", requesting.Requesting_ID).Delete(&entity.RequestingLine{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&entity.Requesting{}, id).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete requesting"})
 		return
 	}
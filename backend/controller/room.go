@@ -1,18 +1,76 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sa-project/configs"
 	"github.com/sa-project/entity"
+	"gorm.io/gorm"
 )
 
 // --- Room Handlers ---
 
 type RoomInput struct {
-	Room_Name   string `json:"Room_Name" binding:"required"`
-	Room_Status string `json:"Room_Status"`
+	Room_Name      string `json:"Room_Name" binding:"required"`
+	Room_Status    string `json:"Room_Status"`
+	Capacity       *int   `json:"Capacity"` // ไม่ส่ง = 2 คน (ค่าเดิมของระบบ)
+	Gender_ID      *uint  `json:"Gender_ID"`
+	Is_Mixed       bool   `json:"Is_Mixed"`
+	Security_Level string `json:"Security_Level"`
+	Building       string `json:"Building"`
+	Wing           string `json:"Wing"`
+}
+
+// RoomUpdateInput แก้ไขห้อง: ส่งเฉพาะฟิลด์ที่ต้องการแก้ ฟิลด์ที่ไม่ส่งคงค่าเดิม
+type RoomUpdateInput struct {
+	Room_Name      *string `json:"Room_Name"`
+	Capacity       *int    `json:"Capacity"`
+	Gender_ID      *uint   `json:"Gender_ID"`
+	Is_Mixed       *bool   `json:"Is_Mixed"`
+	Security_Level *string `json:"Security_Level"`
+	Building       *string `json:"Building"`
+	Wing           *string `json:"Wing"`
+}
+
+func uintPtrEqual(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// validateRoomInput ตรวจความจุและเพศของห้อง
+// ถ้าไม่ระบุเพศ จะอนุมานจากตัวอักษรแรกของชื่อห้อง (M = ชาย, F = หญิง) ตามกติกาเดิม
+func validateRoomInput(db *gorm.DB, input *RoomInput) error {
+	if input.Capacity != nil && *input.Capacity < 1 {
+		return errors.New("ความจุห้องต้องมากกว่า 0")
+	}
+	if input.Is_Mixed && input.Gender_ID != nil {
+		return errors.New("ห้องรวมทุกเพศต้องไม่ระบุ Gender_ID")
+	}
+	if !input.Is_Mixed && input.Gender_ID == nil {
+		var genderID uint
+		switch {
+		case strings.HasPrefix(input.Room_Name, "M"):
+			genderID = 1
+		case strings.HasPrefix(input.Room_Name, "F"):
+			genderID = 2
+		default:
+			return errors.New("กรุณาระบุเพศของห้อง (Gender_ID) หรือกำหนดเป็นห้องรวม (Is_Mixed)")
+		}
+		input.Gender_ID = &genderID
+	}
+	if input.Gender_ID != nil {
+		if err := db.First(&entity.Gender{}, *input.Gender_ID).Error; err != nil {
+			return errors.New("ไม่พบข้อมูลเพศที่ระบุ")
+		}
+	}
+	return nil
 }
 
 // CreateRoom - สร้างห้องใหม่
@@ -22,13 +80,28 @@ func CreateRoom(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format: " + err.Error()})
 		return
 	}
+	if err := validateRoomInput(configs.DB(), &input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	capacity := 2
+	if input.Capacity != nil {
+		capacity = *input.Capacity
+	}
 
 	room := entity.Room{
-		Room_Name:   input.Room_Name,
-		Room_Status: "ว่าง", // กำหนดสถานะเป็น "ว่าง" อัตโนมัติ
+		Room_Name:      input.Room_Name,
+		Room_Status:    "ว่าง", // กำหนดสถานะเป็น "ว่าง" อัตโนมัติ
+		Capacity:       capacity,
+		Gender_ID:      input.Gender_ID,
+		Is_Mixed:       input.Is_Mixed,
+		Security_Level: input.Security_Level,
+		Building:       input.Building,
+		Wing:           input.Wing,
 	}
 
-	if err := configs.DB().Create(&room).Error; err != nil {
+	if err := configs.DB().WithContext(c).Create(&room).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create room: " + err.Error()})
 		return
 	}
@@ -39,7 +112,7 @@ func CreateRoom(c *gin.Context) {
 // GetRooms - ดึงข้อมูลห้องทั้งหมด
 func GetRooms(c *gin.Context) {
 	var rooms []entity.Room
-	if err := configs.DB().Order("room_name asc").Find(&rooms).Error; err != nil {
+	if err := configs.DB().WithContext(c).Order("room_name asc").Find(&rooms).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rooms"})
 		return
 	}
@@ -50,22 +123,118 @@ func GetRooms(c *gin.Context) {
 func UpdateRoom(c *gin.Context) {
 	id := c.Param("id")
 	var room entity.Room
-	if err := configs.DB().First(&room, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&room, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
 		return
 	}
 
-	var input RoomInput
+	var input RoomUpdateInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format: " + err.Error()})
 		return
 	}
 
-	if err := configs.DB().Model(&room).Update("room_name", input.Room_Name).Error; err != nil {
+	// รวมค่าที่ส่งมากับค่าปัจจุบันของห้อง แล้วตรวจทั้งชุด
+	merged := RoomInput{
+		Room_Name:      room.Room_Name,
+		Capacity:       &room.Capacity,
+		Gender_ID:      room.Gender_ID,
+		Is_Mixed:       room.Is_Mixed,
+		Security_Level: room.Security_Level,
+		Building:       room.Building,
+		Wing:           room.Wing,
+	}
+	updates := map[string]interface{}{}
+	if input.Room_Name != nil {
+		merged.Room_Name = *input.Room_Name
+		updates["room_name"] = *input.Room_Name
+	}
+	if input.Capacity != nil {
+		merged.Capacity = input.Capacity
+		updates["capacity"] = *input.Capacity
+	}
+	// ตั้งเป็นห้องรวม = ล้างเพศ, ระบุเพศ = ไม่ใช่ห้องรวม (ใช้ map เพื่อให้ตั้ง Gender_ID = NULL / Is_Mixed = false ได้)
+	if input.Is_Mixed != nil {
+		merged.Is_Mixed = *input.Is_Mixed
+		if *input.Is_Mixed && input.Gender_ID == nil {
+			merged.Gender_ID = nil
+		}
+	}
+	if input.Gender_ID != nil {
+		merged.Gender_ID = input.Gender_ID
+		if input.Is_Mixed == nil {
+			merged.Is_Mixed = false
+		}
+	}
+	if input.Security_Level != nil {
+		merged.Security_Level = *input.Security_Level
+		updates["security_level"] = *input.Security_Level
+	}
+	if input.Building != nil {
+		merged.Building = *input.Building
+		updates["building"] = *input.Building
+	}
+	if input.Wing != nil {
+		merged.Wing = *input.Wing
+		updates["wing"] = *input.Wing
+	}
+	if strings.TrimSpace(merged.Room_Name) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Room_Name is required"})
+		return
+	}
+	if err := validateRoomInput(configs.DB(), &merged); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Is_Mixed != nil || input.Gender_ID != nil || !uintPtrEqual(merged.Gender_ID, room.Gender_ID) {
+		updates["gender_id"] = merged.Gender_ID
+		updates["is_mixed"] = merged.Is_Mixed
+	}
+	capacity := *merged.Capacity
+
+	// invalid = เหตุที่แก้ไขไม่ได้จากข้อมูลในห้อง (400) ส่วน error อื่นจาก transaction เป็นข้อผิดพลาดภายใน (500)
+	var invalid error
+	err := configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		// ห้ามลดความจุให้ต่ำกว่าจำนวนคนที่อยู่จริง
+		count, err := countActivePrisoners(tx, room.Room_ID)
+		if err != nil {
+			return err
+		}
+		if int64(capacity) < count {
+			invalid = fmt.Errorf("ไม่สามารถลดความจุเหลือ %d ได้ เนื่องจากมีผู้ต้องขังอยู่ %d คน", capacity, count)
+			return invalid
+		}
+		// ห้ามเปลี่ยนเพศของห้องถ้ายังมีผู้ต้องขังเพศอื่นอยู่
+		if !merged.Is_Mixed && merged.Gender_ID != nil {
+			var mismatched int64
+			if err := tx.Model(&entity.Prisoner{}).
+				Where("room_id = ? AND gender_id <> ? AND (release_date IS NULL OR release_date > ?)", room.Room_ID, *merged.Gender_ID, time.Now()).
+				Count(&mismatched).Error; err != nil {
+				return err
+			}
+			if mismatched > 0 {
+				invalid = errors.New("ไม่สามารถเปลี่ยนเพศของห้องได้ เนื่องจากมีผู้ต้องขังเพศอื่นอยู่ในห้อง")
+				return invalid
+			}
+		}
+
+		if len(updates) > 0 {
+			if err := tx.Model(&room).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return updateRoomStatus(tx, room.Room_ID)
+	})
+	if invalid != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": invalid.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update room"})
 		return
 	}
 
+	configs.DB().First(&room, room.Room_ID)
 	c.JSON(http.StatusOK, room)
 }
 
@@ -74,13 +243,13 @@ func DeleteRoom(c *gin.Context) {
 	id := c.Param("id")
 
 	var count int64
-	configs.DB().Model(&entity.Prisoner{}).Where("room_id = ?", id).Count(&count)
+	configs.DB().WithContext(c).Model(&entity.Prisoner{}).Where("room_id = ?", id).Count(&count)
 	if count > 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ไม่สามารถลบห้องได้ เนื่องจากยังมีนักโทษอยู่ในห้องนี้"})
 		return
 	}
 
-	if err := configs.DB().Delete(&entity.Room{}, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).Delete(&entity.Room{}, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete room"})
 		return
 	}
@@ -0,0 +1,242 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+type TransferInput struct {
+	Room_ID *uint  `json:"Room_ID" binding:"required"`
+	Reason  string `json:"Reason"  binding:"required"`
+}
+
+// -------- Helpers --------
+
+// countActivePrisoners นับผู้ต้องขังที่ยังคุมขังอยู่ในห้อง (ยังไม่ถึงวันปล่อยตัว)
+func countActivePrisoners(tx *gorm.DB, roomID uint) (int64, error) {
+	var count int64
+	err := tx.Model(&entity.Prisoner{}).
+		Where("room_id = ? AND (release_date IS NULL OR release_date > ?)", roomID, time.Now()).
+		Count(&count).Error
+	return count, err
+}
+
+// openRoomAssignment ปิดประวัติห้องเดิม (ถ้ามี) แล้วเปิดประวัติห้องใหม่ตั้งแต่เวลา at
+func openRoomAssignment(tx *gorm.DB, prisonerID, roomID uint, at time.Time, reason string, approvedBy *int) error {
+	if err := closeRoomAssignment(tx, prisonerID, at); err != nil {
+		return err
+	}
+	assignment := entity.RoomAssignment{
+		Prisoner_ID:   prisonerID,
+		Room_ID:       roomID,
+		FromDate:      at,
+		Reason:        reason,
+		ApprovedByMID: approvedBy,
+	}
+	if err := tx.Create(&assignment).Error; err != nil {
+		return fmt.Errorf("failed to create room assignment: %w", err)
+	}
+	return nil
+}
+
+// closeRoomAssignment ปิดประวัติห้องปัจจุบันของผู้ต้องขัง (to_date = at)
+func closeRoomAssignment(tx *gorm.DB, prisonerID uint, at time.Time) error {
+	if err := tx.Model(&entity.RoomAssignment{}).
+		Where("prisoner_id = ? AND to_date IS NULL", prisonerID).
+		Update("to_date", at).Error; err != nil {
+		return fmt.Errorf("failed to close room assignment: %w", err)
+	}
+	return nil
+}
+
+// errRoomLocked ห้องต้นทางหรือปลายทางอยู่ระหว่างปิดควบคุมพิเศษ (ใช้ภายใน transaction ของการย้ายห้อง)
+var errRoomLocked = errors.New("room is under lockdown")
+
+// -------- Handlers --------
+
+// POST /api/prisoners/:id/transfer  { "Room_ID": 3, "Reason": "..." }
+func TransferPrisoner(c *gin.Context) {
+	id := c.Param("id")
+
+	var input TransferInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format: " + err.Error()})
+		return
+	}
+
+	var prisoner entity.Prisoner
+	if err := configs.DB().WithContext(c).First(&prisoner, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prisoner not found"})
+		return
+	}
+	if prisoner.ReleaseDate != nil && !prisoner.ReleaseDate.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ไม่สามารถย้ายห้องได้ เนื่องจากผู้ต้องขังพ้นโทษแล้ว"})
+		return
+	}
+	if prisoner.Room_ID != nil && *prisoner.Room_ID == *input.Room_ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ผู้ต้องขังอยู่ในห้องนี้อยู่แล้ว"})
+		return
+	}
+	if prisoner.Gender_ID != nil {
+		if err := validateGenderAndRoom(*prisoner.Gender_ID, *input.Room_ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	oldRoomID := prisoner.Room_ID
+	now := time.Now()
+
+	var lockdown *entity.Lockdown
+	err := configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		// เช็คการปิดควบคุมและความจุภายใน transaction เพื่อกันการเปิดปิดควบคุม/ย้ายเข้าห้องเดียวกันพร้อมกัน
+		var err error
+		if lockdown, err = activeLockdownForTransfer(tx, oldRoomID, *input.Room_ID); err != nil {
+			return err
+		} else if lockdown != nil {
+			return errRoomLocked
+		}
+		if err := checkRoomCapacity(tx, *input.Room_ID); err != nil {
+			return err
+		}
+
+		if err := openRoomAssignment(tx, prisoner.Prisoner_ID, *input.Room_ID, now, input.Reason, midFromContext(c)); err != nil {
+			return err
+		}
+		if err := tx.Model(&prisoner).Update("room_id", *input.Room_ID).Error; err != nil {
+			return err
+		}
+		if oldRoomID != nil {
+			if err := updateRoomStatus(tx, *oldRoomID); err != nil {
+				return err
+			}
+		}
+		return updateRoomStatus(tx, *input.Room_ID)
+	})
+	if err != nil {
+		if errors.Is(err, errRoomLocked) {
+			c.JSON(http.StatusConflict, gin.H{"error": "ไม่สามารถย้ายห้องได้ " + lockdownMessage(configs.DB(), lockdown)})
+			return
+		}
+		if errors.Is(err, errRoomFull) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ไม่สามารถย้ายนักโทษได้ เนื่องจากห้องขังปลายทางเต็มแล้ว"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to transfer prisoner: " + err.Error()})
+		return
+	}
+
+	if err := configs.DB().WithContext(c).Preload("Gender").Preload("Room").Preload("Work").First(&prisoner, id).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load prisoner"})
+		return
+	}
+	c.JSON(http.StatusOK, prisoner)
+}
+
+// GET /api/prisoners/:id/room-history
+func GetPrisonerRoomHistory(c *gin.Context) {
+	id := c.Param("id")
+
+	var prisoner entity.Prisoner
+	if err := configs.DB().First(&prisoner, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prisoner not found"})
+		return
+	}
+
+	var history []entity.RoomAssignment
+	if err := configs.DB().
+		Preload("Room").
+		Preload("ApprovedBy").
+		Where("prisoner_id = ?", prisoner.Prisoner_ID).
+		Order("from_date desc, assignment_id desc").
+		Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch room history"})
+		return
+	}
+	c.JSON(http.StatusOK, history)
+}
+
+// GET /api/rooms/:id/occupants?date=YYYY-MM-DD
+// ใครอยู่ห้องนี้บ้างในวันที่ระบุ (ไม่ระบุ = วันนี้)
+func GetRoomOccupantsOnDate(c *gin.Context) {
+	id := c.Param("id")
+
+	day := time.Now()
+	if v := c.Query("date"); v != "" {
+		d, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format, use YYYY-MM-DD"})
+			return
+		}
+		day = d
+	}
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	end := start.AddDate(0, 0, 1)
+
+	var assignments []entity.RoomAssignment
+	if err := configs.DB().
+		Preload("Prisoner").
+		Where("room_id = ? AND from_date < ? AND (to_date IS NULL OR to_date >= ?)", id, end, start).
+		Order("from_date asc").
+		Find(&assignments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch room occupants"})
+		return
+	}
+	c.JSON(http.StatusOK, assignments)
+}
+
+func init() {
+	RegisterJob(&Job{
+		Name:        "room-status-reconcile",
+		Description: "คำนวณสถานะห้องขังใหม่ และปิดประวัติห้องของผู้ต้องขังที่พ้นโทษแล้ว",
+		Interval:    10 * time.Minute,
+		Run:         reconcileRoomStatuses,
+	})
+}
+
+func reconcileRoomStatuses(db *gorm.DB) (int, string, error) {
+	now := time.Now()
+	changed := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// ปิดประวัติห้องของผู้ต้องขังที่ถึงวันปล่อยตัวแล้ว (ปิด ณ วันปล่อยตัว)
+		var released []entity.Prisoner
+		if err := tx.
+			Where("release_date IS NOT NULL AND release_date <= ?", now).
+			Where("prisoner_id IN (?)", tx.Model(&entity.RoomAssignment{}).Select("prisoner_id").Where("to_date IS NULL")).
+			Find(&released).Error; err != nil {
+			return err
+		}
+		for _, p := range released {
+			if err := closeRoomAssignment(tx, p.Prisoner_ID, *p.ReleaseDate); err != nil {
+				return err
+			}
+		}
+
+		var rooms []entity.Room
+		if err := tx.Find(&rooms).Error; err != nil {
+			return err
+		}
+		for _, room := range rooms {
+			count, err := countActivePrisoners(tx, room.Room_ID)
+			if err != nil {
+				return err
+			}
+			if roomStatusFor(count, room.Capacity) == room.Room_Status {
+				continue
+			}
+			if err := updateRoomStatus(tx, room.Room_ID); err != nil {
+				return err
+			}
+			changed++
+		}
+		return nil
+	})
+	return changed, fmt.Sprintf("อัปเดตสถานะห้อง %d ห้อง", changed), err
+}
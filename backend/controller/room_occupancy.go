@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+)
+
+// OccupantInfo ผู้ต้องขังที่อยู่ในห้องขณะนี้
+type OccupantInfo struct {
+	Prisoner_ID uint   `json:"Prisoner_ID"`
+	Inmate_ID   string `json:"Inmate_ID"`
+	FirstName   string `json:"FirstName"`
+	LastName    string `json:"LastName"`
+	Gender_ID   *uint  `json:"Gender_ID"`
+}
+
+// RoomOccupancy จำนวนคนในห้องคำนวณ ณ เวลาที่เรียก (ไม่ใช้ Room_Status ที่เก็บไว้)
+type RoomOccupancy struct {
+	Room_ID        uint           `json:"Room_ID"`
+	Room_Name      string         `json:"Room_Name"`
+	Building       string         `json:"Building"`
+	Wing           string         `json:"Wing"`
+	Security_Level string         `json:"Security_Level"`
+	Gender_ID      *uint          `json:"Gender_ID"`
+	Is_Mixed       bool           `json:"Is_Mixed"`
+	Capacity       int            `json:"Capacity"`
+	Headcount      int            `json:"Headcount"`
+	FreeBeds       int            `json:"FreeBeds"`
+	ByGender       map[string]int `json:"ByGender"`
+	Status         string         `json:"Status"`       // สถานะที่คำนวณจริง
+	StoredStatus   string         `json:"StoredStatus"` // Room_Status ในฐานข้อมูล (อาจค้าง)
+	Occupants      []OccupantInfo `json:"Occupants"`
+}
+
+// OccupancyTotals ยอดรวมระดับปีก/อาคาร และทั้งเรือนจำ
+type OccupancyTotals struct {
+	Building  string         `json:"Building,omitempty"`
+	Wing      string         `json:"Wing,omitempty"`
+	Rooms     int            `json:"Rooms"`
+	Capacity  int            `json:"Capacity"`
+	Headcount int            `json:"Headcount"`
+	FreeBeds  int            `json:"FreeBeds"`
+	FullRooms int            `json:"FullRooms"`
+	ByGender  map[string]int `json:"ByGender"`
+}
+
+func (t *OccupancyTotals) add(r RoomOccupancy) {
+	t.Rooms++
+	t.Capacity += r.Capacity
+	t.Headcount += r.Headcount
+	t.FreeBeds += r.FreeBeds
+	if r.Headcount >= r.Capacity {
+		t.FullRooms++
+	}
+	for g, n := range r.ByGender {
+		t.ByGender[g] += n
+	}
+}
+
+// GET /api/rooms/occupancy
+func GetRoomOccupancy(c *gin.Context) {
+	db := configs.DB()
+
+	var rooms []entity.Room
+	if err := db.Order("building asc, wing asc, room_name asc").Find(&rooms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rooms"})
+		return
+	}
+
+	// ผู้ต้องขังที่ยังคุมขังอยู่ ณ ตอนนี้ (เงื่อนไขเดียวกับ countActivePrisoners)
+	var prisoners []entity.Prisoner
+	if err := db.
+		Where("room_id IS NOT NULL AND (release_date IS NULL OR release_date > ?)", time.Now()).
+		Order("inmate_id asc").
+		Find(&prisoners).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch prisoners"})
+		return
+	}
+
+	var genders []entity.Gender
+	db.Find(&genders)
+	genderNames := map[uint]string{}
+	for _, g := range genders {
+		genderNames[g.Gender_ID] = g.Gender
+	}
+
+	occupants := map[uint][]entity.Prisoner{}
+	for _, p := range prisoners {
+		occupants[*p.Room_ID] = append(occupants[*p.Room_ID], p)
+	}
+
+	result := make([]RoomOccupancy, 0, len(rooms))
+	wings := map[[2]string]*OccupancyTotals{}
+	facility := OccupancyTotals{ByGender: map[string]int{}}
+
+	for _, room := range rooms {
+		ro := RoomOccupancy{
+			Room_ID:        room.Room_ID,
+			Room_Name:      room.Room_Name,
+			Building:       room.Building,
+			Wing:           room.Wing,
+			Security_Level: room.Security_Level,
+			Gender_ID:      room.Gender_ID,
+			Is_Mixed:       room.Is_Mixed,
+			Capacity:       room.Capacity,
+			StoredStatus:   room.Room_Status,
+			ByGender:       map[string]int{},
+			Occupants:      []OccupantInfo{},
+		}
+		for _, p := range occupants[room.Room_ID] {
+			ro.Occupants = append(ro.Occupants, OccupantInfo{
+				Prisoner_ID: p.Prisoner_ID,
+				Inmate_ID:   p.Inmate_ID,
+				FirstName:   p.FirstName,
+				LastName:    p.LastName,
+				Gender_ID:   p.Gender_ID,
+			})
+			if p.Gender_ID != nil {
+				ro.ByGender[genderNames[*p.Gender_ID]]++
+			}
+		}
+		ro.Headcount = len(ro.Occupants)
+		ro.FreeBeds = room.Capacity - ro.Headcount
+		if ro.FreeBeds < 0 {
+			ro.FreeBeds = 0
+		}
+		ro.Status = roomStatusFor(int64(ro.Headcount), room.Capacity)
+		result = append(result, ro)
+
+		key := [2]string{room.Building, room.Wing}
+		if wings[key] == nil {
+			wings[key] = &OccupancyTotals{Building: room.Building, Wing: room.Wing, ByGender: map[string]int{}}
+		}
+		wings[key].add(ro)
+		facility.add(ro)
+	}
+
+	wingTotals := make([]OccupancyTotals, 0, len(wings))
+	for _, w := range wings {
+		wingTotals = append(wingTotals, *w)
+	}
+	sort.Slice(wingTotals, func(i, j int) bool {
+		if wingTotals[i].Building != wingTotals[j].Building {
+			return wingTotals[i].Building < wingTotals[j].Building
+		}
+		return wingTotals[i].Wing < wingTotals[j].Wing
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"generatedAt": time.Now(),
+		"rooms":       result,
+		"wings":       wingTotals,
+		"facility":    facility,
+	})
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+// Job งานเบื้องหลังที่รันตามรอบเวลา; Run คืนจำนวนรายการที่เปลี่ยน
+type Job struct {
+	Name        string
+	Description string
+	Interval    time.Duration
+	Run         func(db *gorm.DB) (int, string, error)
+
+	mu sync.Mutex // กันไม่ให้ job เดียวกันรันซ้อนกัน (รอบเวลา + สั่งรันเอง)
+}
+
+var (
+	jobs     []*Job
+	jobIndex = map[string]*Job{}
+)
+
+// RegisterJob เพิ่ม job เข้า scheduler (เรียกก่อน StartScheduler)
+func RegisterJob(j *Job) {
+	jobs = append(jobs, j)
+	jobIndex[j.Name] = j
+}
+
+// StartScheduler เริ่มทุก job ใน goroutine ของตัวเอง (รันรอบแรกทันที)
+func StartScheduler() {
+	for _, j := range jobs {
+		go func(j *Job) {
+			runJob(context.Background(), j, "schedule", nil)
+			ticker := time.NewTicker(j.Interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				runJob(context.Background(), j, "schedule", nil)
+			}
+		}(j)
+	}
+}
+
+// runJob รัน job หนึ่งครั้งและบันทึกผลลง job_runs
+func runJob(ctx context.Context, j *Job, trigger string, mid *int) entity.JobRun {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	db := configs.DB()
+	run := entity.JobRun{
+		Job:            j.Name,
+		Trigger:        trigger,
+		Status:         "running",
+		StartedAt:      time.Now(),
+		TriggeredByMID: mid,
+	}
+	if err := db.Create(&run).Error; err != nil {
+		log.Printf("scheduler: cannot record run of %s: %v", j.Name, err)
+	}
+
+	affected, msg, err := safeRun(j, db.WithContext(ctx))
+	finished := time.Now()
+	run.FinishedAt = &finished
+	run.Affected = affected
+	run.Message = msg
+	run.Status = "success"
+	if err != nil {
+		run.Status = "failed"
+		run.Message = err.Error()
+		log.Printf("scheduler: %s failed: %v", j.Name, err)
+	}
+	if run.ID != 0 {
+		db.Save(&run)
+	}
+	return run
+}
+
+// safeRun กัน panic ใน job ไม่ให้ goroutine ของ scheduler ตาย
+func safeRun(j *Job, db *gorm.DB) (affected int, msg string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return j.Run(db)
+}
+
+// -------- Handlers --------
+
+// GET /api/jobs  รายชื่อ job พร้อมผลการรันล่าสุด
+func GetJobs(c *gin.Context) {
+	out := make([]gin.H, 0, len(jobs))
+	for _, j := range jobs {
+		var last *entity.JobRun
+		var run entity.JobRun
+		if err := configs.DB().Where("job = ?", j.Name).Order("id desc").First(&run).Error; err == nil {
+			last = &run
+		}
+		out = append(out, gin.H{
+			"name":        j.Name,
+			"description": j.Description,
+			"interval":    j.Interval.String(),
+			"lastRun":     last,
+		})
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GET /api/jobs/runs?job=&limit=
+func GetJobRuns(c *gin.Context) {
+	limit := 100
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+			return
+		}
+		limit = n
+	}
+
+	q := configs.DB().Preload("TriggeredBy").Order("id desc").Limit(limit)
+	if name := c.Query("job"); name != "" {
+		q = q.Where("job = ?", name)
+	}
+	var runs []entity.JobRun
+	if err := q.Find(&runs).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch job runs"})
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+// POST /api/jobs/:name/run  สั่งรัน job ทันที (รอจนเสร็จแล้วคืนผล)
+func TriggerJob(c *gin.Context) {
+	j, ok := jobIndex[c.Param("name")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "job not found"})
+		return
+	}
+	run := runJob(c, j, "manual", midFromContext(c))
+	if run.Status == "failed" {
+		c.JSON(http.StatusInternalServerError, run)
+		return
+	}
+	c.JSON(http.StatusOK, run)
+}
@@ -0,0 +1,478 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+type ChargeInput struct {
+	Case_ID     string `json:"Case_ID"`
+	Offense     string `json:"Offense" binding:"required"`
+	TermYears   int    `json:"TermYears"`
+	TermMonths  int    `json:"TermMonths"`
+	TermDays    int    `json:"TermDays"`
+	Consecutive bool   `json:"Consecutive"`
+	CreditDays  int    `json:"CreditDays"`
+	Seq         int    `json:"Seq"`
+}
+
+type RemissionRateInput struct {
+	BID               uint `json:"BID" binding:"required"`
+	DaysPerEvaluation int  `json:"DaysPerEvaluation"`
+}
+
+type RemissionPolicyInput struct {
+	Enabled           bool                 `json:"Enabled"`
+	MinScore          int                  `json:"MinScore"`
+	ScorePointsPerDay int                  `json:"ScorePointsPerDay"`
+	MaxPercent        int                  `json:"MaxPercent"`
+	Rates             []RemissionRateInput `json:"Rates"`
+}
+
+// ChargeTerm โทษของแต่ละข้อหาบนเส้นเวลา (StartDay/EndDay นับจากวันเริ่มรับโทษ)
+type ChargeTerm struct {
+	Charge_ID   uint   `json:"Charge_ID"`
+	Case_ID     string `json:"Case_ID"`
+	Offense     string `json:"Offense"`
+	Term        string `json:"Term"`
+	Consecutive bool   `json:"Consecutive"`
+	Days        int    `json:"Days"`
+	StartDay    int    `json:"StartDay"`
+	EndDay      int    `json:"EndDay"`
+	CreditDays  int    `json:"CreditDays"`
+}
+
+type RemissionByCriterion struct {
+	BID       uint   `json:"BID"`
+	Criterion string `json:"Criterion"`
+	Count     int64  `json:"Count"`
+	DaysEach  int    `json:"DaysEach"`
+	Days      int    `json:"Days"`
+}
+
+type RemissionBreakdown struct {
+	Applied        bool                   `json:"Applied"`
+	Reason         string                 `json:"Reason,omitempty"` // เหตุผลที่ไม่ได้ลด
+	Score          int                    `json:"Score"`
+	ByCriterion    []RemissionByCriterion `json:"ByCriterion"`
+	EvaluationDays int                    `json:"EvaluationDays"`
+	ScoreDays      int                    `json:"ScoreDays"`
+	EarnedDays     int                    `json:"EarnedDays"`
+	CapDays        int                    `json:"CapDays"`
+	Days           int                    `json:"Days"`
+}
+
+type SentenceStep struct {
+	No        int    `json:"No"`
+	Label     string `json:"Label"`
+	Detail    string `json:"Detail"`
+	Days      int    `json:"Days"`
+	TotalDays int    `json:"TotalDays"`
+}
+
+type SentenceBreakdown struct {
+	Prisoner_ID     uint               `json:"Prisoner_ID"`
+	Inmate_ID       string             `json:"Inmate_ID"`
+	SentenceStart   time.Time          `json:"SentenceStart"`
+	Charges         []ChargeTerm       `json:"Charges"`
+	GrossDays       int                `json:"GrossDays"`
+	CreditDays      int                `json:"CreditDays"`
+	Remission       RemissionBreakdown `json:"Remission"`
+	NetDays         int                `json:"NetDays"`
+	ExpectedRelease *time.Time         `json:"ExpectedRelease"`
+	RecordedRelease *time.Time         `json:"RecordedRelease"`
+	DifferenceDays  *int               `json:"DifferenceDays"` // RecordedRelease - ExpectedRelease
+	Steps           []SentenceStep     `json:"Steps"`
+}
+
+// -------- Helpers --------
+
+func validateChargeInput(input ChargeInput) error {
+	if input.TermYears < 0 || input.TermMonths < 0 || input.TermDays < 0 || input.CreditDays < 0 {
+		return errors.New("ระยะเวลาโทษและวันที่ถูกคุมขังมาก่อนต้องไม่ติดลบ")
+	}
+	if input.TermYears == 0 && input.TermMonths == 0 && input.TermDays == 0 {
+		return errors.New("กรุณาระบุระยะเวลาโทษ")
+	}
+	if strings.TrimSpace(input.Offense) == "" {
+		return errors.New("กรุณาระบุข้อหา")
+	}
+	return nil
+}
+
+func daysBetween(from, to time.Time) int {
+	return int(to.Sub(from).Hours() / 24)
+}
+
+func formatTerm(ch entity.SentenceCharge) string {
+	parts := []string{}
+	if ch.TermYears > 0 {
+		parts = append(parts, fmt.Sprintf("%d ปี", ch.TermYears))
+	}
+	if ch.TermMonths > 0 {
+		parts = append(parts, fmt.Sprintf("%d เดือน", ch.TermMonths))
+	}
+	if ch.TermDays > 0 {
+		parts = append(parts, fmt.Sprintf("%d วัน", ch.TermDays))
+	}
+	return strings.Join(parts, " ")
+}
+
+func loadRemissionPolicy(db *gorm.DB) (entity.RemissionPolicy, error) {
+	var policy entity.RemissionPolicy
+	err := db.Preload("Rates.BehaviorCriterion").First(&policy, 1).Error
+	return policy, err
+}
+
+// computeSentence คำนวณวันพ้นโทษที่คาดไว้ทีละขั้น
+//  1. โทษแต่ละข้อหาวางบนเส้นเวลา: ต่อโทษ = เริ่มหลังช่วงโทษก่อนหน้าจบ, นับพร้อมกัน = เริ่มพร้อมช่วงปัจจุบัน
+//  2. หักวันที่ถูกคุมขังมาก่อน
+//  3. หักวันลดโทษจากการประเมินพฤติกรรม + คะแนน ตาม RemissionPolicy (ไม่เกิน MaxPercent ของโทษรวม)
+func computeSentence(db *gorm.DB, prisoner entity.Prisoner, applyRemission bool) (SentenceBreakdown, error) {
+	out := SentenceBreakdown{
+		Prisoner_ID:     prisoner.Prisoner_ID,
+		Inmate_ID:       prisoner.Inmate_ID,
+		SentenceStart:   prisoner.EntryDate,
+		Charges:         []ChargeTerm{},
+		RecordedRelease: prisoner.ReleaseDate,
+		Steps:           []SentenceStep{},
+		Remission:       RemissionBreakdown{ByCriterion: []RemissionByCriterion{}},
+	}
+	addStep := func(label, detail string, days, total int) {
+		out.Steps = append(out.Steps, SentenceStep{No: len(out.Steps) + 1, Label: label, Detail: detail, Days: days, TotalDays: total})
+	}
+
+	var charges []entity.SentenceCharge
+	if err := db.Where("prisoner_id = ?", prisoner.Prisoner_ID).Order("seq asc, charge_id asc").Find(&charges).Error; err != nil {
+		return out, err
+	}
+	if len(charges) == 0 {
+		return out, nil
+	}
+
+	// 1) เส้นเวลาโทษ
+	// วันที่ถูกคุมขังมาก่อนหักได้ครั้งเดียวต่อช่วงโทษที่นับพร้อมกัน (ใช้ค่ามากสุดในช่วง) แล้วรวมทุกช่วงที่ต่อโทษ
+	blockStart, blockEnd, blockCredit := 0, 0, 0
+	for i, ch := range charges {
+		if i > 0 && ch.Consecutive {
+			blockStart = blockEnd
+			out.CreditDays += blockCredit
+			blockCredit = 0
+		}
+		startDate := prisoner.EntryDate.AddDate(0, 0, blockStart)
+		days := daysBetween(startDate, startDate.AddDate(ch.TermYears, ch.TermMonths, ch.TermDays))
+		end := blockStart + days
+		if end > blockEnd {
+			blockEnd = end
+		}
+		caseID := ch.Case_ID
+		if caseID == "" {
+			caseID = prisoner.Case_ID
+		}
+		out.Charges = append(out.Charges, ChargeTerm{
+			Charge_ID:   ch.Charge_ID,
+			Case_ID:     caseID,
+			Offense:     ch.Offense,
+			Term:        formatTerm(ch),
+			Consecutive: ch.Consecutive,
+			Days:        days,
+			StartDay:    blockStart,
+			EndDay:      end,
+			CreditDays:  ch.CreditDays,
+		})
+		mode := "นับโทษพร้อมกัน"
+		if i > 0 && ch.Consecutive {
+			mode = "ต่อโทษ"
+		}
+		if i == 0 {
+			mode = "โทษแรก"
+		}
+		addStep(fmt.Sprintf("ข้อหา: %s", ch.Offense),
+			fmt.Sprintf("%s %s (%d วัน) วันที่ %d ถึง %d", mode, formatTerm(ch), days, blockStart, end),
+			days, blockEnd)
+		blockCredit = max(blockCredit, ch.CreditDays)
+	}
+	out.CreditDays += blockCredit
+	out.GrossDays = blockEnd
+	addStep("โทษรวม", "ระยะเวลาตั้งแต่วันเริ่มรับโทษจนโทษข้อสุดท้ายสิ้นสุด", out.GrossDays, out.GrossDays)
+
+	// 2) หักวันที่ถูกคุมขังมาก่อน
+	net := out.GrossDays - out.CreditDays
+	addStep("หักวันที่ถูกคุมขังมาก่อน", "CreditDays มากสุดของแต่ละช่วงที่นับโทษพร้อมกัน รวมทุกช่วงที่ต่อโทษ", -out.CreditDays, net)
+
+	// 3) ลดวันต้องโทษ
+	rem := &out.Remission
+	var sb entity.ScoreBehavior
+	if err := db.Where("prisoner_id = ?", prisoner.Prisoner_ID).First(&sb).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return out, err
+	}
+	rem.Score = sb.Score
+
+	policy, err := loadRemissionPolicy(db)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		rem.Reason = "ยังไม่ได้ตั้งค่านโยบายลดวันต้องโทษ"
+	case err != nil:
+		return out, err
+	case !applyRemission:
+		rem.Reason = "ไม่ได้ขอให้คำนวณการลดวันต้องโทษ"
+	case !policy.Enabled:
+		rem.Reason = "ปิดการลดวันต้องโทษในนโยบาย"
+	case sb.Score < policy.MinScore:
+		rem.Reason = fmt.Sprintf("คะแนนความประพฤติ %d ต่ำกว่าเกณฑ์ %d", sb.Score, policy.MinScore)
+	default:
+		rem.Applied = true
+		for _, rate := range policy.Rates {
+			var count int64
+			if sb.SID != 0 {
+				if err := db.Model(&entity.BehaviorEvaluation{}).
+					Where("s_id = ? AND b_id = ? AND evaluation_date <= ?", sb.SID, rate.BID, time.Now()).
+					Count(&count).Error; err != nil {
+					return out, err
+				}
+			}
+			item := RemissionByCriterion{BID: rate.BID, Count: count, DaysEach: rate.DaysPerEvaluation, Days: int(count) * rate.DaysPerEvaluation}
+			if rate.BehaviorCriterion != nil {
+				item.Criterion = rate.BehaviorCriterion.Criterion
+			}
+			rem.ByCriterion = append(rem.ByCriterion, item)
+			rem.EvaluationDays += item.Days
+		}
+		if policy.ScorePointsPerDay > 0 && sb.Score > 0 {
+			rem.ScoreDays = sb.Score / policy.ScorePointsPerDay
+		}
+		rem.EarnedDays = rem.EvaluationDays + rem.ScoreDays
+		rem.CapDays = out.GrossDays * policy.MaxPercent / 100
+		rem.Days = rem.EarnedDays
+		if rem.Days > rem.CapDays {
+			rem.Days = rem.CapDays
+		}
+		if rem.Days < 0 {
+			rem.Days = 0
+		}
+	}
+	net -= rem.Days
+	detail := rem.Reason
+	if rem.Applied {
+		detail = fmt.Sprintf("จากการประเมิน %d วัน + จากคะแนน %d วัน = %d วัน (เพดาน %d วัน)",
+			rem.EvaluationDays, rem.ScoreDays, rem.EarnedDays, rem.CapDays)
+	}
+	addStep("ลดวันต้องโทษจากความประพฤติ", detail, -rem.Days, net)
+
+	if net < 0 {
+		net = 0
+	}
+	out.NetDays = net
+	expected := prisoner.EntryDate.AddDate(0, 0, net)
+	out.ExpectedRelease = &expected
+	addStep("วันพ้นโทษที่คาดไว้", expected.Format("2006-01-02"), 0, net)
+
+	if prisoner.ReleaseDate != nil {
+		diff := daysBetween(expected, *prisoner.ReleaseDate)
+		out.DifferenceDays = &diff
+	}
+	return out, nil
+}
+
+// -------- Handlers --------
+
+// GET /api/prisoners/:id/sentence?remission=false
+func GetPrisonerSentence(c *gin.Context) {
+	db := configs.DB()
+
+	var prisoner entity.Prisoner
+	if err := db.First(&prisoner, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prisoner not found"})
+		return
+	}
+
+	applyRemission := true
+	if v := c.Query("remission"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "remission must be true or false"})
+			return
+		}
+		applyRemission = b
+	}
+
+	breakdown, err := computeSentence(db, prisoner, applyRemission)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute sentence: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, breakdown)
+}
+
+// GET /api/prisoners/:id/charges
+func GetPrisonerCharges(c *gin.Context) {
+	var charges []entity.SentenceCharge
+	if err := configs.DB().Where("prisoner_id = ?", c.Param("id")).
+		Order("seq asc, charge_id asc").Find(&charges).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch charges"})
+		return
+	}
+	c.JSON(http.StatusOK, charges)
+}
+
+// POST /api/prisoners/:id/charges
+func CreateCharge(c *gin.Context) {
+	db := configs.DB().WithContext(c)
+
+	var prisoner entity.Prisoner
+	if err := db.First(&prisoner, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prisoner not found"})
+		return
+	}
+
+	var input ChargeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format: " + err.Error()})
+		return
+	}
+	if err := validateChargeInput(input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	charge := entity.SentenceCharge{
+		Prisoner_ID: prisoner.Prisoner_ID,
+		Case_ID:     input.Case_ID,
+		Offense:     strings.TrimSpace(input.Offense),
+		TermYears:   input.TermYears,
+		TermMonths:  input.TermMonths,
+		TermDays:    input.TermDays,
+		Consecutive: input.Consecutive,
+		CreditDays:  input.CreditDays,
+		Seq:         input.Seq,
+	}
+	if err := db.Create(&charge).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create charge"})
+		return
+	}
+	c.JSON(http.StatusCreated, charge)
+}
+
+// PUT /api/prisoners/:id/charges/:chargeId
+func UpdateCharge(c *gin.Context) {
+	db := configs.DB().WithContext(c)
+
+	var charge entity.SentenceCharge
+	if err := db.Where("charge_id = ? AND prisoner_id = ?", c.Param("chargeId"), c.Param("id")).
+		First(&charge).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Charge not found"})
+		return
+	}
+
+	var input ChargeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format: " + err.Error()})
+		return
+	}
+	if err := validateChargeInput(input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	charge.Case_ID = input.Case_ID
+	charge.Offense = strings.TrimSpace(input.Offense)
+	charge.TermYears = input.TermYears
+	charge.TermMonths = input.TermMonths
+	charge.TermDays = input.TermDays
+	charge.Consecutive = input.Consecutive
+	charge.CreditDays = input.CreditDays
+	charge.Seq = input.Seq
+	if err := db.Save(&charge).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update charge"})
+		return
+	}
+	c.JSON(http.StatusOK, charge)
+}
+
+// DELETE /api/prisoners/:id/charges/:chargeId
+func DeleteCharge(c *gin.Context) {
+	res := configs.DB().WithContext(c).
+		Where("charge_id = ? AND prisoner_id = ?", c.Param("chargeId"), c.Param("id")).
+		Delete(&entity.SentenceCharge{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete charge"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Charge not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Charge deleted successfully"})
+}
+
+// GET /api/sentence-policy
+func GetRemissionPolicy(c *gin.Context) {
+	policy, err := loadRemissionPolicy(configs.DB())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Remission policy not found"})
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// PUT /api/sentence-policy
+func UpdateRemissionPolicy(c *gin.Context) {
+	var input RemissionPolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format: " + err.Error()})
+		return
+	}
+	if input.MinScore < 0 || input.ScorePointsPerDay < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MinScore และ ScorePointsPerDay ต้องไม่ติดลบ"})
+		return
+	}
+	if input.MaxPercent < 0 || input.MaxPercent > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MaxPercent ต้องอยู่ระหว่าง 0 ถึง 100"})
+		return
+	}
+	for _, r := range input.Rates {
+		if r.DaysPerEvaluation < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "DaysPerEvaluation ต้องไม่ติดลบ"})
+			return
+		}
+	}
+
+	err := configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		policy := entity.RemissionPolicy{
+			ID:                1,
+			Enabled:           input.Enabled,
+			MinScore:          input.MinScore,
+			ScorePointsPerDay: input.ScorePointsPerDay,
+			MaxPercent:        input.MaxPercent,
+		}
+		if err := tx.Select("*").Omit("Rates").Save(&policy).Error; err != nil {
+			return err
+		}
+		for _, r := range input.Rates {
+			if err := tx.First(&entity.BehaviorCriterion{}, r.BID).Error; err != nil {
+				return fmt.Errorf("ไม่พบเกณฑ์พฤติกรรม BID %d", r.BID)
+			}
+			rate := entity.RemissionRate{PolicyID: 1, BID: r.BID, DaysPerEvaluation: r.DaysPerEvaluation}
+			if err := tx.Save(&rate).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy, _ := loadRemissionPolicy(configs.DB())
+	c.JSON(http.StatusOK, policy)
+}
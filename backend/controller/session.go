@@ -0,0 +1,117 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+// randomToken สุ่มสตริง hex ความยาว 2*n ตัวอักษร
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// signAccessToken ออก access token (HS256) พร้อม jti สำหรับเพิกถอน
+func signAccessToken(m entity.Member) (string, string, error) {
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"mid":       m.MID,
+		"username":  m.Username,
+		"rankId":    m.RankID,
+		"citizenId": m.CitizenID,
+		"jti":       jti,
+		"exp":       now.Add(configs.AccessTokenTTL()).Unix(),
+		"iat":       now.Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(configs.JWTSecret())
+	if err != nil {
+		return "", "", err
+	}
+	return signed, jti, nil
+}
+
+// issueSession ออก access token + refresh token ใหม่ และบันทึก refresh token ลงตาราง
+func issueSession(tx *gorm.DB, m entity.Member) (access string, refresh entity.RefreshToken, rawRefresh string, err error) {
+	access, jti, err := signAccessToken(m)
+	if err != nil {
+		return "", refresh, "", fmt.Errorf("cannot sign token: %w", err)
+	}
+	rawRefresh, err = randomToken(32)
+	if err != nil {
+		return "", refresh, "", fmt.Errorf("cannot generate refresh token: %w", err)
+	}
+	refresh = entity.RefreshToken{
+		MID:       m.MID,
+		TokenHash: hashToken(rawRefresh),
+		AccessJTI: jti,
+		ExpiresAt: time.Now().Add(configs.RefreshTokenTTL()),
+	}
+	if err := tx.Create(&refresh).Error; err != nil {
+		return "", refresh, "", fmt.Errorf("cannot store refresh token: %w", err)
+	}
+	return access, refresh, rawRefresh, nil
+}
+
+// revokeAccessJTI เพิ่ม jti ลงตาราง revoked_tokens (ข้ามถ้ามีอยู่แล้ว)
+func revokeAccessJTI(tx *gorm.DB, mid int, jti string) error {
+	if jti == "" {
+		return nil
+	}
+	now := time.Now()
+	return tx.Where(entity.RevokedToken{JTI: jti}).
+		FirstOrCreate(&entity.RevokedToken{
+			JTI:       jti,
+			MID:       mid,
+			ExpiresAt: now.Add(configs.AccessTokenTTL()),
+			RevokedAt: now,
+		}).Error
+}
+
+// revokeRefreshToken เพิกถอน refresh token หนึ่งตัวพร้อม access token คู่กัน
+func revokeRefreshToken(tx *gorm.DB, rt *entity.RefreshToken) error {
+	if rt.RevokedAt == nil {
+		now := time.Now()
+		if err := tx.Model(rt).Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		rt.RevokedAt = &now
+	}
+	return revokeAccessJTI(tx, rt.MID, rt.AccessJTI)
+}
+
+// revokeMemberSessions เพิกถอนทุก session ที่ยังใช้งานได้ของสมาชิก
+// (ใช้ตอน logout ทุกเครื่อง, ลบสมาชิก, เปลี่ยน rank)
+func revokeMemberSessions(tx *gorm.DB, mid int) error {
+	var active []entity.RefreshToken
+	if err := tx.Where("m_id = ? AND revoked_at IS NULL AND expires_at > ?", mid, time.Now()).
+		Find(&active).Error; err != nil {
+		return err
+	}
+	for i := range active {
+		if err := revokeRefreshToken(tx, &active[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
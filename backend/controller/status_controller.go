@@ -8,6 +8,17 @@ import (
 	"github.com/sa-project/entity"
 )
 
+// Status_ID ที่ seed ไว้ใน configs.SetupDatabase
+const (
+	statusPending   uint = 1 // รอ...
+	statusApproved  uint = 2 // อนุมัติ
+	statusRejected  uint = 3 // ไม่อนุมัติ
+	statusCompleted uint = 4 // สำเร็จ
+	statusExpired   uint = 5 // หมดอายุ
+	statusCancelled uint = 6 // ยกเลิก
+	statusNoShow    uint = 7 // ไม่มาตามนัด
+)
+
 type StatusInput struct {
 	Status string `json:"Status" binding:"required"`
 }
@@ -15,7 +26,7 @@ type StatusInput struct {
 // GetStatuses - ดึงสถานะทั้งหมด
 func GetStatuses(c *gin.Context) {
 	var statuses []entity.Status
-	if err := configs.DB().Order("status_id asc").Find(&statuses).Error; err != nil {
+	if err := configs.DB().WithContext(c).Order("status_id asc").Find(&statuses).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch statuses"})
 		return
 	}
@@ -34,7 +45,7 @@ func CreateStatus(c *gin.Context) {
 		Status: input.Status,
 	}
 
-	if err := configs.DB().Create(&status).Error; err != nil {
+	if err := configs.DB().WithContext(c).Create(&status).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create status: " + err.Error()})
 		return
 	}
@@ -46,7 +57,7 @@ func CreateStatus(c *gin.Context) {
 func UpdateStatus(c *gin.Context) {
 	id := c.Param("id")
 	var status entity.Status
-	if err := configs.DB().First(&status, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&status, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Status not found"})
 		return
 	}
@@ -57,7 +68,7 @@ func UpdateStatus(c *gin.Context) {
 		return
 	}
 
-	if err := configs.DB().Model(&status).Update("status", input.Status).Error; err != nil {
+	if err := configs.DB().WithContext(c).Model(&status).Update("status", input.Status).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update status: " + err.Error()})
 		return
 	}
@@ -70,13 +81,13 @@ func DeleteStatus(c *gin.Context) {
 	id := c.Param("id")
 
 	var count int64
-	configs.DB().Model(&entity.Requesting{}).Where("status_id = ?", id).Count(&count)
+	configs.DB().WithContext(c).Model(&entity.Requesting{}).Where("status_id = ?", id).Count(&count)
 	if count > 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ไม่สามารถลบสถานะได้ เนื่องจากมีคำขอเบิกที่ใช้สถานะนี้อยู่"})
 		return
 	}
 
-	if err := configs.DB().Delete(&entity.Status{}, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).Delete(&entity.Status{}, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete status"})
 		return
 	}
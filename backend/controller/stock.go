@@ -0,0 +1,318 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+// ประเภทพัสดุที่ต้องระบุวันหมดอายุทุกล็อต (entity.Type seed: 3 = ยา)
+const typeMedicine = 3
+
+// OperatorID ใน operations (ตาม seed ใน configs.SetupDatabase)
+const (
+	operatorAdd     = 1 // เพิ่ม
+	operatorIssue   = 2 // เบิก
+	operatorEdit    = 3 // แก้ไข
+	operatorCreate  = 4 // เพิ่มใหม่
+	operatorDelete  = 5 // ลบ
+	operatorReceive = 6 // รับเข้าตามใบสั่งซื้อ
+)
+
+// errStockViaPO ของเข้าคลังได้ทางเดียวคือรับตามใบสั่งซื้อ (ผู้ตรวจสอบบัญชีต้องโยงทุกยอดเพิ่มกับใบสั่งซื้อ)
+var errStockViaPO = errors.New("การรับของเข้าคลังต้องทำผ่านใบสั่งซื้อ (POST /api/purchase-orders/:id/receive)")
+
+// lotInput ข้อมูลล็อตที่รับเข้า (ใช้กับการรับของตามใบสั่งซื้อ)
+type lotInput struct {
+	LotNo        string  `json:"lotNo"`
+	ExpiryDate   *string `json:"expiryDate"` // YYYY-MM-DD หรือ ISO-8601
+	Supplier     string  `json:"supplier"`
+	ReceivedDate *string `json:"receivedDate"` // ไม่ส่ง = วันนี้
+}
+
+// insufficientStockError ของที่จ่ายได้ (ไม่นับล็อตหมดอายุ) ไม่พอ
+type insufficientStockError struct {
+	Requested int
+	Available int
+}
+
+func (e *insufficientStockError) Error() string {
+	return fmt.Sprintf("insufficient stock: requested %d, available %d", e.Requested, e.Available)
+}
+
+// stockDay วันที่แบบไม่มีเวลา (เที่ยงคืน UTC ของวันตามเวลาเครื่อง) ใช้เทียบวันหมดอายุ
+func stockDay(t time.Time) time.Time {
+	t = t.In(time.Local)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// toLot ตรวจข้อมูลล็อตและสร้าง ParcelLot จำนวน qty (ยาต้องมีวันหมดอายุ)
+func (in lotInput) toLot(parcel entity.Parcel, qty int) (entity.ParcelLot, error) {
+	lot := entity.ParcelLot{
+		PID:        parcel.PID,
+		LotNo:      strings.TrimSpace(in.LotNo),
+		Quantity:   qty,
+		Remaining:  qty,
+		Supplier:   strings.TrimSpace(in.Supplier),
+		ReceivedAt: time.Now(),
+	}
+	expiry, err := parseISODatePtr(in.ExpiryDate)
+	if err != nil {
+		return lot, errors.New("invalid expiryDate (use YYYY-MM-DD)")
+	}
+	if expiry != nil {
+		d := stockDay(*expiry)
+		lot.ExpiryDate = &d
+	} else if parcel.Type_ID == typeMedicine {
+		return lot, errors.New("expiryDate is required for medicine")
+	}
+	received, err := parseISODatePtr(in.ReceivedDate)
+	if err != nil {
+		return lot, errors.New("invalid receivedDate (use YYYY-MM-DD)")
+	}
+	if received != nil {
+		if received.After(time.Now()) {
+			return lot, errors.New("receivedDate cannot be in the future")
+		}
+		lot.ReceivedAt = *received
+	}
+	if lot.ExpiryDate != nil && lot.ExpiryDate.Before(stockDay(lot.ReceivedAt)) {
+		return lot, errors.New("expiryDate is before the received date")
+	}
+	return lot, nil
+}
+
+// syncParcelQuantity คำนวณ Quantity (ทุกล็อต) และ Available (ล็อตที่ยังไม่หมดอายุ) ใหม่ แล้วบันทึกพร้อมสถานะ
+func syncParcelQuantity(tx *gorm.DB, parcel *entity.Parcel) error {
+	var totals struct {
+		Total     int
+		Available int
+	}
+	if err := tx.Model(&entity.ParcelLot{}).Where("p_id = ?", parcel.PID).
+		Select("COALESCE(SUM(remaining), 0) AS total, "+
+			"COALESCE(SUM(CASE WHEN expiry_date IS NULL OR expiry_date >= ? THEN remaining ELSE 0 END), 0) AS available",
+			stockDay(time.Now())).
+		Scan(&totals).Error; err != nil {
+		return err
+	}
+	parcel.Quantity = totals.Total
+	parcel.Available = totals.Available
+	parcel.Status = calculateStatus(*parcel)
+	return tx.Model(parcel).Updates(map[string]any{
+		"quantity":  parcel.Quantity,
+		"available": parcel.Available,
+		"status":    parcel.Status,
+	}).Error
+}
+
+// logStockOperation บันทึก Operation ของการเปลี่ยนจำนวน และผูกการเคลื่อนไหวรายล็อตเข้ากับ Operation นั้น
+func logStockOperation(tx *gorm.DB, parcel entity.Parcel, oldQty, operatorID, mid int, moves []entity.ParcelLotMovement) (entity.Operation, error) {
+	op := entity.Operation{
+		DateTime:     time.Now(),
+		PID:          parcel.PID,
+		OldQuantity:  oldQty,
+		NewQuantity:  parcel.Quantity,
+		ChangeAmount: parcel.Quantity - oldQty,
+		OperatorID:   operatorID,
+		MID:          mid,
+	}
+	if err := tx.Create(&op).Error; err != nil {
+		return op, err
+	}
+	for i := range moves {
+		moves[i].OPID = op.OPID
+		moves[i].PID = parcel.PID
+	}
+	if len(moves) > 0 {
+		if err := tx.Create(&moves).Error; err != nil {
+			return op, err
+		}
+	}
+	return op, nil
+}
+
+// receiveStock รับของเข้าเป็นล็อตใหม่ แล้วปรับ Quantity ของพัสดุ
+func receiveStock(tx *gorm.DB, parcel *entity.Parcel, lot *entity.ParcelLot, operatorID, mid int) (entity.Operation, error) {
+	oldQty := parcel.Quantity
+	lot.PID = parcel.PID
+	if err := tx.Create(lot).Error; err != nil {
+		return entity.Operation{}, err
+	}
+	if err := syncParcelQuantity(tx, parcel); err != nil {
+		return entity.Operation{}, err
+	}
+	return logStockOperation(tx, *parcel, oldQty, operatorID, mid,
+		[]entity.ParcelLotMovement{{LotID: lot.ID, Change: lot.Quantity}})
+}
+
+// issuableLots ล็อตที่ยังมีของเรียงตามลำดับ FEFO (ล็อตที่หมดอายุก่อนออกก่อน, ล็อตไม่มีวันหมดอายุออกท้ายสุด)
+func issuableLots(tx *gorm.DB, pid int, includeExpired bool) ([]entity.ParcelLot, int, error) {
+	q := tx.Where("p_id = ? AND remaining > 0", pid)
+	if !includeExpired {
+		q = q.Where("expiry_date IS NULL OR expiry_date >= ?", stockDay(time.Now()))
+	}
+	var lots []entity.ParcelLot
+	if err := q.Order("expiry_date IS NULL, expiry_date, received_at, id").Find(&lots).Error; err != nil {
+		return nil, 0, err
+	}
+	total := 0
+	for _, l := range lots {
+		total += l.Remaining
+	}
+	return lots, total, nil
+}
+
+// freeStock จำนวนที่ยังเบิก/จองได้ = คงเหลือในล็อตที่ไม่หมดอายุ - ที่จองไว้แล้ว
+func freeStock(tx *gorm.DB, parcel entity.Parcel) (int, error) {
+	_, total, err := issuableLots(tx, parcel.PID, false)
+	return total - parcel.Reserved, err
+}
+
+// issueStock จ่ายของออกตามหลัก FEFO โดยไม่แตะส่วนที่จองไว้ให้คำขอเบิก
+// (คำขอเบิกที่จะจ่ายต้องปลดการจองของตัวเองก่อนด้วย reserveStock ค่าติดลบ)
+// ปกติข้ามล็อตที่หมดอายุแล้ว; includeExpired = true ใช้ตอนปรับยอด/ตัดจำหน่าย (ตัดล็อตหมดอายุก่อน)
+// ทั้งสองแบบต้องเหลือของที่ไม่หมดอายุพอสำหรับที่จองไว้ (ตัดล็อตหมดอายุก่อนเสมอ จึงหักที่จองจากยอดรวมได้เลย)
+func issueStock(tx *gorm.DB, parcel *entity.Parcel, amount, operatorID, mid int, includeExpired bool) (entity.Operation, error) {
+	lots, available, err := issuableLots(tx, parcel.PID, includeExpired)
+	if err != nil {
+		return entity.Operation{}, err
+	}
+	available -= parcel.Reserved
+	if amount > available {
+		return entity.Operation{}, &insufficientStockError{Requested: amount, Available: max(available, 0)}
+	}
+
+	oldQty := parcel.Quantity
+	var moves []entity.ParcelLotMovement
+	left := amount
+	for _, l := range lots {
+		if left == 0 {
+			break
+		}
+		take := min(l.Remaining, left)
+		if err := tx.Model(&entity.ParcelLot{}).Where("id = ?", l.ID).
+			Update("remaining", l.Remaining-take).Error; err != nil {
+			return entity.Operation{}, err
+		}
+		moves = append(moves, entity.ParcelLotMovement{LotID: l.ID, Change: -take})
+		left -= take
+	}
+	if err := syncParcelQuantity(tx, parcel); err != nil {
+		return entity.Operation{}, err
+	}
+	return logStockOperation(tx, *parcel, oldQty, operatorID, mid, moves)
+}
+
+// reserveStock จอง (delta > 0) หรือปลดการจอง (delta < 0) ให้คำขอเบิก; จองเกินจำนวนที่เบิกได้ = insufficientStockError
+func reserveStock(tx *gorm.DB, parcel *entity.Parcel, delta int) error {
+	if delta > 0 {
+		free, err := freeStock(tx, *parcel)
+		if err != nil {
+			return err
+		}
+		if delta > free {
+			return &insufficientStockError{Requested: delta, Available: max(free, 0)}
+		}
+	}
+	parcel.Reserved = max(parcel.Reserved+delta, 0)
+	return tx.Model(parcel).Update("reserved", parcel.Reserved).Error
+}
+
+// stockErrorStatus แปลง error จาก receiveStock/issueStock เป็น HTTP status
+func stockErrorStatus(err error) int {
+	var short *insufficientStockError
+	if errors.As(err, &short) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+func init() {
+	RegisterJob(&Job{
+		Name:        "sync-parcel-expiry",
+		Description: "คำนวณจำนวนพัสดุที่ยังไม่หมดอายุใหม่เมื่อมีล็อตหมดอายุ และแจ้งเตือนพัสดุที่กลายเป็นใกล้หมด/หมดแล้ว",
+		Interval:    time.Hour,
+		Run:         syncParcelExpiry,
+	})
+}
+
+// syncParcelExpiry ล็อตหมดอายุไปโดยไม่มีการเคลื่อนไหวของสต็อก -> Available/สถานะที่บันทึกไว้ไม่ตรง ต้องคำนวณใหม่ตามรอบ
+func syncParcelExpiry(db *gorm.DB) (int, string, error) {
+	var parcels []entity.Parcel
+	if err := db.Find(&parcels).Error; err != nil {
+		return 0, "", err
+	}
+	changed := 0
+	for _, p := range parcels {
+		oldAvailable, oldStatus := p.Available, p.Status
+		if err := syncParcelQuantity(db, &p); err != nil {
+			return changed, "", err
+		}
+		if p.Available == oldAvailable && p.Status == oldStatus {
+			continue
+		}
+		changed++
+		logNotifyError(notifyStockLow(db, p, oldStatus))
+	}
+	return changed, fmt.Sprintf("ปรับจำนวนที่ใช้ได้ของพัสดุ %d รายการ", changed), nil
+}
+
+// -------- Handlers --------
+
+// GET /api/parcels/:id/lots  ล็อตทั้งหมดของพัสดุ (ล็อตที่ยังมีของก่อน เรียงตามวันหมดอายุ)
+func GetParcelLots(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return
+	}
+	var lots []entity.ParcelLot
+	if err := configs.DB().Where("p_id = ?", id).
+		Order("remaining = 0, expiry_date IS NULL, expiry_date, received_at, id").
+		Find(&lots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lots"})
+		return
+	}
+	c.JSON(http.StatusOK, lots)
+}
+
+// GET /api/parcels/expiring?days=30  ล็อตที่ยังมีของและหมดอายุภายใน N วัน (รวมที่หมดอายุไปแล้ว)
+func GetExpiringLots(c *gin.Context) {
+	days := 30
+	if v := c.Query("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 3650 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 0 and 3650"})
+			return
+		}
+		days = n
+	}
+	today := stockDay(time.Now())
+	var lots []entity.ParcelLot
+	if err := configs.DB().Preload("Parcel").Preload("Parcel.Type").
+		Where("remaining > 0 AND expiry_date IS NOT NULL AND expiry_date <= ?", today.AddDate(0, 0, days)).
+		Order("expiry_date, p_id").Find(&lots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch expiring lots"})
+		return
+	}
+
+	type expiringLot struct {
+		entity.ParcelLot
+		DaysLeft int  `json:"DaysLeft"` // ติดลบ = หมดอายุแล้ว
+		Expired  bool `json:"Expired"`
+	}
+	out := make([]expiringLot, 0, len(lots))
+	for _, l := range lots {
+		left := int(l.ExpiryDate.Sub(today).Hours() / 24)
+		out = append(out, expiringLot{ParcelLot: l, DaysLeft: left, Expired: left < 0})
+	}
+	c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+)
+
+type supplierInput struct {
+	Name        string `json:"Name" binding:"required"`
+	ContactName string `json:"ContactName"`
+	Phone       string `json:"Phone"`
+	Email       string `json:"Email"`
+	Address     string `json:"Address"`
+	TaxID       string `json:"TaxID"`
+	IsActive    *bool  `json:"IsActive"` // ไม่ส่ง = ใช้งานอยู่ (ตอนสร้าง) / ไม่เปลี่ยน (ตอนแก้ไข)
+}
+
+func (in supplierInput) apply(s *entity.Supplier) {
+	s.Name = strings.TrimSpace(in.Name)
+	s.ContactName = strings.TrimSpace(in.ContactName)
+	s.Phone = strings.TrimSpace(in.Phone)
+	s.Email = strings.ToLower(strings.TrimSpace(in.Email))
+	s.Address = strings.TrimSpace(in.Address)
+	s.TaxID = strings.TrimSpace(in.TaxID)
+	if in.IsActive != nil {
+		s.IsActive = *in.IsActive
+	}
+}
+
+// GET /api/suppliers?active=true
+func GetSuppliers(c *gin.Context) {
+	q := configs.DB().Order("name")
+	if c.Query("active") == "true" {
+		q = q.Where("is_active = ?", true)
+	}
+	var items []entity.Supplier
+	if err := q.Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suppliers"})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// POST /api/suppliers
+func CreateSupplier(c *gin.Context) {
+	var in supplierInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload: " + err.Error()})
+		return
+	}
+	s := entity.Supplier{IsActive: true}
+	in.apply(&s)
+	if s.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+
+	db := configs.DB().WithContext(c)
+	var cnt int64
+	db.Model(&entity.Supplier{}).Where("name = ?", s.Name).Count(&cnt)
+	if cnt > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Supplier already exists"})
+		return
+	}
+	// IsActive มี default true ใน DB: ต้องสร้างก่อนแล้วค่อยปิด ถ้าส่ง false มา
+	active := s.IsActive
+	if err := db.Create(&s).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Create supplier failed"})
+		return
+	}
+	if !active {
+		db.Model(&s).Update("is_active", false)
+	}
+	c.JSON(http.StatusCreated, s)
+}
+
+// PUT /api/suppliers/:id
+func UpdateSupplier(c *gin.Context) {
+	db := configs.DB().WithContext(c)
+	var s entity.Supplier
+	if err := db.First(&s, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+	var in supplierInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload: " + err.Error()})
+		return
+	}
+	in.apply(&s)
+	if s.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+	var cnt int64
+	db.Model(&entity.Supplier{}).Where("name = ? AND id <> ?", s.Name, s.ID).Count(&cnt)
+	if cnt > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Supplier already exists"})
+		return
+	}
+	if err := db.Save(&s).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Save failed"})
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// DELETE /api/suppliers/:id  ลบได้เฉพาะผู้ขายที่ยังไม่มีใบสั่งซื้อ (ที่มีแล้วให้ปิดการใช้งานแทน)
+func DeleteSupplier(c *gin.Context) {
+	db := configs.DB().WithContext(c)
+	var s entity.Supplier
+	if err := db.First(&s, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+	var cnt int64
+	db.Model(&entity.PurchaseOrder{}).Where("supplier_id = ?", s.ID).Count(&cnt)
+	if cnt > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "ผู้ขายนี้มีใบสั่งซื้ออยู่แล้ว ให้ปิดการใช้งาน (IsActive=false) แทนการลบ"})
+		return
+	}
+	if err := db.Delete(&s).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Delete failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+}
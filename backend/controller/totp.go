@@ -0,0 +1,603 @@
+package controller
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// TOTP ตาม RFC 6238 (HMAC-SHA1, 6 หลัก, 30 วินาที) ใช้กับแอป authenticator ทั่วไปได้โดยไม่ต้องต่อเน็ต
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	totpSkew   = 1 // ยอมรับรหัสของช่วงเวลาก่อน/หลัง 1 ช่วง (นาฬิกาคลาดเคลื่อน)
+	totpIssuer = "SA Prison"
+
+	mfaChallengeTTL         = 5 * time.Minute
+	mfaChallengeMaxAttempts = 5
+	recoveryCodeCount       = 10
+)
+
+var (
+	totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+	errChallengeInvalid = errors.New("invalid or expired challenge token")
+	errInvalidTOTP      = errors.New("invalid verification code")
+	errNoTOTPSetup      = errors.New("no TOTP setup in progress")
+)
+
+type challengeInput struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+type loginVerifyInput struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+type totpCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type totpDisableInput struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code"`
+	// ใช้ recovery code แทนได้ถ้าเครื่องยืนยันตัวตนหาย
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type rankTOTPInput struct {
+	Required *bool `json:"required" binding:"required"`
+}
+
+// -------- TOTP --------
+
+func newTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+func totpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation (RFC 4226 หัวข้อ 5.3)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod), nil
+}
+
+// verifyTOTP คืน time step ที่ตรงกับรหัส (ต้องมากกว่า lastStep ที่ใช้ไปแล้ว)
+func verifyTOTP(secret, code string, lastStep int64, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits || secret == "" {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		expected, err := totpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpURI ลิงก์ otpauth:// สำหรับสร้าง QR code ในหน้าเว็บ (ไม่ต้องใช้บริการภายนอก)
+func totpURI(username, secret string) string {
+	label := url.PathEscape(totpIssuer + ":" + username)
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", totpIssuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", strconv.Itoa(totpDigits))
+	q.Set("period", strconv.Itoa(totpPeriod))
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// -------- Recovery codes --------
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
+
+// generateRecoveryCodes ลบรหัสเดิมทั้งหมดแล้วสร้างใหม่ (คืนค่าจริงให้แสดงครั้งเดียว)
+func generateRecoveryCodes(tx *gorm.DB, mid int) ([]string, error) {
+	if err := tx.Where("m_id = ?", mid).Delete(&entity.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := randomToken(5)
+		if err != nil {
+			return nil, err
+		}
+		code := raw[:5] + "-" + raw[5:]
+		if err := tx.Create(&entity.RecoveryCode{MID: mid, CodeHash: hashToken(normalizeRecoveryCode(code))}).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+func useRecoveryCode(tx *gorm.DB, mid int, code string) (bool, error) {
+	res := tx.Model(&entity.RecoveryCode{}).
+		Where("m_id = ? AND code_hash = ? AND used_at IS NULL", mid, hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	return res.RowsAffected > 0, res.Error
+}
+
+// -------- Login challenge --------
+
+// mfaPurpose ตัดสินว่าสมาชิกต้องผ่านขั้นที่สองแบบไหน ("" = ไม่ต้อง)
+func mfaPurpose(db *gorm.DB, m entity.Member) (string, error) {
+	if m.TOTPEnabled {
+		return entity.MFAVerify, nil
+	}
+	var rank entity.Rank
+	if err := db.First(&rank, "rank_id = ?", m.RankID).Error; err != nil {
+		return "", err
+	}
+	if rank.RequireTOTP {
+		return entity.MFASetup, nil
+	}
+	return "", nil
+}
+
+func createLoginChallenge(db *gorm.DB, mid int, purpose string) (string, error) {
+	raw, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	return raw, db.Create(&entity.LoginChallenge{
+		MID:       mid,
+		TokenHash: hashToken(raw),
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(mfaChallengeTTL),
+	}).Error
+}
+
+func loadLoginChallenge(db *gorm.DB, raw string) (entity.LoginChallenge, error) {
+	var ch entity.LoginChallenge
+	if err := db.Where("token_hash = ?", hashToken(strings.TrimSpace(raw))).First(&ch).Error; err != nil {
+		return ch, errChallengeInvalid
+	}
+	if ch.UsedAt != nil || time.Now().After(ch.ExpiresAt) || ch.Attempts >= mfaChallengeMaxAttempts {
+		return ch, errChallengeInvalid
+	}
+	return ch, nil
+}
+
+// checkMemberTOTP ตรวจรหัส TOTP ของสมาชิกที่เปิดใช้แล้ว หรือ recovery code และบันทึก step ที่ใช้
+func checkMemberTOTP(tx *gorm.DB, m entity.Member, code, recovery string) error {
+	if strings.TrimSpace(recovery) != "" {
+		ok, err := useRecoveryCode(tx, m.MID, recovery)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errInvalidTOTP
+		}
+		return nil
+	}
+	step, ok := verifyTOTP(m.TOTPSecret, code, m.TOTPLastStep, time.Now())
+	if !ok {
+		return errInvalidTOTP
+	}
+	return tx.Model(&entity.Member{}).Where("m_id = ?", m.MID).Update("totp_last_step", step).Error
+}
+
+// enableTOTP ยืนยันรหัสจาก PendingSecret แล้วเปิดใช้ TOTP พร้อมสร้าง recovery codes
+func enableTOTP(tx *gorm.DB, m entity.Member, code string) ([]string, error) {
+	if m.TOTPPendingSecret == "" {
+		return nil, errNoTOTPSetup
+	}
+	step, ok := verifyTOTP(m.TOTPPendingSecret, code, 0, time.Now())
+	if !ok {
+		return nil, errInvalidTOTP
+	}
+	if err := tx.Model(&entity.Member{}).Where("m_id = ?", m.MID).Updates(map[string]any{
+		"totp_enabled":        true,
+		"totp_secret":         m.TOTPPendingSecret,
+		"totp_pending_secret": "",
+		"totp_last_step":      step,
+	}).Error; err != nil {
+		return nil, err
+	}
+	return generateRecoveryCodes(tx, m.MID)
+}
+
+func startTOTPSetup(db *gorm.DB, m entity.Member) (gin.H, error) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Model(&entity.Member{}).Where("m_id = ?", m.MID).Update("totp_pending_secret", secret).Error; err != nil {
+		return nil, err
+	}
+	return gin.H{"secret": secret, "otpauth_uri": totpURI(m.Username, secret)}, nil
+}
+
+func sessionResponse(m entity.Member, access, refresh string) gin.H {
+	return gin.H{
+		"access_token":  access,
+		"refresh_token": refresh,
+		"user": gin.H{
+			"MID":       m.MID,
+			"username":  m.Username,
+			"firstName": m.FirstName,
+			"lastName":  m.LastName,
+			"rankId":    m.RankID,
+			"citizenId": m.CitizenID,
+		},
+	}
+}
+
+// -------- Handlers: login ขั้นที่สอง --------
+
+// POST /api/auth/login/totp-setup  { "challenge_token": "..." }
+// rank บังคับ TOTP แต่สมาชิกยังไม่ลงทะเบียน: ออก secret ให้สแกนก่อนยืนยันที่ /auth/login/verify
+func LoginTOTPSetup(c *gin.Context) {
+	var in challengeInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	db := configs.DB().WithContext(c)
+	ch, err := loadLoginChallenge(db, in.ChallengeToken)
+	if err != nil || ch.Purpose != entity.MFASetup {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errChallengeInvalid.Error()})
+		return
+	}
+	var m entity.Member
+	if err := db.First(&m, "m_id = ?", ch.MID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errChallengeInvalid.Error()})
+		return
+	}
+	setup, err := startTOTPSetup(db, m)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot start TOTP setup: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, setup)
+}
+
+// POST /api/auth/login/verify  { "challenge_token": "...", "code": "123456" } หรือ { ..., "recovery_code": "abcde-12345" }
+func LoginVerify(c *gin.Context) {
+	var in loginVerifyInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	db := configs.DB().WithContext(c)
+	ch, err := loadLoginChallenge(db, in.ChallengeToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	var m entity.Member
+	if err := db.First(&m, "m_id = ?", ch.MID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": errChallengeInvalid.Error()})
+		return
+	}
+
+	// ใช้กฎหน่วงเวลา/ล็อกบัญชีเดียวกับการใส่รหัสผ่าน
+	denied, err := checkLoginAllowed(db, c.ClientIP(), &m)
+	if err != nil {
+		log.Printf("login verify: check login allowed for %s: %v", m.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed, please try again"})
+		return
+	}
+	if denied != nil {
+		recordLoginAttempt(db, c, &m.MID, m.Username, denied.result)
+		abortLogin(c, denied)
+		return
+	}
+
+	var (
+		signed, rawRefresh string
+		recoveryCodes      []string
+	)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		switch ch.Purpose {
+		case entity.MFASetup:
+			codes, err := enableTOTP(tx, m, in.Code)
+			if err != nil {
+				return err
+			}
+			recoveryCodes = codes
+		default:
+			if err := checkMemberTOTP(tx, m, in.Code, in.RecoveryCode); err != nil {
+				return err
+			}
+		}
+		// challenge ใช้ได้ครั้งเดียว
+		res := tx.Model(&entity.LoginChallenge{}).Where("id = ? AND used_at IS NULL", ch.ID).Update("used_at", time.Now())
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errChallengeInvalid
+		}
+		var err error
+		signed, _, rawRefresh, err = issueSession(tx, m)
+		return err
+	})
+	if errors.Is(err, errInvalidTOTP) {
+		db.Model(&entity.LoginChallenge{}).Where("id = ?", ch.ID).Update("attempts", gorm.Expr("attempts + 1"))
+		registerLoginFailure(db, c, m, entity.LoginBadTOTP)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errChallengeInvalid) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, errNoTOTPSetup) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("login verify: %s: %v", m.Username, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "login failed, please try again"})
+		return
+	}
+
+	recordLoginAttempt(db, c, &m.MID, m.Username, entity.LoginSuccess)
+	resp := sessionResponse(m, signed, rawRefresh)
+	if recoveryCodes != nil {
+		resp["recovery_codes"] = recoveryCodes
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// -------- Handlers: จัดการ TOTP ของตัวเอง --------
+
+func currentMember(c *gin.Context) (entity.Member, bool) {
+	var m entity.Member
+	mid := midFromContext(c)
+	if mid == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return m, false
+	}
+	if err := configs.DB().First(&m, "m_id = ?", *mid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+		return m, false
+	}
+	return m, true
+}
+
+// GET /api/me/totp
+func GetMyTOTP(c *gin.Context) {
+	m, ok := currentMember(c)
+	if !ok {
+		return
+	}
+	var rank entity.Rank
+	configs.DB().First(&rank, "rank_id = ?", m.RankID)
+	var remaining int64
+	configs.DB().Model(&entity.RecoveryCode{}).Where("m_id = ? AND used_at IS NULL", m.MID).Count(&remaining)
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  m.TOTPEnabled,
+		"required":                 rank.RequireTOTP,
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+// POST /api/me/totp/setup  ออก secret ใหม่ (ยังไม่เปิดใช้จนกว่าจะยืนยันรหัสที่ /me/totp/enable)
+func SetupMyTOTP(c *gin.Context) {
+	m, ok := currentMember(c)
+	if !ok {
+		return
+	}
+	if m.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "TOTP is already enabled"})
+		return
+	}
+	setup, err := startTOTPSetup(configs.DB().WithContext(c), m)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot start TOTP setup: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, setup)
+}
+
+// POST /api/me/totp/enable  { "code": "123456" }  คืน recovery codes (แสดงครั้งเดียว)
+func EnableMyTOTP(c *gin.Context) {
+	var in totpCodeInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	m, ok := currentMember(c)
+	if !ok {
+		return
+	}
+	if m.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "TOTP is already enabled"})
+		return
+	}
+	var codes []string
+	err := configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = enableTOTP(tx, m, in.Code)
+		return err
+	})
+	if errors.Is(err, errInvalidTOTP) || errors.Is(err, errNoTOTPSetup) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to enable TOTP: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": true, "recovery_codes": codes})
+}
+
+// POST /api/me/totp/disable  { "password": "...", "code": "123456" }
+func DisableMyTOTP(c *gin.Context) {
+	var in totpDisableInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	m, ok := currentMember(c)
+	if !ok {
+		return
+	}
+	if !m.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "TOTP is not enabled"})
+		return
+	}
+	var rank entity.Rank
+	if err := configs.DB().First(&rank, "rank_id = ?", m.RankID).Error; err == nil && rank.RequireTOTP {
+		c.JSON(http.StatusConflict, gin.H{"error": "TOTP is mandatory for your rank"})
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(m.Password), []byte(in.Password)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "password is incorrect"})
+		return
+	}
+
+	err := configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := checkMemberTOTP(tx, m, in.Code, in.RecoveryCode); err != nil {
+			return err
+		}
+		return resetMemberTOTP(tx, m.MID)
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": false})
+}
+
+// POST /api/me/totp/recovery-codes  { "code": "123456" }  ออก recovery codes ชุดใหม่ (ชุดเดิมใช้ไม่ได้)
+func RegenerateMyRecoveryCodes(c *gin.Context) {
+	var in totpCodeInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	m, ok := currentMember(c)
+	if !ok {
+		return
+	}
+	if !m.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "TOTP is not enabled"})
+		return
+	}
+	var codes []string
+	err := configs.DB().WithContext(c).Transaction(func(tx *gorm.DB) error {
+		if err := checkMemberTOTP(tx, m, in.Code, ""); err != nil {
+			return err
+		}
+		var err error
+		codes, err = generateRecoveryCodes(tx, m.MID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// -------- Handlers: แอดมิน --------
+
+func resetMemberTOTP(tx *gorm.DB, mid int) error {
+	if err := tx.Model(&entity.Member{}).Where("m_id = ?", mid).Updates(map[string]any{
+		"totp_enabled":        false,
+		"totp_secret":         "",
+		"totp_pending_secret": "",
+		"totp_last_step":      0,
+	}).Error; err != nil {
+		return err
+	}
+	return tx.Where("m_id = ?", mid).Delete(&entity.RecoveryCode{}).Error
+}
+
+// DELETE /api/members/:id/totp  ล้าง TOTP ของสมาชิกที่ทำเครื่องหาย (login ครั้งถัดไปต้องลงทะเบียนใหม่ถ้า rank บังคับ)
+func ResetMemberTOTP(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid member id"})
+		return
+	}
+	db := configs.DB().WithContext(c)
+	var m entity.Member
+	if err := db.First(&m, "m_id = ?", id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+		return
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := resetMemberTOTP(tx, id); err != nil {
+			return err
+		}
+		return revokeMemberSessions(tx, id)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to reset TOTP"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "TOTP reset"})
+}
+
+// PUT /api/ranks/:id/totp  { "required": true }  บังคับ/ไม่บังคับ TOTP ทั้ง rank
+func UpdateRankTOTP(c *gin.Context) {
+	var in rankTOTPInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+	db := configs.DB().WithContext(c)
+	var rank entity.Rank
+	if err := db.First(&rank, "rank_id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "rank not found"})
+		return
+	}
+	if err := db.Model(&rank).Update("require_totp", *in.Required).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update rank"})
+		return
+	}
+	rank.RequireTOTP = *in.Required
+	c.JSON(http.StatusOK, rank)
+}
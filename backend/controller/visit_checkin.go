@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+type DepositedItemInput struct {
+	Item_Name string `json:"Item_Name"`
+	Quantity  int    `json:"Quantity"`
+}
+
+// ผู้บันทึกเช็คอิน/เช็คเอาท์คือสมาชิกที่ login อยู่ ไม่รับจาก body
+type VisitCheckInInput struct {
+	Identity_Verified bool                 `json:"Identity_Verified"`
+	Items             []DepositedItemInput `json:"Items"`
+}
+
+func preloadVisitCheckIn(db *gorm.DB) *gorm.DB {
+	return db.Preload("Visitor").Preload("Inmate").Preload("TimeSlot").Preload("Status").
+		Preload("CheckInBy").Preload("CheckOutBy").Preload("DepositedItems")
+}
+
+// applyNoShowRestriction นับการไม่มาตามนัดของผู้เยี่ยมในช่วง NoShowWindowDays วัน
+// ถ้าครบ NoShowLimit ครั้ง ระงับการจองเยี่ยม NoShowRestrictDays วันนับจาก today
+func applyNoShowRestriction(tx *gorm.DB, visitorID uint, today time.Time) (bool, error) {
+	rules, err := loadVisitationRules(tx)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	q := tx.Model(&entity.Visitation{}).Where("visitor_id = ? AND status_id = ?", visitorID, statusNoShow)
+	if rules.NoShowWindowDays > 0 {
+		q = q.Where("visit_date >= ?", today.AddDate(0, 0, -rules.NoShowWindowDays))
+	}
+	var count int64
+	if err := q.Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	updates := map[string]interface{}{"no_show_count": count}
+	restricted := false
+	if rules.NoShowLimit > 0 && rules.NoShowRestrictDays > 0 && int(count) >= rules.NoShowLimit {
+		var visitor entity.Visitor
+		if err := tx.First(&visitor, visitorID).Error; err != nil {
+			return false, err
+		}
+		until := today.AddDate(0, 0, rules.NoShowRestrictDays)
+		if visitor.Restricted_Until == nil || visitor.Restricted_Until.Before(until) {
+			updates["restricted_until"] = until
+			restricted = true
+		}
+	}
+	return restricted, tx.Model(&entity.Visitor{}).Where("id = ?", visitorID).Updates(updates).Error
+}
+
+// -------- Handlers --------
+
+// POST /api/visitations/:id/checkin  เจ้าหน้าที่จุดตรวจบันทึกว่าผู้เยี่ยมมาถึงแล้ว
+func CheckInVisitation(c *gin.Context) {
+	var input VisitCheckInInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	if !input.Identity_Verified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ต้องตรวจสอบบัตรประชาชนของผู้เยี่ยมก่อนเช็คอิน"})
+		return
+	}
+	for i := range input.Items {
+		input.Items[i].Item_Name = strings.TrimSpace(input.Items[i].Item_Name)
+		if input.Items[i].Item_Name == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "กรุณาระบุชื่อสิ่งของที่ฝาก"})
+			return
+		}
+		if input.Items[i].Quantity <= 0 {
+			input.Items[i].Quantity = 1
+		}
+	}
+
+	db := configs.DB().WithContext(c)
+	var item entity.Visitation
+	if err := db.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Visitation not found"})
+		return
+	}
+	if item.CheckIn_At != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "การเยี่ยมนี้เช็คอินไปแล้ว"})
+		return
+	}
+	if item.Status_ID == nil || *item.Status_ID != statusApproved {
+		c.JSON(http.StatusConflict, gin.H{"error": "เช็คอินได้เฉพาะการเยี่ยมที่อนุมัติแล้วเท่านั้น"})
+		return
+	}
+	if item.Visit_Date.Format("2006-01-02") != time.Now().Format("2006-01-02") {
+		c.JSON(http.StatusConflict, gin.H{"error": "เช็คอินได้เฉพาะในวันที่นัดเยี่ยมเท่านั้น"})
+		return
+	}
+
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&item).Updates(map[string]interface{}{
+			"check_in_at":       now,
+			"check_in_by_m_id":  midFromContext(c),
+			"identity_verified": true,
+		}).Error; err != nil {
+			return err
+		}
+		for _, in := range input.Items {
+			deposited := entity.VisitDepositedItem{Visitation_ID: item.ID, Item_Name: in.Item_Name, Quantity: in.Quantity}
+			if err := tx.Create(&deposited).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check in visitation"})
+		return
+	}
+
+	preloadVisitCheckIn(configs.DB()).First(&item, item.ID)
+	c.JSON(http.StatusOK, item)
+}
+
+// POST /api/visitations/:id/checkout  ผู้เยี่ยมออกจากห้องเยี่ยม คืนสิ่งของที่ฝากไว้ และปิดการเยี่ยมเป็น สำเร็จ
+func CheckOutVisitation(c *gin.Context) {
+	db := configs.DB().WithContext(c)
+	var item entity.Visitation
+	if err := db.First(&item, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Visitation not found"})
+		return
+	}
+	if item.CheckIn_At == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "การเยี่ยมนี้ยังไม่ได้เช็คอิน"})
+		return
+	}
+	if item.CheckOut_At != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "การเยี่ยมนี้เช็คเอาท์ไปแล้ว"})
+		return
+	}
+
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&item).Updates(map[string]interface{}{
+			"check_out_at":      now,
+			"check_out_by_m_id": midFromContext(c),
+			"status_id":         statusCompleted,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&entity.VisitDepositedItem{}).
+			Where("visitation_id = ? AND returned_at IS NULL", item.ID).
+			Update("returned_at", now).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check out visitation"})
+		return
+	}
+
+	preloadVisitCheckIn(configs.DB()).First(&item, item.ID)
+	c.JSON(http.StatusOK, item)
+}
+
+// DELETE /api/visitors/:id/restriction  ยกเลิกการระงับสิทธิ์จองเยี่ยมของผู้เยี่ยม
+func LiftVisitorRestriction(c *gin.Context) {
+	db := configs.DB().WithContext(c)
+	var visitor entity.Visitor
+	if err := db.First(&visitor, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Visitor not found"})
+		return
+	}
+	if err := db.Model(&visitor).Updates(map[string]interface{}{
+		"restricted_until": nil,
+		"no_show_count":    0,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lift restriction"})
+		return
+	}
+	c.JSON(http.StatusOK, visitor)
+}
+
+func init() {
+	RegisterJob(&Job{
+		Name:        "mark-visitation-no-shows",
+		Description: "เปลี่ยนการเยี่ยมที่อนุมัติแล้วแต่ไม่เช็คอินจนหมดช่วงเวลาเป็น ไม่มาตามนัด และระงับสิทธิ์ผู้เยี่ยมที่ไม่มาซ้ำ",
+		Interval:    15 * time.Minute,
+		Run:         markVisitationNoShows,
+	})
+}
+
+func markVisitationNoShows(db *gorm.DB) (int, string, error) {
+	now := time.Now()
+	// visit_date เก็บเป็นเที่ยงคืน UTC ของวันที่จอง
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	clock := now.Format("15:04")
+
+	marked, restricted := 0, 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var candidates []entity.Visitation
+		if err := tx.Preload("TimeSlot").
+			Where("status_id = ? AND check_in_at IS NULL AND visit_date <= ?", statusApproved, today).
+			Find(&candidates).Error; err != nil {
+			return err
+		}
+
+		visitors := map[uint]bool{}
+		for _, v := range candidates {
+			// วันนี้: ยังไม่หมดช่วงเวลาเยี่ยม
+			if !v.Visit_Date.Before(today) && v.TimeSlot.End_Time > clock {
+				continue
+			}
+			if err := tx.Model(&entity.Visitation{}).Where("id = ?", v.ID).Update("status_id", statusNoShow).Error; err != nil {
+				return err
+			}
+			marked++
+			if v.Visitor_ID != nil {
+				visitors[*v.Visitor_ID] = true
+			}
+		}
+		for visitorID := range visitors {
+			ok, err := applyNoShowRestriction(tx, visitorID, today)
+			if err != nil {
+				return err
+			}
+			if ok {
+				restricted++
+			}
+		}
+		return nil
+	})
+	return marked, fmt.Sprintf("ไม่มาตามนัด %d รายการ, ระงับสิทธิ์ผู้เยี่ยม %d คน", marked, restricted), err
+}
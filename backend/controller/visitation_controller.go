@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
@@ -21,18 +23,32 @@ type VisitationInput struct {
 	VisitorFirstName string `json:"VisitorFirstName"`
 	VisitorLastName  string `json:"VisitorLastName"`
 	VisitorCitizenID string `json:"VisitorCitizenID"`
+	VisitingArea_ID  *uint  `json:"VisitingArea_ID"` // ไม่ระบุ = ระบบเลือกห้องที่ยังว่าง
+	Visitor_Count    int    `json:"Visitor_Count"`   // จำนวนผู้มาเยี่ยม (ไม่ระบุ = 1)
+}
+
+// visitorMatchesCaller: ญาติ (rank 3) ต้องจองในนามตัวเอง (เลขบัตรตรงกับใน token)
+func visitorMatchesCaller(c *gin.Context, citizenID string) bool {
+	rankId, _ := c.Get("rankId")
+	if id, ok := rankId.(int); !ok || id != 3 {
+		return true
+	}
+	own, _ := c.Get("citizenId")
+	ownID, _ := own.(string)
+	return ownID == citizenID
 }
 
 // -------------------- GET /visitations --------------------
 func GetVisitations(c *gin.Context) {
 	var items []entity.Visitation
-	query := configs.DB().
+	query := configs.DB().WithContext(c).
 		Preload("Inmate").
 		Preload("Visitor").
 		Preload("Staff").
 		Preload("Status").
 		Preload("Relationship").
 		Preload("TimeSlot").
+		Preload("DepositedItems").
 		Order("visit_date desc")
 
 	rankId, _ := c.Get("rankId")
@@ -48,7 +64,7 @@ func GetVisitations(c *gin.Context) {
 
 		var visitor entity.Visitor
 		// Find the visitor's ID from their citizen ID
-		if err := configs.DB().Where("citizen_id = ?", userCitizenID).First(&visitor).Error; err != nil {
+		if err := configs.DB().WithContext(c).Where("citizen_id = ?", userCitizenID).First(&visitor).Error; err != nil {
 			// If no visitor record found, return an empty list
 			c.JSON(http.StatusOK, []entity.Visitation{})
 			return
@@ -84,8 +100,20 @@ func CreateVisitation(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Please use YYYY-MM-DD."})
 		return
 	}
+	if input.Visitor_Count <= 0 {
+		input.Visitor_Count = 1
+	}
+
+	if !visitorMatchesCaller(c, input.VisitorCitizenID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "ญาติจองการเยี่ยมได้เฉพาะในนามของตนเองเท่านั้น"})
+		return
+	}
+	// ญาติกำหนดสถานะเองไม่ได้: ทุกการจอง/แก้ไขของญาติต้องรอเจ้าหน้าที่อนุมัติ
+	if !isStaff(c) {
+		input.Status_ID = statusPending
+	}
 
-	tx := configs.DB().Begin()
+	tx := configs.DB().WithContext(c).Begin()
 
 	// Find existing visitor or create a new one
 	var visitor entity.Visitor
@@ -101,16 +129,51 @@ func CreateVisitation(c *gin.Context) {
 		return
 	}
 
-	// Check for booking conflicts
-	var existingVisit entity.Visitation
-	err = tx.Where("visit_date = ? AND time_slot_id = ?", visitDate, input.TimeSlot_ID).First(&existingVisit).Error
-	if err == nil {
+	// Only visitors on the inmate's approved list may book
+	if err := ensureApprovedVisitor(tx, input.Inmate_ID, visitor.ID, visitDate); err != nil {
+		tx.Rollback()
+		if errors.Is(err, errVisitorNotApproved) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error during visitor approval check"})
+		return
+	}
+
+	// No new bookings while the inmate's room is under lockdown
+	lockdown, err := activeLockdownForPrisoner(tx, input.Inmate_ID, 0)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error during lockdown check"})
+		return
+	}
+	if lockdown != nil {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": lockdownMessage(configs.DB(), lockdown)})
+		return
+	}
+
+	// Visitation rules (weekly quota, blackout dates, suspensions, isolation)
+	reasons, err := evaluateVisitationRules(tx, input.Inmate_ID, visitor.ID, visitDate, input.Visitor_Count, 0)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error during visitation rule check"})
+		return
+	}
+	if len(reasons) > 0 {
 		tx.Rollback()
-		c.JSON(http.StatusConflict, gin.H{"error": "Time slot already booked for this date"})
+		rejectVisitation(c, reasons)
 		return
 	}
-	if err != gorm.ErrRecordNotFound {
+
+	// Check seat capacity of the slot (counted inside the transaction)
+	areaID, err := reserveVisitingSeat(tx, visitDate, input.TimeSlot_ID, input.VisitingArea_ID, 0)
+	if err != nil {
 		tx.Rollback()
+		if errors.Is(err, errSlotFull) || errors.Is(err, errAreaNotFound) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error during booking check"})
 		return
 	}
@@ -118,12 +181,14 @@ func CreateVisitation(c *gin.Context) {
 	// Create the new visitation record
 	item := entity.Visitation{
 		Visit_Date:      visitDate,
+		Visitor_Count:   input.Visitor_Count,
 		TimeSlot_ID:     &input.TimeSlot_ID,
 		Staff_ID:        &input.Staff_ID,
 		Status_ID:       &input.Status_ID,
 		Relationship_ID: &input.Relationship_ID,
 		Visitor_ID:      &visitor.ID,
 		Inmate_ID:       &input.Inmate_ID,
+		VisitingArea_ID: &areaID,
 	}
 	if err := tx.Create(&item).Error; err != nil {
 		tx.Rollback()
@@ -132,6 +197,7 @@ func CreateVisitation(c *gin.Context) {
 	}
 
 	tx.Commit()
+	logNotifyError(notifyVisitationStatus(configs.DB(), item, nil))
 	c.JSON(http.StatusCreated, item)
 }
 
@@ -139,7 +205,7 @@ func CreateVisitation(c *gin.Context) {
 func UpdateVisitation(c *gin.Context) {
 	id := c.Param("id")
 	var item entity.Visitation
-	if err := configs.DB().First(&item, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&item, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Visitation not found"})
 		return
 	}
@@ -150,13 +216,21 @@ func UpdateVisitation(c *gin.Context) {
 	if id, ok := rankId.(int); ok && id == 3 {
 		citizenId, _ := c.Get("citizenId")
 		var visitor entity.Visitor
-		configs.DB().Where("citizen_id = ?", citizenId).First(&visitor)
+		configs.DB().WithContext(c).Where("citizen_id = ?", citizenId).First(&visitor)
 		if item.Visitor_ID != nil && *item.Visitor_ID != visitor.ID {
 			c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to edit this record"})
 			return
 		}
 	}
 
+	// แก้ได้เฉพาะคำขอที่รออนุมัติ; ที่อนุมัติแล้วแก้ได้เฉพาะเจ้าหน้าที่ ที่ปิดไปแล้ว (เสร็จสิ้น/ยกเลิก/ไม่มา ฯลฯ) แก้ไม่ได้
+	editable := item.Status_ID != nil &&
+		(*item.Status_ID == statusPending || (*item.Status_ID == statusApproved && isStaff(c)))
+	if !editable {
+		c.JSON(http.StatusConflict, gin.H{"error": "แก้ไขได้เฉพาะการเยี่ยมที่รออนุมัติ (เจ้าหน้าที่แก้การเยี่ยมที่อนุมัติแล้วได้)"})
+		return
+	}
+
 	var input VisitationInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
@@ -168,8 +242,20 @@ func UpdateVisitation(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Please use YYYY-MM-DD."})
 		return
 	}
+	if input.Visitor_Count <= 0 {
+		input.Visitor_Count = 1
+	}
+
+	if !visitorMatchesCaller(c, input.VisitorCitizenID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "ญาติจองการเยี่ยมได้เฉพาะในนามของตนเองเท่านั้น"})
+		return
+	}
+	// ญาติกำหนดสถานะเองไม่ได้: ทุกการจอง/แก้ไขของญาติต้องรอเจ้าหน้าที่อนุมัติ
+	if !isStaff(c) {
+		input.Status_ID = statusPending
+	}
 
-	tx := configs.DB().Begin()
+	tx := configs.DB().WithContext(c).Begin()
 
 	// Handle visitor data
 	var visitor entity.Visitor
@@ -185,28 +271,76 @@ func UpdateVisitation(c *gin.Context) {
 		return
 	}
 
-	// Check for booking conflicts, excluding the current record
-	var existingVisit entity.Visitation
-	err = tx.Where("id <> ? AND visit_date = ? AND time_slot_id = ?", id, visitDate, input.TimeSlot_ID).First(&existingVisit).Error
-	if err == nil {
+	// Only visitors on the inmate's approved list may book
+	if err := ensureApprovedVisitor(tx, input.Inmate_ID, visitor.ID, visitDate); err != nil {
 		tx.Rollback()
-		c.JSON(http.StatusConflict, gin.H{"error": "Time slot already booked for this date"})
+		if errors.Is(err, errVisitorNotApproved) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error during visitor approval check"})
+		return
+	}
+
+	// No rebooking into a room under lockdown (closing the visit as rejected/cancelled is still allowed)
+	if input.Status_ID == statusPending || input.Status_ID == statusApproved {
+		lockdown, err := activeLockdownForPrisoner(tx, input.Inmate_ID, 0)
+		if err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error during lockdown check"})
+			return
+		}
+		if lockdown != nil {
+			tx.Rollback()
+			c.JSON(http.StatusConflict, gin.H{"error": lockdownMessage(configs.DB(), lockdown)})
+			return
+		}
+	}
+
+	// Visitation rules, excluding the current record from the weekly quota
+	reasons, err := evaluateVisitationRules(tx, input.Inmate_ID, visitor.ID, visitDate, input.Visitor_Count, item.ID)
+	if err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error during visitation rule check"})
+		return
+	}
+	if len(reasons) > 0 {
+		tx.Rollback()
+		rejectVisitation(c, reasons)
 		return
 	}
-	if err != gorm.ErrRecordNotFound {
+
+	// Check seat capacity of the slot, excluding the current record
+	areaInput := input.VisitingArea_ID
+	if areaInput == nil {
+		areaInput = item.VisitingArea_ID
+	}
+	areaID, err := reserveVisitingSeat(tx, visitDate, input.TimeSlot_ID, areaInput, item.ID)
+	if errors.Is(err, errSlotFull) && input.VisitingArea_ID == nil {
+		// ห้องเดิมเต็ม ให้ระบบหาห้องอื่นที่ยังว่าง
+		areaID, err = reserveVisitingSeat(tx, visitDate, input.TimeSlot_ID, nil, item.ID)
+	}
+	if err != nil {
 		tx.Rollback()
+		if errors.Is(err, errSlotFull) || errors.Is(err, errAreaNotFound) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error during booking check"})
 		return
 	}
 
 	// Update fields
+	oldStatus := item.Status_ID
 	item.Visit_Date = visitDate
+	item.Visitor_Count = input.Visitor_Count
 	item.TimeSlot_ID = &input.TimeSlot_ID
 	item.Inmate_ID = &input.Inmate_ID
 	item.Staff_ID = &input.Staff_ID
 	item.Status_ID = &input.Status_ID
 	item.Relationship_ID = &input.Relationship_ID
 	item.Visitor_ID = &visitor.ID
+	item.VisitingArea_ID = &areaID
 
 	if err := tx.Save(&item).Error; err != nil {
 		tx.Rollback()
@@ -215,6 +349,7 @@ func UpdateVisitation(c *gin.Context) {
 	}
 
 	tx.Commit()
+	logNotifyError(notifyVisitationStatus(configs.DB(), item, oldStatus))
 	c.JSON(http.StatusOK, item)
 }
 
@@ -222,7 +357,7 @@ func UpdateVisitation(c *gin.Context) {
 func DeleteVisitation(c *gin.Context) {
 	id := c.Param("id")
 	var item entity.Visitation
-	if err := configs.DB().First(&item, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).First(&item, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Visitation not found"})
 		return
 	}
@@ -233,17 +368,78 @@ func DeleteVisitation(c *gin.Context) {
 	if id, ok := rankId.(int); ok && id == 3 {
 		citizenId, _ := c.Get("citizenId")
 		var visitor entity.Visitor
-		configs.DB().Where("citizen_id = ?", citizenId).First(&visitor)
+		configs.DB().WithContext(c).Where("citizen_id = ?", citizenId).First(&visitor)
 		if item.Visitor_ID != nil && *item.Visitor_ID != visitor.ID {
 			c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to delete this record"})
 			return
 		}
 	}
 
-	if err := configs.DB().Delete(&entity.Visitation{}, id).Error; err != nil {
+	if err := configs.DB().WithContext(c).Delete(&entity.Visitation{}, id).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete visitation"})
 		return
 	}
 
+	// เจ้าหน้าที่ลบการเยี่ยมที่ยังไม่เกิดขึ้น -> แจ้งญาติ
+	if isStaff(c) && item.Status_ID != nil && (*item.Status_ID == statusPending || *item.Status_ID == statusApproved) {
+		logNotifyError(notifyVisitation(configs.DB(), item, NotifyVisitCancelled, "เจ้าหน้าที่ยกเลิกรายการเยี่ยม"))
+	}
+
 	c.JSON(http.StatusOK, gin.H{"message": "Visitation deleted successfully"})
 }
+
+// cancelUpcomingVisitations ยกเลิกการเยี่ยมที่ยังไม่เกิดขึ้น (รอ/อนุมัติ) ของผู้ต้องขัง คืนรายการที่ถูกยกเลิกไว้แจ้งญาติ
+func cancelUpcomingVisitations(tx *gorm.DB, inmateIDs []uint, from time.Time, reason string) ([]entity.Visitation, error) {
+	return cancelVisitationsWhere(tx, from, reason, "inmate_id IN ?", inmateIDs)
+}
+
+// cancelVisitorUpcomingVisitations ยกเลิกการเยี่ยมที่ยังไม่เกิดขึ้นของผู้เยี่ยมคนหนึ่งกับผู้ต้องขังคนหนึ่ง (เช่น ถูกถอนสิทธิ์เยี่ยม)
+func cancelVisitorUpcomingVisitations(tx *gorm.DB, inmateID, visitorID uint, from time.Time, reason string) ([]entity.Visitation, error) {
+	return cancelVisitationsWhere(tx, from, reason, "inmate_id = ? AND visitor_id = ?", inmateID, visitorID)
+}
+
+func cancelVisitationsWhere(tx *gorm.DB, from time.Time, reason string, query string, args ...interface{}) ([]entity.Visitation, error) {
+	var items []entity.Visitation
+	if err := tx.Where(query, args...).
+		Where("visit_date >= ? AND status_id IN ?", from, []uint{statusPending, statusApproved}).
+		Find(&items).Error; err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		return items, nil
+	}
+	cancelled := statusCancelled
+	ids := make([]uint, len(items))
+	for i := range items {
+		ids[i] = items[i].ID
+		items[i].Status_ID = &cancelled
+		items[i].Cancel_Reason = reason
+	}
+	err := tx.Model(&entity.Visitation{}).Where("id IN ?", ids).
+		Updates(map[string]interface{}{"status_id": statusCancelled, "cancel_reason": reason}).Error
+	return items, err
+}
+
+func init() {
+	RegisterJob(&Job{
+		Name:        "expire-pending-visitations",
+		Description: "เปลี่ยนคำขอเยี่ยมที่ยังรออนุมัติแต่เลยวันเยี่ยมแล้วเป็น หมดอายุ",
+		Interval:    time.Hour,
+		Run:         expirePendingVisitations,
+	})
+}
+
+func expirePendingVisitations(db *gorm.DB) (int, string, error) {
+	now := time.Now()
+	// visit_date เก็บเป็นเที่ยงคืน UTC ของวันเยี่ยม ต้องเทียบด้วยเที่ยงคืน UTC เช่นกัน
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	res := db.Model(&entity.Visitation{}).
+		Where("status_id = ? AND visit_date < ?", statusPending, today).
+		Update("status_id", statusExpired)
+	if res.Error != nil {
+		return 0, "", res.Error
+	}
+	n := int(res.RowsAffected)
+	return n, fmt.Sprintf("คำขอเยี่ยมหมดอายุ %d รายการ", n), nil
+}
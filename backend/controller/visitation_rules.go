@@ -0,0 +1,429 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+type VisitationRuleSetInput struct {
+	Enabled             bool `json:"Enabled"`
+	MaxVisitsPerWeek    int  `json:"MaxVisitsPerWeek"`
+	MaxVisitorsPerVisit int  `json:"MaxVisitorsPerVisit"`
+	MinScore            int  `json:"MinScore"`
+	IsolationDays       int  `json:"IsolationDays"`
+	NoShowLimit         int  `json:"NoShowLimit"`
+	NoShowWindowDays    int  `json:"NoShowWindowDays"`
+	NoShowRestrictDays  int  `json:"NoShowRestrictDays"`
+}
+
+type VisitBlackoutInput struct {
+	StartDate string `json:"StartDate" binding:"required"` // YYYY-MM-DD
+	EndDate   string `json:"EndDate"`                      // ไม่ระบุ = วันเดียว
+	Reason    string `json:"Reason" binding:"required"`
+}
+
+type VisitSuspensionInput struct {
+	Prisoner_ID uint   `json:"Prisoner_ID" binding:"required"`
+	StartDate   string `json:"StartDate"` // ไม่ระบุ = วันนี้
+	EndDate     string `json:"EndDate"`   // ไม่ระบุ = จนกว่าจะยกเลิก
+	Reason      string `json:"Reason" binding:"required"`
+}
+
+// -------- Rule evaluation --------
+
+func loadVisitationRules(db *gorm.DB) (entity.VisitationRuleSet, error) {
+	var rules entity.VisitationRuleSet
+	err := db.First(&rules, 1).Error
+	return rules, err
+}
+
+// evaluateVisitationRules ตรวจกฎการเยี่ยมทั้งหมด คืนเหตุผลที่ไม่อนุญาต (ว่าง = จองได้)
+// visitorID = 0 คือยังไม่รู้ตัวผู้เยี่ยม (ข้ามการตรวจการระงับสิทธิ์ผู้เยี่ยม)
+// excludeID = รายการเยี่ยมที่กำลังแก้ไข ไม่นับรวมในโควตาต่อสัปดาห์
+func evaluateVisitationRules(tx *gorm.DB, prisonerID, visitorID uint, visitDate time.Time, visitorCount int, excludeID uint) ([]string, error) {
+	rules, err := loadVisitationRules(tx)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !rules.Enabled {
+		return nil, nil
+	}
+
+	reasons := []string{}
+	nextDay := visitDate.AddDate(0, 0, 1)
+
+	// 1) วันงดเยี่ยมทั้งเรือนจำ
+	var blackouts []entity.VisitBlackout
+	if err := tx.Where("start_date < ? AND end_date >= ?", nextDay, visitDate).Find(&blackouts).Error; err != nil {
+		return nil, err
+	}
+	for _, b := range blackouts {
+		reasons = append(reasons, fmt.Sprintf("วันที่ %s งดเยี่ยม: %s", visitDate.Format("2006-01-02"), b.Reason))
+	}
+
+	// 2) ผู้ต้องขังถูกสั่งงดเยี่ยม
+	var suspensions []entity.VisitSuspension
+	if err := tx.Where("prisoner_id = ? AND start_date < ?", prisonerID, nextDay).
+		Where("end_date IS NULL OR end_date >= ?", visitDate).
+		Find(&suspensions).Error; err != nil {
+		return nil, err
+	}
+	for _, s := range suspensions {
+		until := "จนกว่าจะมีคำสั่งยกเลิก"
+		if s.EndDate != nil {
+			until = "ถึงวันที่ " + s.EndDate.Format("2006-01-02")
+		}
+		reasons = append(reasons, fmt.Sprintf("ผู้ต้องขังถูกงดเยี่ยม%s: %s", until, s.Reason))
+	}
+
+	// 3) คะแนนความประพฤติต่ำกว่าเกณฑ์
+	if rules.MinScore > 0 {
+		var sb entity.ScoreBehavior
+		err := tx.Where("prisoner_id = ?", prisonerID).First(&sb).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil && sb.Score < rules.MinScore {
+			reasons = append(reasons, fmt.Sprintf("ผู้ต้องขังถูกงดเยี่ยมเนื่องจากคะแนนความประพฤติ (%d) ต่ำกว่าเกณฑ์ %d คะแนน", sb.Score, rules.MinScore))
+		}
+	}
+
+	// 4) แยกกักตัวทางการแพทย์
+	if rules.IsolationDays > 0 {
+		var mh entity.Medical_History
+		err := tx.Where("prisoner_id = ? AND isolation = ?", prisonerID, true).
+			Where("date_inspection >= ? AND date_inspection < ?", visitDate.AddDate(0, 0, -(rules.IsolationDays-1)), nextDay).
+			Order("date_inspection desc").
+			First(&mh).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if err == nil {
+			until := mh.Date_Inspection.AddDate(0, 0, rules.IsolationDays-1)
+			reasons = append(reasons, fmt.Sprintf("ผู้ต้องขังอยู่ระหว่างแยกกักตัวทางการแพทย์ตั้งแต่วันที่ %s งดเยี่ยมถึงวันที่ %s",
+				mh.Date_Inspection.Format("2006-01-02"), until.Format("2006-01-02")))
+		}
+	}
+
+	// 5) จำนวนครั้งที่เยี่ยมได้ต่อสัปดาห์ (จันทร์ - อาทิตย์)
+	if rules.MaxVisitsPerWeek > 0 {
+		weekStart := visitDate.AddDate(0, 0, -((int(visitDate.Weekday()) + 6) % 7))
+		weekEnd := weekStart.AddDate(0, 0, 7)
+		var count int64
+		q := tx.Model(&entity.Visitation{}).
+			Where("inmate_id = ? AND visit_date >= ? AND visit_date < ?", prisonerID, weekStart, weekEnd).
+			Where("status_id IS NULL OR status_id NOT IN ?", releasedSeatStatuses)
+		if excludeID != 0 {
+			q = q.Where("id <> ?", excludeID)
+		}
+		if err := q.Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if int(count) >= rules.MaxVisitsPerWeek {
+			reasons = append(reasons, fmt.Sprintf("ผู้ต้องขังได้รับการเยี่ยมครบ %d ครั้งในสัปดาห์ %s ถึง %s แล้ว",
+				rules.MaxVisitsPerWeek, weekStart.Format("2006-01-02"), weekEnd.AddDate(0, 0, -1).Format("2006-01-02")))
+		}
+	}
+
+	// 6) จำนวนผู้มาเยี่ยมต่อครั้ง
+	if rules.MaxVisitorsPerVisit > 0 && visitorCount > rules.MaxVisitorsPerVisit {
+		reasons = append(reasons, fmt.Sprintf("จำนวนผู้มาเยี่ยมต่อครั้งต้องไม่เกิน %d คน", rules.MaxVisitorsPerVisit))
+	}
+
+	// 7) ผู้เยี่ยมถูกระงับสิทธิ์เพราะไม่มาตามนัดซ้ำ
+	if visitorID != 0 {
+		var visitor entity.Visitor
+		if err := tx.First(&visitor, visitorID).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		if visitor.Restricted_Until != nil && !visitor.Restricted_Until.Before(visitDate) {
+			reasons = append(reasons, fmt.Sprintf("ผู้เยี่ยมถูกระงับสิทธิ์การจองถึงวันที่ %s เนื่องจากไม่มาตามนัด %d ครั้ง",
+				visitor.Restricted_Until.Format("2006-01-02"), visitor.No_Show_Count))
+		}
+	}
+
+	return reasons, nil
+}
+
+// rejectVisitation ตอบกลับเมื่อการจองผิดกฎการเยี่ยม
+// ญาติไม่เห็นเหตุผล (มีข้อมูลภายใน เช่น การแยกกักตัว คะแนนความประพฤติ) เหมือน CheckVisitationRules
+func rejectVisitation(c *gin.Context, reasons []string) {
+	if !isStaff(c) {
+		c.JSON(http.StatusConflict, gin.H{"error": "ไม่สามารถจองการเยี่ยมในวันที่เลือกได้ กรุณาเลือกวันอื่นหรือติดต่อเจ้าหน้าที่"})
+		return
+	}
+	c.JSON(http.StatusConflict, gin.H{
+		"error":   "ไม่สามารถจองการเยี่ยมได้: " + strings.Join(reasons, ", "),
+		"reasons": reasons,
+	})
+}
+
+// -------- Handlers --------
+
+// GET /api/visitations/check?inmate_id=&date=YYYY-MM-DD&visitor_count=&visitor_citizen_id=
+// ตรวจกฎการเยี่ยมล่วงหน้า (ให้หน้าจองแสดงเหตุผลก่อนกดยืนยัน; ญาติได้เฉพาะผลผ่าน/ไม่ผ่าน)
+func CheckVisitationRules(c *gin.Context) {
+	inmateID, err := strconv.ParseUint(c.Query("inmate_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "inmate_id is required"})
+		return
+	}
+	visitDate, err := time.Parse("2006-01-02", c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Please use YYYY-MM-DD."})
+		return
+	}
+	visitorCount := 1
+	if v := c.Query("visitor_count"); v != "" {
+		if visitorCount, err = strconv.Atoi(v); err != nil || visitorCount < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "visitor_count ต้องเป็นจำนวนเต็มมากกว่า 0"})
+			return
+		}
+	}
+
+	// ญาติ (rank 3) ตรวจได้เฉพาะในนามตัวเอง และเฉพาะผู้ต้องขังที่ตนได้รับอนุมัติให้เยี่ยม
+	cid := c.Query("visitor_citizen_id")
+	if !isStaff(c) {
+		own, _ := c.Get("citizenId")
+		cid, _ = own.(string)
+	}
+	var visitorID uint
+	if cid != "" {
+		var visitor entity.Visitor
+		if err := configs.DB().Where("citizen_id = ?", cid).First(&visitor).Error; err == nil {
+			visitorID = visitor.ID
+		}
+	}
+	if !isStaff(c) {
+		if visitorID == 0 || ensureApprovedVisitor(configs.DB(), uint(inmateID), visitorID, visitDate) != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "คุณไม่ได้อยู่ในรายชื่อผู้มีสิทธิ์เยี่ยมผู้ต้องขังนี้"})
+			return
+		}
+	}
+
+	reasons, err := evaluateVisitationRules(configs.DB(), uint(inmateID), visitorID, visitDate, visitorCount, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate visitation rules"})
+		return
+	}
+	// ญาติเห็นเฉพาะผลผ่าน/ไม่ผ่าน: เหตุผลมีข้อมูลภายใน (การแยกกักตัว, คะแนนความประพฤติ ฯลฯ)
+	if !isStaff(c) {
+		c.JSON(http.StatusOK, gin.H{"allowed": len(reasons) == 0})
+		return
+	}
+	if reasons == nil {
+		reasons = []string{}
+	}
+	c.JSON(http.StatusOK, gin.H{"allowed": len(reasons) == 0, "reasons": reasons})
+}
+
+// GET /api/visitation-rules
+func GetVisitationRules(c *gin.Context) {
+	rules, err := loadVisitationRules(configs.DB())
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Visitation rules not found"})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// PUT /api/visitation-rules
+func UpdateVisitationRules(c *gin.Context) {
+	var input VisitationRuleSetInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format: " + err.Error()})
+		return
+	}
+	if input.MaxVisitsPerWeek < 0 || input.MaxVisitorsPerVisit < 0 || input.MinScore < 0 || input.IsolationDays < 0 ||
+		input.NoShowLimit < 0 || input.NoShowWindowDays < 0 || input.NoShowRestrictDays < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ค่ากฎการเยี่ยมต้องไม่ติดลบ (0 = ไม่จำกัด)"})
+		return
+	}
+
+	rules := entity.VisitationRuleSet{
+		ID:                  1,
+		Enabled:             input.Enabled,
+		MaxVisitsPerWeek:    input.MaxVisitsPerWeek,
+		MaxVisitorsPerVisit: input.MaxVisitorsPerVisit,
+		MinScore:            input.MinScore,
+		IsolationDays:       input.IsolationDays,
+		NoShowLimit:         input.NoShowLimit,
+		NoShowWindowDays:    input.NoShowWindowDays,
+		NoShowRestrictDays:  input.NoShowRestrictDays,
+	}
+	if err := configs.DB().WithContext(c).Select("*").Save(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update visitation rules"})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// GET /api/visitation-rules/blackouts?from=YYYY-MM-DD  (ไม่ระบุ = ตั้งแต่วันนี้)
+func GetVisitBlackouts(c *gin.Context) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if v := c.Query("from"); v != "" {
+		d, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date, use YYYY-MM-DD"})
+			return
+		}
+		from = d
+	}
+
+	var items []entity.VisitBlackout
+	if err := configs.DB().Where("end_date >= ?", from).Order("start_date asc").Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch blackout dates"})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// POST /api/visitation-rules/blackouts
+func CreateVisitBlackout(c *gin.Context) {
+	var input VisitBlackoutInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format: " + err.Error()})
+		return
+	}
+	start, err := time.Parse("2006-01-02", input.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid StartDate, use YYYY-MM-DD"})
+		return
+	}
+	end := start
+	if input.EndDate != "" {
+		if end, err = time.Parse("2006-01-02", input.EndDate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid EndDate, use YYYY-MM-DD"})
+			return
+		}
+	}
+	if end.Before(start) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "วันสิ้นสุดต้องไม่ก่อนวันเริ่มต้น"})
+		return
+	}
+
+	item := entity.VisitBlackout{
+		StartDate:    start,
+		EndDate:      end,
+		Reason:       strings.TrimSpace(input.Reason),
+		CreatedByMID: midFromContext(c),
+	}
+	if err := configs.DB().WithContext(c).Create(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create blackout"})
+		return
+	}
+	c.JSON(http.StatusCreated, item)
+}
+
+// DELETE /api/visitation-rules/blackouts/:id
+func DeleteVisitBlackout(c *gin.Context) {
+	res := configs.DB().WithContext(c).Delete(&entity.VisitBlackout{}, c.Param("id"))
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete blackout"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Blackout not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Blackout deleted successfully"})
+}
+
+// GET /api/visitation-rules/suspensions?prisoner_id=&active=true
+func GetVisitSuspensions(c *gin.Context) {
+	q := configs.DB().Preload("Prisoner").Order("id desc")
+	if v := c.Query("prisoner_id"); v != "" {
+		q = q.Where("prisoner_id = ?", v)
+	}
+	if c.Query("active") == "true" {
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		q = q.Where("end_date IS NULL OR end_date >= ?", today)
+	}
+
+	var items []entity.VisitSuspension
+	if err := q.Find(&items).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suspensions"})
+		return
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// POST /api/visitation-rules/suspensions
+func CreateVisitSuspension(c *gin.Context) {
+	var input VisitSuspensionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format: " + err.Error()})
+		return
+	}
+
+	now := time.Now()
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if input.StartDate != "" {
+		d, err := time.Parse("2006-01-02", input.StartDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid StartDate, use YYYY-MM-DD"})
+			return
+		}
+		start = d
+	}
+	var end *time.Time
+	if input.EndDate != "" {
+		d, err := time.Parse("2006-01-02", input.EndDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid EndDate, use YYYY-MM-DD"})
+			return
+		}
+		if d.Before(start) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "วันสิ้นสุดต้องไม่ก่อนวันเริ่มต้น"})
+			return
+		}
+		end = &d
+	}
+
+	db := configs.DB().WithContext(c)
+	if err := db.First(&entity.Prisoner{}, input.Prisoner_ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Prisoner not found"})
+		return
+	}
+
+	item := entity.VisitSuspension{
+		Prisoner_ID:  input.Prisoner_ID,
+		StartDate:    start,
+		EndDate:      end,
+		Reason:       strings.TrimSpace(input.Reason),
+		CreatedByMID: midFromContext(c),
+	}
+	if err := db.Create(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create suspension"})
+		return
+	}
+	c.JSON(http.StatusCreated, item)
+}
+
+// DELETE /api/visitation-rules/suspensions/:id  ยกเลิกคำสั่งงดเยี่ยม
+func DeleteVisitSuspension(c *gin.Context) {
+	res := configs.DB().WithContext(c).Delete(&entity.VisitSuspension{}, c.Param("id"))
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete suspension"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Suspension not found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Suspension lifted successfully"})
+}
@@ -0,0 +1,320 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
+	"gorm.io/gorm"
+)
+
+var (
+	errSlotFull     = errors.New("ช่วงเวลานี้ที่นั่งเยี่ยมเต็มแล้ว กรุณาเลือกช่วงเวลาอื่น")
+	errAreaNotFound = errors.New("ไม่พบห้องเยี่ยมที่เลือก หรือห้องเยี่ยมปิดใช้งาน")
+)
+
+// Status ของการเยี่ยมที่ไม่กินที่นั่ง
+var releasedSeatStatuses = []uint{statusRejected, statusExpired, statusCancelled, statusNoShow}
+
+type VisitingAreaInput struct {
+	Area_Name string `json:"Area_Name" binding:"required"`
+	Booths    int    `json:"Booths"`
+	Is_Active *bool  `json:"Is_Active"`
+}
+
+type TimeSlotCapacityInput struct {
+	Areas []struct {
+		VisitingArea_ID uint `json:"VisitingArea_ID" binding:"required"`
+		Max_Visits      int  `json:"Max_Visits"`
+	} `json:"Areas" binding:"required"`
+}
+
+type AreaAvailability struct {
+	VisitingArea_ID uint   `json:"VisitingArea_ID"`
+	Area_Name       string `json:"Area_Name"`
+	Capacity        int    `json:"Capacity"`
+	Booked          int    `json:"Booked"`
+	Remaining       int    `json:"Remaining"`
+}
+
+type SlotAvailability struct {
+	TimeSlot_ID   uint               `json:"TimeSlot_ID"`
+	TimeSlot_Name string             `json:"TimeSlot_Name"`
+	Start_Time    string             `json:"Start_Time"`
+	End_Time      string             `json:"End_Time"`
+	Capacity      int                `json:"Capacity"`
+	Booked        int                `json:"Booked"`
+	Remaining     int                `json:"Remaining"`
+	Areas         []AreaAvailability `json:"Areas"`
+}
+
+// -------- Helpers --------
+
+// slotAreaCapacity ความจุของห้องเยี่ยมในช่วงเวลานั้น (ไม่มีการตั้งค่า = จำนวน booth ของห้อง)
+func slotAreaCapacity(tx *gorm.DB, slotID uint, area entity.VisitingArea) (int, error) {
+	var row entity.TimeSlotCapacity
+	err := tx.Where("time_slot_id = ? AND visiting_area_id = ?", slotID, area.ID).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return area.Booths, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if row.Max_Visits < area.Booths {
+		return row.Max_Visits, nil
+	}
+	return area.Booths, nil
+}
+
+// countSlotBookings นับการเยี่ยมที่ยังกินที่นั่งในวัน/ช่วงเวลา/ห้องเยี่ยม (excludeID = รายการที่กำลังแก้ไข)
+func countSlotBookings(tx *gorm.DB, visitDate time.Time, slotID, areaID, excludeID uint) (int, error) {
+	var count int64
+	q := tx.Model(&entity.Visitation{}).
+		Where("visit_date = ? AND time_slot_id = ? AND visiting_area_id = ?", visitDate, slotID, areaID).
+		Where("status_id IS NULL OR status_id NOT IN ?", releasedSeatStatuses)
+	if excludeID != 0 {
+		q = q.Where("id <> ?", excludeID)
+	}
+	err := q.Count(&count).Error
+	return int(count), err
+}
+
+// reserveVisitingSeat เลือกห้องเยี่ยมที่ยังมีที่ว่าง (หรือตรวจห้องที่ระบุ) ต้องเรียกภายใน transaction ของการจอง
+func reserveVisitingSeat(tx *gorm.DB, visitDate time.Time, slotID uint, areaID *uint, excludeID uint) (uint, error) {
+	var areas []entity.VisitingArea
+	q := tx.Where("is_active = ?", true).Order("id asc")
+	if areaID != nil && *areaID != 0 {
+		q = q.Where("id = ?", *areaID)
+	}
+	if err := q.Find(&areas).Error; err != nil {
+		return 0, err
+	}
+	if len(areas) == 0 {
+		return 0, errAreaNotFound
+	}
+	for _, area := range areas {
+		capacity, err := slotAreaCapacity(tx, slotID, area)
+		if err != nil {
+			return 0, err
+		}
+		booked, err := countSlotBookings(tx, visitDate, slotID, area.ID, excludeID)
+		if err != nil {
+			return 0, err
+		}
+		if booked < capacity {
+			return area.ID, nil
+		}
+	}
+	return 0, errSlotFull
+}
+
+// isUniqueViolation error จาก unique index ของ sqlite (เช่น ชื่อห้องเยี่ยมซ้ำ)
+func isUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// -------- Handlers --------
+
+// GET /api/timeslots/availability?date=YYYY-MM-DD
+func GetTimeSlotAvailability(c *gin.Context) {
+	visitDate, err := time.Parse("2006-01-02", c.Query("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Please use YYYY-MM-DD."})
+		return
+	}
+
+	db := configs.DB()
+	var slots []entity.TimeSlot
+	if err := db.Order("start_time asc").Find(&slots).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch timeslots"})
+		return
+	}
+	var areas []entity.VisitingArea
+	if err := db.Where("is_active = ?", true).Order("id asc").Find(&areas).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch visiting areas"})
+		return
+	}
+
+	out := make([]SlotAvailability, 0, len(slots))
+	for _, slot := range slots {
+		sa := SlotAvailability{
+			TimeSlot_ID:   slot.ID,
+			TimeSlot_Name: slot.TimeSlot_Name,
+			Start_Time:    slot.Start_Time,
+			End_Time:      slot.End_Time,
+			Areas:         []AreaAvailability{},
+		}
+		for _, area := range areas {
+			capacity, err := slotAreaCapacity(db, slot.ID, area)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute availability"})
+				return
+			}
+			booked, err := countSlotBookings(db, visitDate, slot.ID, area.ID, 0)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute availability"})
+				return
+			}
+			remaining := capacity - booked
+			if remaining < 0 {
+				remaining = 0
+			}
+			sa.Areas = append(sa.Areas, AreaAvailability{
+				VisitingArea_ID: area.ID,
+				Area_Name:       area.Area_Name,
+				Capacity:        capacity,
+				Booked:          booked,
+				Remaining:       remaining,
+			})
+			sa.Capacity += capacity
+			sa.Booked += booked
+			sa.Remaining += remaining
+		}
+		out = append(out, sa)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// GET /api/visiting-areas
+func GetVisitingAreas(c *gin.Context) {
+	var areas []entity.VisitingArea
+	if err := configs.DB().Order("id asc").Find(&areas).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch visiting areas"})
+		return
+	}
+	c.JSON(http.StatusOK, areas)
+}
+
+// POST /api/visiting-areas
+func CreateVisitingArea(c *gin.Context) {
+	var input VisitingAreaInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format: " + err.Error()})
+		return
+	}
+	if input.Booths < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "จำนวนช่องเยี่ยมต้องมากกว่า 0"})
+		return
+	}
+	area := entity.VisitingArea{Area_Name: input.Area_Name, Booths: input.Booths, Is_Active: true}
+	if input.Is_Active != nil {
+		area.Is_Active = *input.Is_Active
+	}
+	if err := configs.DB().WithContext(c).Create(&area).Error; err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "ชื่อห้องเยี่ยมซ้ำ"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create visiting area"})
+		return
+	}
+	c.JSON(http.StatusCreated, area)
+}
+
+// PUT /api/visiting-areas/:id
+func UpdateVisitingArea(c *gin.Context) {
+	db := configs.DB().WithContext(c)
+
+	var area entity.VisitingArea
+	if err := db.First(&area, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Visiting area not found"})
+		return
+	}
+	var input VisitingAreaInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format: " + err.Error()})
+		return
+	}
+	if input.Booths < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "จำนวนช่องเยี่ยมต้องมากกว่า 0"})
+		return
+	}
+	area.Area_Name = input.Area_Name
+	area.Booths = input.Booths
+	if input.Is_Active != nil {
+		area.Is_Active = *input.Is_Active
+	}
+	if err := db.Save(&area).Error; err != nil {
+		if isUniqueViolation(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "ชื่อห้องเยี่ยมซ้ำ"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update visiting area"})
+		return
+	}
+	c.JSON(http.StatusOK, area)
+}
+
+// DELETE /api/visiting-areas/:id
+func DeleteVisitingArea(c *gin.Context) {
+	db := configs.DB().WithContext(c)
+	id := c.Param("id")
+
+	var upcoming int64
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC) // visit_date เก็บเป็นเที่ยงคืน UTC
+	db.Model(&entity.Visitation{}).
+		Where("visiting_area_id = ? AND visit_date >= ?", id, today).
+		Where("status_id IS NULL OR status_id NOT IN ?", releasedSeatStatuses).
+		Count(&upcoming)
+	if upcoming > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("ไม่สามารถลบได้ เนื่องจากมีการจองเยี่ยมในห้องนี้ %d รายการ (ปิดใช้งานแทนได้)", upcoming)})
+		return
+	}
+	res := db.Delete(&entity.VisitingArea{}, id)
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete visiting area"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Visiting area not found"})
+		return
+	}
+	db.Where("visiting_area_id = ?", id).Delete(&entity.TimeSlotCapacity{})
+	c.JSON(http.StatusOK, gin.H{"message": "Visiting area deleted successfully"})
+}
+
+// PUT /api/timeslots/:id/capacity  { "Areas": [ { "VisitingArea_ID": 1, "Max_Visits": 3 } ] }
+// Max_Visits = 0 คือปิดรับการเยี่ยมในห้องนั้นสำหรับช่วงเวลานี้
+func SetTimeSlotCapacity(c *gin.Context) {
+	db := configs.DB().WithContext(c)
+
+	var slot entity.TimeSlot
+	if err := db.First(&slot, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Timeslot not found"})
+		return
+	}
+	var input TimeSlotCapacityInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid data format: " + err.Error()})
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, a := range input.Areas {
+			if a.Max_Visits < 0 {
+				return errors.New("Max_Visits ต้องไม่ติดลบ")
+			}
+			if err := tx.First(&entity.VisitingArea{}, a.VisitingArea_ID).Error; err != nil {
+				return fmt.Errorf("ไม่พบห้องเยี่ยม ID %d", a.VisitingArea_ID)
+			}
+			row := entity.TimeSlotCapacity{TimeSlot_ID: slot.ID, VisitingArea_ID: a.VisitingArea_ID, Max_Visits: a.Max_Visits}
+			if err := tx.Save(&row).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	configs.DB().Preload("Capacities.VisitingArea").First(&slot, slot.ID)
+	c.JSON(http.StatusOK, slot)
+}
@@ -9,6 +9,9 @@ type Enrollment struct {
 	Status        int       `json:"status"`
 	Remarks       string    `json:"remarks"`
 
+	// ถูกระงับชั่วคราวโดยการปิดควบคุมพิเศษ (status = 2) คืนสถานะเมื่อยกเลิกการปิดควบคุม
+	Lockdown_ID *uint `json:"lockdown_ID"`
+
 	// --- แก้ไข 2 บรรทัดนี้ ---
 	Schedule_ID      uint              `json:"schedule_ID"`
 	ActivitySchedule *ActivitySchedule `gorm:"foreignKey:Schedule_ID;references:Schedule_ID" json:"activitySchedule"`
@@ -23,6 +23,9 @@ type Petition struct {
 
 	Type_cum_ID *uint
 	Type        PetitionTypeCum `gorm:"foreignKey:Type_cum_ID"`
+
+	// สมาชิกที่บันทึกคำร้อง (รับการแจ้งเตือนเมื่อสถานะเปลี่ยน)
+	CreatedByMID *int `gorm:"column:created_by_m_id"`
 }
 
 // PetitionTypeCum defines the structure for petition types
@@ -12,5 +12,8 @@ type TimeSlot struct {
 	// บอก GORM ว่า TimeSlot หนึ่งอัน มี Visitation ได้หลายอัน
 	// โดยใช้ TimeSlot_ID เป็น Foreign Key
 	Visitation []Visitation `gorm:"foreignKey:TimeSlot_ID"`
+
+	// ความจุต่อห้องเยี่ยมของช่วงเวลานี้
+	Capacities []TimeSlotCapacity `gorm:"foreignKey:TimeSlot_ID"`
 }
 
@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// VisitDepositedItem สิ่งของที่ผู้เยี่ยมฝากไว้ที่จุดตรวจระหว่างการเยี่ยม
+type VisitDepositedItem struct {
+	ID            uint   `gorm:"primaryKey"`
+	Visitation_ID uint   `gorm:"not null;index"`
+	Item_Name     string `gorm:"not null"`
+	Quantity      int    `gorm:"not null;default:1"`
+
+	Returned_At *time.Time // คืนของตอนเช็คเอาท์
+	CreatedAt   time.Time
+}
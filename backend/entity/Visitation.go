@@ -11,6 +11,8 @@ type Visitation struct {
 	Visit_Date       time.Time
 	Visit_Time_Start string
 	Visit_Time_End   string
+	Visitor_Count    int    `gorm:"not null;default:1"` // จำนวนผู้มาเยี่ยมในครั้งนี้
+	Cancel_Reason    string // เหตุผลที่ระบบยกเลิกการเยี่ยม แจ้งให้ญาติทราบ
 
 	Staff_ID *uint
 	Staff    Staff `gorm:"foreignKey:Staff_ID"`
@@ -29,4 +31,20 @@ type Visitation struct {
 
 	TimeSlot_ID *uint
 	TimeSlot    TimeSlot `gorm:"references:ID"`
+
+	VisitingArea_ID *uint
+	VisitingArea    VisitingArea `gorm:"foreignKey:VisitingArea_ID;references:ID"`
+
+	// บันทึกที่จุดตรวจเยี่ยม
+	CheckIn_At        *time.Time
+	CheckOut_At       *time.Time
+	Identity_Verified bool // ตรวจบัตรประชาชนผู้เยี่ยมแล้ว
+
+	// สมาชิกที่ login อยู่ตอนกดเช็คอิน/เช็คเอาท์
+	CheckInByMID  *int    `gorm:"column:check_in_by_m_id"`
+	CheckInBy     *Member `gorm:"foreignKey:CheckInByMID;references:MID"`
+	CheckOutByMID *int    `gorm:"column:check_out_by_m_id"`
+	CheckOutBy    *Member `gorm:"foreignKey:CheckOutByMID;references:MID"`
+
+	DepositedItems []VisitDepositedItem `gorm:"foreignKey:Visitation_ID"`
 }
@@ -0,0 +1,22 @@
+package entity
+
+import "gorm.io/gorm"
+
+// VisitingArea ห้อง/โซนเยี่ยมญาติ Booths = จำนวนช่องเยี่ยม (รับได้พร้อมกันสูงสุด)
+// ชื่อห้องห้ามซ้ำเฉพาะห้องที่ยังไม่ถูกลบ (soft delete) เพื่อให้นำชื่อห้องที่ลบแล้วกลับมาใช้ใหม่ได้
+type VisitingArea struct {
+	gorm.Model
+	Area_Name string `gorm:"uniqueIndex:idx_visiting_areas_area_name,where:deleted_at IS NULL"`
+	Booths    int    `gorm:"not null;default:1"`
+	Is_Active bool   `gorm:"not null"`
+}
+
+// TimeSlotCapacity จำนวนการเยี่ยมพร้อมกันที่ช่วงเวลาหนึ่งรับได้ในแต่ละห้องเยี่ยม
+// ถ้าไม่มีแถวของคู่ช่วงเวลา/ห้อง จะใช้ Booths ของห้องนั้น
+type TimeSlotCapacity struct {
+	TimeSlot_ID     uint `gorm:"primaryKey"`
+	VisitingArea_ID uint `gorm:"primaryKey"`
+	Max_Visits      int  `gorm:"not null"`
+
+	VisitingArea *VisitingArea `gorm:"foreignKey:VisitingArea_ID;references:ID" json:"VisitingArea,omitempty"`
+}
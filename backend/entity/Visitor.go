@@ -15,6 +15,10 @@ type Visitor struct {
 	Age        int
 	Email      string
 
+	// ไม่มาตามนัดซ้ำหลายครั้ง -> ระงับการจองเยี่ยมถึงวันที่กำหนด
+	No_Show_Count    int
+	Restricted_Until *time.Time
+
 	Relationship_ID *uint
 	Relationship    Relationship `gorm:"references:ID"`
 
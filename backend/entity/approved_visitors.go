@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+// ApprovedVisitor รายชื่อผู้มีสิทธิ์เยี่ยมของผู้ต้องขังแต่ละคน
+// Status_ID ใช้ตาราง statuses: 1 รอ..., 2 อนุมัติ, 3 ไม่อนุมัติ
+type ApprovedVisitor struct {
+	ID              uint       `gorm:"primaryKey" json:"ID"`
+	Prisoner_ID     uint       `gorm:"not null;uniqueIndex:idx_approved_visitor" json:"Prisoner_ID"`
+	Visitor_ID      uint       `gorm:"not null;uniqueIndex:idx_approved_visitor" json:"Visitor_ID"`
+	Relationship_ID *uint      `json:"Relationship_ID"`
+	Status_ID       uint       `gorm:"not null;index" json:"Status_ID"`
+	ExpiresAt       *time.Time `json:"ExpiresAt"` // nil = ไม่มีวันหมดอายุ
+	Note            string     `gorm:"type:text" json:"Note"`
+
+	// ผู้ยื่นคำขอ (ญาติ) และเจ้าหน้าที่ผู้อนุมัติ/ปฏิเสธ
+	AppliedByMID  *int       `gorm:"column:applied_by_m_id" json:"AppliedByMID"`
+	ApprovedByMID *int       `gorm:"column:approved_by_m_id" json:"ApprovedByMID"`
+	ApprovedAt    *time.Time `json:"ApprovedAt"`
+
+	CreatedAt time.Time `json:"CreatedAt"`
+	UpdatedAt time.Time `json:"UpdatedAt"`
+
+	Prisoner     *Prisoner     `gorm:"foreignKey:Prisoner_ID;references:Prisoner_ID" json:"Prisoner,omitempty"`
+	Visitor      *Visitor      `gorm:"foreignKey:Visitor_ID;references:ID" json:"Visitor,omitempty"`
+	Relationship *Relationship `gorm:"foreignKey:Relationship_ID;references:ID" json:"Relationship,omitempty"`
+	Status       *Status       `gorm:"foreignKey:Status_ID;references:Status_ID" json:"Status,omitempty"`
+	ApprovedBy   *Member       `gorm:"foreignKey:ApprovedByMID;references:MID" json:"ApprovedBy,omitempty"`
+}
@@ -0,0 +1,20 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditLog บันทึกการ create/update/delete ทุกตาราง (เขียนโดย GORM callback ใน configs/audit.go)
+type AuditLog struct {
+	ID       uint   `gorm:"primaryKey" json:"ID"`
+	Action   string `gorm:"type:varchar(10);not null;index" json:"Action"`  // create | update | delete
+	Entity   string `gorm:"type:varchar(100);not null;index" json:"Entity"` // ชื่อตาราง เช่น prisoners
+	RecordID string `gorm:"type:varchar(100);index" json:"RecordID"`
+	// Changes เป็น JSON: {"ชื่อฟิลด์": {"before": ..., "after": ...}}
+	Changes   json.RawMessage `gorm:"type:text" json:"Changes"`
+	ActorMID  *int            `gorm:"column:actor_m_id;index" json:"ActorMID"` // nil = ระบบ (เช่น job เบื้องหลัง)
+	CreatedAt time.Time       `gorm:"index" json:"CreatedAt"`
+
+	Actor *Member `gorm:"foreignKey:ActorMID;references:MID" json:"Actor,omitempty"`
+}
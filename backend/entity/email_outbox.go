@@ -0,0 +1,31 @@
+package entity
+
+import "time"
+
+// สถานะของอีเมลใน outbox
+const (
+	EmailPending = "pending" // รอส่ง / รอส่งใหม่ตาม NextAttemptAt
+	EmailSent    = "sent"
+	EmailFailed  = "failed" // ส่งไม่สำเร็จจนครบจำนวนครั้ง ต้องสั่งส่งใหม่เอง
+)
+
+// EmailOutbox อีเมลขาออก เก็บลงฐานข้อมูลก่อนส่ง เพื่อไม่ให้หายเมื่อ mail server ล่ม
+// Subject/Body เก็บแบบ render แล้ว (แก้ template ภายหลังไม่กระทบฉบับที่อยู่ในคิว)
+// Body อาจมีรหัสลับ (เช่นรหัสรีเซ็ตรหัสผ่าน) จึงไม่ส่งออกทาง API และล้างทิ้งเมื่อส่งสำเร็จ
+type EmailOutbox struct {
+	ID       uint   `gorm:"primaryKey" json:"ID"`
+	To       string `gorm:"column:to_address;type:varchar(255);not null" json:"To"`
+	Template string `gorm:"type:varchar(40);not null;index" json:"Template"`
+	Language string `gorm:"type:varchar(2);not null" json:"Language"`
+	Subject  string `gorm:"type:varchar(255);not null" json:"Subject"`
+	Body     string `gorm:"type:text;not null" json:"-"`
+
+	Status        string     `gorm:"type:varchar(10);not null;index" json:"Status"`
+	Attempts      int        `gorm:"not null;default:0" json:"Attempts"`
+	NextAttemptAt time.Time  `gorm:"not null;index" json:"NextAttemptAt"`
+	LastError     string     `gorm:"type:text" json:"LastError"`
+	SentAt        *time.Time `json:"SentAt"`
+
+	CreatedAt time.Time `json:"CreatedAt"`
+	UpdatedAt time.Time `json:"UpdatedAt"`
+}
@@ -0,0 +1,30 @@
+package entity
+
+import "time"
+
+// JobRun ประวัติการทำงานของ job เบื้องหลัง (controller/scheduler.go)
+type JobRun struct {
+	ID         uint       `gorm:"primaryKey" json:"ID"`
+	Job        string     `gorm:"type:varchar(100);not null;index" json:"Job"`
+	Trigger    string     `gorm:"type:varchar(20);not null" json:"Trigger"` // schedule | manual
+	Status     string     `gorm:"type:varchar(20);not null" json:"Status"`  // running | success | failed
+	Affected   int        `json:"Affected"`                                 // จำนวนรายการที่ job เปลี่ยน
+	Message    string     `gorm:"type:text" json:"Message"`
+	StartedAt  time.Time  `gorm:"index" json:"StartedAt"`
+	FinishedAt *time.Time `json:"FinishedAt"`
+
+	// ผู้สั่งรันเอง (nil = ตามตารางเวลา)
+	TriggeredByMID *int    `gorm:"column:triggered_by_m_id" json:"TriggeredByMID"`
+	TriggeredBy    *Member `gorm:"foreignKey:TriggeredByMID;references:MID" json:"TriggeredBy,omitempty"`
+}
+
+// AppointmentReminder การแจ้งเตือนนัดตรวจครั้งต่อไปจาก Medical_History (หนึ่งนัดแจ้งครั้งเดียว)
+type AppointmentReminder struct {
+	ID            uint      `gorm:"primaryKey" json:"ID"`
+	MedicalID     int       `gorm:"not null;uniqueIndex:idx_reminder_appointment" json:"MedicalID"`
+	AppointmentAt time.Time `gorm:"not null;uniqueIndex:idx_reminder_appointment" json:"AppointmentAt"`
+	Prisoner_ID   *uint     `gorm:"index" json:"Prisoner_ID"`
+	StaffID       *uint     `json:"StaffID"`
+	Message       string    `gorm:"type:text" json:"Message"`
+	CreatedAt     time.Time `json:"CreatedAt"`
+}
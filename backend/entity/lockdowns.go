@@ -0,0 +1,34 @@
+package entity
+
+import "time"
+
+// ขอบเขตของการปิดควบคุมพิเศษ
+const (
+	LockdownFacility = "facility" // ทั้งเรือนจำ
+	LockdownRoom     = "room"     // เฉพาะห้องขัง
+	LockdownWing     = "wing"     // ทั้งแดน/ปีก (Building + Wing ของห้อง)
+)
+
+// Lockdown การปิดควบคุมพิเศษ (เหตุฉุกเฉิน) EndedAt = nil คือยังมีผลอยู่
+type Lockdown struct {
+	ID       uint   `gorm:"primaryKey" json:"ID"`
+	Scope    string `gorm:"type:varchar(20);not null;index" json:"Scope"`
+	Room_ID  *uint  `json:"Room_ID"`
+	Building string `json:"Building"`
+	Wing     string `json:"Wing"`
+	Reason   string `gorm:"type:varchar(255);not null" json:"Reason"`
+
+	StartedAt    time.Time  `gorm:"not null" json:"StartedAt"`
+	StartedByMID *int       `gorm:"column:started_by_m_id" json:"StartedByMID"`
+	EndedAt      *time.Time `gorm:"index" json:"EndedAt"`
+	EndedByMID   *int       `gorm:"column:ended_by_m_id" json:"EndedByMID"`
+	EndReason    string     `gorm:"type:varchar(255)" json:"EndReason"`
+
+	// ผลกระทบ ณ ตอนเริ่มปิดควบคุม
+	AffectedPrisoners    int `json:"AffectedPrisoners"`
+	CancelledVisits      int `json:"CancelledVisits"`
+	SuspendedEnrollments int `json:"SuspendedEnrollments"`
+
+	StartedBy *Member `gorm:"foreignKey:StartedByMID;references:MID" json:"StartedBy,omitempty"`
+	EndedBy   *Member `gorm:"foreignKey:EndedByMID;references:MID" json:"EndedBy,omitempty"`
+}
@@ -0,0 +1,29 @@
+package entity
+
+import "time"
+
+// ผลของการพยายาม login (LoginAttempt.Result)
+const (
+	LoginSuccess     = "success"
+	LoginBadPassword = "bad_password"
+	LoginUnknownUser = "unknown_user"
+	LoginLocked      = "locked"      // บัญชีถูกล็อกอยู่ ไม่ได้ตรวจรหัสผ่าน
+	LoginThrottled   = "throttled"   // เรียกถี่เกินไป ต้องรอก่อนลองใหม่
+	LoginIPBlocked   = "ip_blocked"  // IP นี้ผิดเกินจำนวนที่กำหนด
+	LoginUnlocked    = "unlocked"    // แอดมินปลดล็อกบัญชี (เริ่มนับครั้งที่ผิดใหม่)
+	LoginMFAPending  = "mfa_pending" // รหัสผ่านถูก รอรหัส TOTP
+	LoginBadTOTP     = "bad_totp"    // รหัส TOTP/recovery code ผิด (นับรวมกับรหัสผ่านผิด)
+)
+
+// LoginAttempt ประวัติการ login ทุกครั้ง ใช้ทั้งแสดงประวัติและนับครั้งที่ผิดเพื่อหน่วงเวลา/ล็อกบัญชี
+type LoginAttempt struct {
+	ID        uint   `gorm:"primaryKey" json:"ID"`
+	MID       *int   `gorm:"column:m_id;index" json:"MID"` // nil = ไม่พบ username นี้
+	Username  string `gorm:"type:varchar(100);index" json:"Username"`
+	IP        string `gorm:"type:varchar(64);index" json:"IP"`
+	UserAgent string `gorm:"type:varchar(255)" json:"UserAgent"`
+	Success   bool   `json:"Success"`
+	Result    string `gorm:"type:varchar(20);not null" json:"Result"`
+
+	CreatedAt time.Time `gorm:"index" json:"CreatedAt"`
+}
@@ -13,6 +13,7 @@ type Medical_History struct {
 	Diagnosis        string     // การวินิจฉัย
 	Date_Inspection  time.Time  // วันที่ตรวจ
 	Next_appointment *time.Time `json:"Next_appointment"` // นัดครั้งต่อไป
+	Isolation        bool       // ต้องแยกกักตัว (งดเยี่ยมตามกฎการเยี่ยม)
 
 	// StaffID ทำหน้าที่เป็น FK
 	StaffID *uint
@@ -11,11 +11,23 @@ type Member struct {
 	FirstName string    `gorm:"column:first_name;not null" json:"FirstName"`
 	LastName  string    `gorm:"column:last_name;not null" json:"LastName"`
 	Birthday  time.Time `gorm:"column:birthday;not null" json:"Birthday"`
+	// ภาษาของอีเมลที่ระบบส่งถึงสมาชิก: "th" หรือ "en"
+	Language  string    `gorm:"column:language;type:varchar(2);default:th" json:"Language"`
 
 
 	// CitizenID เป็นสิ่งจำเป็นสำหรับเชื่อมข้อมูล "ผู้ใช้งาน" กับ "ผู้เยี่ยมชม"
 	CitizenID string    `gorm:"column:citizen_id;unique;not null" json:"citizenId"`
 
+	// login ผิดติดกันเกินกำหนด -> ล็อกบัญชีถึงเวลานี้ (แอดมินปลดล็อกก่อนได้)
+	LockedUntil *time.Time `gorm:"column:locked_until" json:"LockedUntil"`
+
+	// TOTP (RFC 6238) secret แบบ base32; PendingSecret คือ secret ที่กำลังลงทะเบียนแต่ยังไม่ยืนยันรหัส
+	TOTPEnabled       bool   `gorm:"column:totp_enabled" json:"TOTPEnabled"`
+	TOTPSecret        string `gorm:"column:totp_secret" json:"-"`
+	TOTPPendingSecret string `gorm:"column:totp_pending_secret" json:"-"`
+	// time step ล่าสุดที่ใช้ไปแล้ว กันการนำรหัสเดิมมาใช้ซ้ำ
+	TOTPLastStep int64 `gorm:"column:totp_last_step" json:"-"`
+
 	// ให้ชี้ FK/PK ให้ตรงคอลัมน์จริงของ Rank (ปรับตาม struct Rank ของคุณ)
 	Rank Rank `gorm:"foreignKey:RankID;references:RankID" json:"Rank"`
 
@@ -0,0 +1,30 @@
+package entity
+
+import "time"
+
+// จุดประสงค์ของ LoginChallenge
+const (
+	MFAVerify = "totp"  // สมาชิกเปิด TOTP แล้ว ต้องกรอกรหัส 6 หลักหรือ recovery code
+	MFASetup  = "setup" // rank บังคับ TOTP แต่ยังไม่ได้ลงทะเบียน ต้องลงทะเบียนก่อนได้ token
+)
+
+// LoginChallenge token ชั่วคราวที่ได้หลังรหัสผ่านถูก ใช้แลก access token ในขั้นที่สอง (เก็บเฉพาะ hash)
+type LoginChallenge struct {
+	ID        uint       `gorm:"primaryKey" json:"ID"`
+	MID       int        `gorm:"column:m_id;not null;index" json:"MID"`
+	TokenHash string     `gorm:"unique;not null" json:"-"`
+	Purpose   string     `gorm:"type:varchar(10);not null" json:"Purpose"`
+	Attempts  int        `gorm:"not null;default:0" json:"Attempts"`
+	ExpiresAt time.Time  `gorm:"not null" json:"ExpiresAt"`
+	UsedAt    *time.Time `json:"UsedAt"`
+	CreatedAt time.Time  `json:"CreatedAt"`
+}
+
+// RecoveryCode รหัสสำรองใช้แทน TOTP เมื่อไม่มีเครื่องยืนยันตัวตน (ใช้ได้ครั้งเดียว, เก็บเฉพาะ hash)
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"ID"`
+	MID       int        `gorm:"column:m_id;not null;index" json:"MID"`
+	CodeHash  string     `gorm:"not null;index" json:"-"`
+	UsedAt    *time.Time `json:"UsedAt"`
+	CreatedAt time.Time  `json:"CreatedAt"`
+}
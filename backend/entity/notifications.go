@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// Notification การแจ้งเตือนในระบบของสมาชิกแต่ละคน (ReadAt = nil คือยังไม่อ่าน)
+type Notification struct {
+	ID      uint   `gorm:"primaryKey" json:"ID"`
+	MID     int    `gorm:"column:m_id;not null;index" json:"MID"`
+	Type    string `gorm:"type:varchar(40);not null;index" json:"Type"`
+	Title   string `gorm:"type:varchar(255);not null" json:"Title"`
+	Message string `gorm:"type:text" json:"Message"`
+
+	// รายการที่เกี่ยวข้อง ให้ frontend ลิงก์ไปหน้ารายละเอียด เช่น RefType = "visitation", RefID = 12
+	RefType string `gorm:"type:varchar(40)" json:"RefType"`
+	RefID   uint   `json:"RefID"`
+
+	ReadAt    *time.Time `gorm:"index" json:"ReadAt"`
+	CreatedAt time.Time  `json:"CreatedAt"`
+}
@@ -0,0 +1,28 @@
+package entity
+
+import "time"
+
+// ParcelLot ล็อตที่รับเข้าของพัสดุแต่ละรายการ Parcel.Quantity = ผลรวม Remaining ของทุกล็อต
+type ParcelLot struct {
+	ID         uint       `gorm:"primaryKey" json:"ID"`
+	PID        int        `gorm:"not null;index" json:"PID"`
+	LotNo      string     `gorm:"type:varchar(100)" json:"LotNo"`
+	Quantity   int        `gorm:"not null" json:"Quantity"`  // จำนวนที่รับเข้า
+	Remaining  int        `gorm:"not null" json:"Remaining"` // คงเหลือในล็อตนี้
+	ExpiryDate *time.Time `gorm:"index" json:"ExpiryDate"`   // nil = ไม่มีวันหมดอายุ
+	Supplier   string     `gorm:"type:varchar(255)" json:"Supplier"`
+	ReceivedAt time.Time  `gorm:"not null" json:"ReceivedAt"`
+	CreatedAt  time.Time  `json:"CreatedAt"`
+
+	Parcel Parcel `gorm:"foreignKey:PID;references:PID" json:"Parcel"`
+}
+
+// ParcelLotMovement สมุดบัญชีการเคลื่อนไหวรายล็อต (+ รับเข้า, - จ่ายออก) ผูกกับ Operation ที่ทำให้เกิด
+type ParcelLotMovement struct {
+	ID        uint      `gorm:"primaryKey" json:"ID"`
+	LotID     uint      `gorm:"not null;index" json:"LotID"`
+	PID       int       `gorm:"not null;index" json:"PID"`
+	OPID      int       `gorm:"column:op_id;index" json:"OPID"`
+	Change    int       `gorm:"not null" json:"Change"`
+	CreatedAt time.Time `json:"CreatedAt"`
+}
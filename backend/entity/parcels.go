@@ -5,6 +5,17 @@ type Parcel struct {
 	ParcelName string `gorm:"unique;not null" json:"ParcelName"`
 	Quantity   int    `gorm:"not null" json:"Quantity"`
 	Type_ID    uint   `gorm:"not null" json:"Type_ID"`
-	Type       Type   `gorm:"foreignKey:Type_ID" json:"Type"`
+	Type       Type   `gorm:"foreignKey:Type_ID;references:Type_ID" json:"Type"`
 	Status     string `gorm:"not null" json:"Status"`
+	// คงเหลือเฉพาะล็อตที่ยังไม่หมดอายุ ใช้คิดสถานะ แจ้งเตือนใกล้หมด และแนะนำการสั่งซื้อ
+	// (Quantity รวมล็อตหมดอายุที่ยังไม่ได้ตัดจำหน่ายด้วย) อัปเดตทุกครั้งที่สต็อกเปลี่ยนและโดย job ทุกชั่วโมง
+	Available int `gorm:"not null;default:0" json:"Available"`
+	// จำนวนที่จองไว้ให้คำขอเบิกที่อนุมัติแล้วแต่ยังไม่จ่าย (เบิกได้จริง = Available - Reserved)
+	Reserved int `gorm:"not null;default:0" json:"Reserved"`
+
+	// ระดับสต็อกรายรายการ: ต่ำกว่าหรือเท่ากับ ReorderPoint = "ใกล้หมด" ควรสั่งเพิ่มให้ถึง MaxLevel (0 = ไม่กำหนด)
+	Unit         string `gorm:"type:varchar(50);not null;default:'ชิ้น'" json:"Unit"`
+	MinLevel     int    `gorm:"not null;default:0" json:"MinLevel"`
+	ReorderPoint int    `gorm:"not null;default:20" json:"ReorderPoint"`
+	MaxLevel     int    `gorm:"not null;default:0" json:"MaxLevel"`
 }
@@ -0,0 +1,13 @@
+package entity
+
+import "time"
+
+// PasswordResetToken token สำหรับรีเซ็ตรหัสผ่านที่ส่งทางอีเมล (เก็บเฉพาะ hash, ใช้ได้ครั้งเดียว)
+type PasswordResetToken struct {
+	ID        uint       `gorm:"primaryKey" json:"ID"`
+	MID       int        `gorm:"column:m_id;not null;index" json:"MID"`
+	TokenHash string     `gorm:"unique;not null" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"ExpiresAt"`
+	UsedAt    *time.Time `json:"UsedAt"`
+	CreatedAt time.Time  `json:"CreatedAt"`
+}
@@ -0,0 +1,66 @@
+package entity
+
+import "time"
+
+// สถานะใบสั่งซื้อ (PurchaseOrder.Status)
+const (
+	PODraft             = "draft"              // ร่าง แก้ไขรายการได้
+	POOrdered           = "ordered"            // ส่งสั่งซื้อแล้ว รอรับของ
+	POPartiallyReceived = "partially_received" // รับแล้วบางส่วน
+	POReceived          = "received"           // รับครบทุกรายการ
+	POClosed            = "closed"             // ปิดโดยรับไม่ครบ (ส่วนที่ขาดไม่รอรับแล้ว)
+	POCancelled         = "cancelled"          // ยกเลิกก่อนรับของ
+)
+
+// PurchaseOrder ใบสั่งซื้อพัสดุ ทุกการรับของเข้าผ่าน GoodsReceipt ต้องอ้างอิงใบสั่งซื้อ
+type PurchaseOrder struct {
+	ID           uint       `gorm:"primaryKey" json:"ID"`
+	PONo         string     `gorm:"column:po_no;unique;not null" json:"PONo"`
+	SupplierID   uint       `gorm:"not null;index" json:"SupplierID"`
+	Supplier     Supplier   `gorm:"foreignKey:SupplierID" json:"Supplier"`
+	OrderDate    time.Time  `gorm:"type:date;not null" json:"OrderDate"`
+	ExpectedDate *time.Time `gorm:"type:date" json:"ExpectedDate"`
+	Status       string     `gorm:"type:varchar(20);not null;index" json:"Status"`
+	Note         string     `gorm:"type:text" json:"Note"`
+	CreatedByMID *int       `gorm:"column:created_by_m_id" json:"CreatedByMID"`
+	CreatedAt    time.Time  `json:"CreatedAt"`
+	UpdatedAt    time.Time  `json:"UpdatedAt"`
+
+	Lines    []PurchaseOrderLine `gorm:"foreignKey:PurchaseOrderID" json:"Lines"`
+	Receipts []GoodsReceipt      `gorm:"foreignKey:PurchaseOrderID" json:"Receipts"`
+}
+
+// PurchaseOrderLine รายการในใบสั่งซื้อ QuantityReceived อาจมากกว่า QuantityOrdered เมื่อยอมรับของเกิน
+type PurchaseOrderLine struct {
+	ID               uint    `gorm:"primaryKey" json:"ID"`
+	PurchaseOrderID  uint    `gorm:"not null;index" json:"PurchaseOrderID"`
+	PID              int     `gorm:"not null" json:"PID"`
+	Parcel           Parcel  `gorm:"foreignKey:PID;references:PID" json:"Parcel"`
+	QuantityOrdered  int     `gorm:"not null" json:"QuantityOrdered"`
+	QuantityReceived int     `gorm:"not null;default:0" json:"QuantityReceived"`
+	UnitPrice        float64 `gorm:"not null;default:0" json:"UnitPrice"`
+}
+
+// GoodsReceipt การรับของหนึ่งครั้งตามใบสั่งซื้อ (ส่งของได้หลายรอบ)
+type GoodsReceipt struct {
+	ID              uint      `gorm:"primaryKey" json:"ID"`
+	PurchaseOrderID uint      `gorm:"not null;index" json:"PurchaseOrderID"`
+	DeliveryNoteNo  string    `gorm:"type:varchar(100)" json:"DeliveryNoteNo"` // เลขที่ใบส่งของจากผู้ขาย
+	ReceivedAt      time.Time `gorm:"not null" json:"ReceivedAt"`
+	ReceivedByMID   int       `gorm:"column:received_by_m_id;not null" json:"ReceivedByMID"`
+	Note            string    `gorm:"type:text" json:"Note"`
+	CreatedAt       time.Time `json:"CreatedAt"`
+
+	Lines []GoodsReceiptLine `gorm:"foreignKey:GoodsReceiptID" json:"Lines"`
+}
+
+// GoodsReceiptLine ของที่รับในแต่ละรายการ ผูกกับล็อตที่สร้างและ Operation ที่บันทึกสต็อก
+type GoodsReceiptLine struct {
+	ID                  uint `gorm:"primaryKey" json:"ID"`
+	GoodsReceiptID      uint `gorm:"not null;index" json:"GoodsReceiptID"`
+	PurchaseOrderLineID uint `gorm:"not null;index" json:"PurchaseOrderLineID"`
+	PID                 int  `gorm:"not null" json:"PID"`
+	Quantity            int  `gorm:"not null" json:"Quantity"`
+	LotID               uint `gorm:"not null" json:"LotID"`
+	OPID                int  `gorm:"column:op_id;not null" json:"OPID"`
+}
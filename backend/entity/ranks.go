@@ -3,5 +3,7 @@ package entity
 type Rank struct {
 	RankID   int    `gorm:"column:rank_id;primaryKey" json:"RankID"`
 	RankName string `gorm:"unique;not null" json:"RankName"`
+	// สมาชิกใน rank นี้ต้องลงทะเบียนและใช้ TOTP ทุกครั้งที่ login
+	RequireTOTP bool `gorm:"column:require_totp" json:"RequireTOTP"`
 	Member []Member `gorm:"foreignKey:RankID"`
 }
@@ -0,0 +1,26 @@
+package entity
+
+import "time"
+
+// RefreshToken เก็บ refresh token (เฉพาะ hash) ของแต่ละ session
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"ID"`
+	MID       int        `gorm:"column:m_id;not null;index" json:"MID"`
+	TokenHash string     `gorm:"unique;not null" json:"-"`
+	AccessJTI string     `gorm:"index" json:"-"` // jti ของ access token ที่ออกคู่กันล่าสุด
+	ExpiresAt time.Time  `gorm:"not null" json:"ExpiresAt"`
+	RevokedAt *time.Time `json:"RevokedAt"`
+	// token ใหม่ที่มาแทนตอน rotate (ใช้ตรวจการนำ token เก่ามาใช้ซ้ำ)
+	ReplacedByID *uint     `json:"ReplacedByID"`
+	CreatedAt    time.Time `json:"CreatedAt"`
+
+	Member Member `gorm:"foreignKey:MID;references:MID" json:"-"`
+}
+
+// RevokedToken คือ access token (อ้างด้วย jti) ที่ถูกเพิกถอนก่อนหมดอายุ
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey" json:"JTI"`
+	MID       int       `gorm:"column:m_id;not null" json:"MID"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"ExpiresAt"`
+	RevokedAt time.Time `gorm:"not null" json:"RevokedAt"`
+}
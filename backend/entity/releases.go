@@ -0,0 +1,34 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ประเภทการปล่อยตัว
+const (
+	ReleaseSentenceServed = "sentence_served" // พ้นโทษ
+	ReleaseParole         = "parole"          // พักการลงโทษ
+	ReleaseTransferOut    = "transfer_out"    // ย้ายไปเรือนจำอื่น
+	ReleaseCourtOrder     = "court_order"     // ศาลสั่งปล่อย
+)
+
+// Release การปล่อยตัวผู้ต้องขัง (หนึ่งคนปล่อยได้ครั้งเดียว) พร้อมเอกสารสรุปที่ออกให้
+type Release struct {
+	Release_ID  uint      `gorm:"primaryKey" json:"Release_ID"`
+	Prisoner_ID uint      `gorm:"not null;uniqueIndex" json:"Prisoner_ID"`
+	ReleaseType string    `gorm:"type:varchar(20);not null;index" json:"ReleaseType"`
+	ReleaseDate time.Time `gorm:"not null" json:"ReleaseDate"`
+	Reference   string    `gorm:"type:varchar(100)" json:"Reference"` // เลขที่คำสั่งศาล/หนังสือย้าย ฯลฯ
+	Remarks     string    `gorm:"type:text" json:"Remarks"`
+
+	// เลขที่เอกสารสรุปการปล่อยตัว เช่น RL-2569/0001 และเนื้อหา (JSON) ณ เวลาที่ออก
+	DocumentNo string          `gorm:"type:varchar(20);uniqueIndex" json:"DocumentNo"`
+	Summary    json.RawMessage `gorm:"type:text" json:"Summary"`
+
+	ProcessedByMID *int      `gorm:"column:processed_by_m_id" json:"ProcessedByMID"`
+	CreatedAt      time.Time `json:"CreatedAt"`
+
+	Prisoner    *Prisoner `gorm:"foreignKey:Prisoner_ID;references:Prisoner_ID" json:"Prisoner,omitempty"`
+	ProcessedBy *Member   `gorm:"foreignKey:ProcessedByMID;references:MID" json:"ProcessedBy,omitempty"`
+}
@@ -8,9 +8,10 @@ type Requesting struct {
 	Requesting_ID uint   `gorm:"primaryKey"`
 	Requesting_NO string `gorm:"unique;not null"`
 
+	// PID/Amount_Request คือรายการแรกของ Lines (คงไว้ให้หน้าจอเดิมที่แสดงคำขอละ 1 รายการ)
 	PID *uint `gorm:"not null"`
-	// แก้ไข: เอา references ออก ให้ GORM จัดการเชื่อมกับ Primary Key ของ Item เอง
-	Parcel Parcel `gorm:"foreignKey:PID"`
+	// ต้องระบุ references: ชื่อ PID ซ้ำกับ primary key ของ Parcel ทำให้ GORM เดาเป็น has-one (Parcel.PID = Requesting_ID)
+	Parcel Parcel `gorm:"foreignKey:PID;references:PID"`
 
 	Amount_Request uint      `gorm:"not null"`
 	Request_Date   time.Time `gorm:"type:date;not null"`
@@ -20,6 +21,24 @@ type Requesting struct {
 	Staff *Staff `gorm:"foreignKey:StaffID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 
 	Status_ID *uint `gorm:"not null"`
-	// แก้ไข: เอา references ออก ให้ GORM จัดการเชื่อมกับ Primary Key ของ Status เอง
-	Status Status `gorm:"foreignKey:Status_ID"`
+	// ระบุ references ด้วยเหตุผลเดียวกับ Parcel (Status_ID เป็น primary key ของ Status)
+	Status Status `gorm:"foreignKey:Status_ID;references:Status_ID"`
+
+	// สมาชิกที่ยื่นคำขอเบิก (รับการแจ้งเตือนเมื่อสถานะเปลี่ยน)
+	RequestedByMID *int `gorm:"column:requested_by_m_id"`
+
+	Lines []RequestingLine `gorm:"foreignKey:Requesting_ID"`
+}
+
+// RequestingLine รายการพัสดุในใบเบิก อนุมัติได้บางส่วนรายบรรทัด
+type RequestingLine struct {
+	Line_ID       uint `gorm:"primaryKey"`
+	Requesting_ID uint `gorm:"not null;index"`
+
+	PID    uint   `gorm:"not null"`
+	Parcel Parcel `gorm:"foreignKey:PID;references:PID"`
+
+	Quantity_Requested uint `gorm:"not null"`
+	Quantity_Approved  uint `gorm:"not null;default:0"` // จองสต็อกไว้ตั้งแต่อนุมัติจนจ่ายหรือยกเลิก
+	Quantity_Issued    uint `gorm:"not null;default:0"`
 }
@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// RoomAssignment ประวัติการอยู่ห้องขังของผู้ต้องขัง (ToDate = nil คือห้องปัจจุบัน)
+type RoomAssignment struct {
+	Assignment_ID uint       `gorm:"primaryKey" json:"Assignment_ID"`
+	Prisoner_ID   uint       `gorm:"not null;index" json:"Prisoner_ID"`
+	Room_ID       uint       `gorm:"not null;index" json:"Room_ID"`
+	FromDate      time.Time  `gorm:"not null" json:"FromDate"`
+	ToDate        *time.Time `json:"ToDate"`
+	Reason        string     `gorm:"type:text" json:"Reason"`
+
+	// ผู้อนุมัติการย้าย (nil = ระบบ)
+	ApprovedByMID *int `gorm:"column:approved_by_m_id" json:"ApprovedByMID"`
+
+	Prisoner   *Prisoner `gorm:"foreignKey:Prisoner_ID;references:Prisoner_ID" json:"Prisoner,omitempty"`
+	Room       *Room     `gorm:"foreignKey:Room_ID;references:Room_ID" json:"Room,omitempty"`
+	ApprovedBy *Member   `gorm:"foreignKey:ApprovedByMID;references:MID" json:"ApprovedBy,omitempty"`
+}
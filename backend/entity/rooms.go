@@ -5,6 +5,17 @@ type Room struct {
 	Room_Name      string `json:"Room_Name"`
 	Room_Status string `json:"Room_Status"`
 
+	// ความจุ (คน) ใช้คำนวณ Room_Status และตรวจห้องเต็ม
+	Capacity int `gorm:"not null;default:2" json:"Capacity"`
+	// เพศของห้อง (อ้างอิง genders.gender_id); Is_Mixed = true คือรับได้ทุกเพศ (เช่น ห้องพยาบาล)
+	// ไม่ประกาศ association Gender ไว้ เพราะ GORM จะเดาเป็น has-one จากชื่อ Gender_ID ที่ซ้ำกัน
+	Gender_ID *uint `json:"Gender_ID"`
+	Is_Mixed  bool  `gorm:"not null;default:false" json:"Is_Mixed"`
+
+	Security_Level string `json:"Security_Level"` // เช่น ทั่วไป / สูง / สูงสุด
+	Building       string `json:"Building"`
+	Wing           string `json:"Wing"`
+
 	// 1 RoomID มี Medical ได้หลาย
 	Prisoner []Prisoner `gorm:"foreignKey:Room_ID"`
 }
@@ -1,11 +1,17 @@
 package entity
 
+import "time"
+
 // entity/score_behavior.go
 type ScoreBehavior struct {
 	SID         uint `gorm:"column:s_id;primaryKey;autoIncrement" json:"SID"`
 	Prisoner_ID uint `gorm:"column:prisoner_id;not null;unique" json:"Prisoner_ID"`
 	Score       int  `gorm:"column:score;not null" json:"Score"`
 
+	// Frozen = ผู้ต้องขังถูกปล่อยตัวแล้ว ห้ามแก้คะแนน/ประเมินเพิ่ม
+	Frozen   bool       `gorm:"column:frozen;not null;default:false" json:"Frozen"`
+	FrozenAt *time.Time `gorm:"column:frozen_at" json:"FrozenAt"`
+
 	BehaviorEvaluation []BehaviorEvaluation `gorm:"foreignKey:SID" json:"evaluations"`
 	Prisoner           *Prisoner            `gorm:"foreignKey:Prisoner_ID;references:Prisoner_ID" json:"prisoner"`
 }
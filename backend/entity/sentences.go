@@ -0,0 +1,50 @@
+package entity
+
+import "time"
+
+// SentenceCharge ข้อหาและโทษที่ศาลพิพากษา (ผู้ต้องขังหนึ่งคนมีได้หลายข้อหา/หลายคดี)
+type SentenceCharge struct {
+	Charge_ID   uint   `gorm:"primaryKey" json:"Charge_ID"`
+	Prisoner_ID uint   `gorm:"not null;index" json:"Prisoner_ID"`
+	Case_ID     string `gorm:"type:varchar(50)" json:"Case_ID"` // ไม่ระบุ = ใช้ Case_ID ของผู้ต้องขัง
+	Offense     string `gorm:"type:varchar(255);not null" json:"Offense"`
+
+	// ระยะเวลาโทษ
+	TermYears  int `json:"TermYears"`
+	TermMonths int `json:"TermMonths"`
+	TermDays   int `json:"TermDays"`
+
+	// Consecutive = ต่อโทษ (เริ่มนับหลังโทษก่อนหน้าจบ), false = นับโทษพร้อมกัน
+	Consecutive bool `json:"Consecutive"`
+	// จำนวนวันที่ถูกคุมขังมาก่อน (เช่น ระหว่างพิจารณาคดี) ให้หักออกจากโทษ
+	CreditDays int `json:"CreditDays"`
+	// ลำดับการนับโทษ
+	Seq int `json:"Seq"`
+
+	CreatedAt time.Time `json:"CreatedAt"`
+	UpdatedAt time.Time `json:"UpdatedAt"`
+}
+
+// RemissionPolicy นโยบายลดวันต้องโทษจากความประพฤติ (ใช้แถวเดียว ID = 1)
+type RemissionPolicy struct {
+	ID      uint `gorm:"primaryKey" json:"ID"`
+	Enabled bool `json:"Enabled"`
+	// ต้องมีคะแนนความประพฤติอย่างน้อยเท่านี้จึงได้ลดวันต้องโทษ
+	MinScore int `json:"MinScore"`
+	// ทุก ๆ ScorePointsPerDay คะแนน = ลด 1 วัน (0 = ไม่คิดจากคะแนน)
+	ScorePointsPerDay int `json:"ScorePointsPerDay"`
+	// ลดได้ไม่เกินกี่เปอร์เซ็นต์ของโทษรวม
+	MaxPercent int       `json:"MaxPercent"`
+	UpdatedAt  time.Time `json:"UpdatedAt"`
+
+	Rates []RemissionRate `gorm:"foreignKey:PolicyID" json:"Rates"`
+}
+
+// RemissionRate จำนวนวันที่ลดต่อการประเมินพฤติกรรมหนึ่งครั้ง ตามเกณฑ์ (BID)
+type RemissionRate struct {
+	PolicyID          uint `gorm:"primaryKey" json:"PolicyID"`
+	BID               uint `gorm:"primaryKey" json:"BID"`
+	DaysPerEvaluation int  `json:"DaysPerEvaluation"`
+
+	BehaviorCriterion *BehaviorCriterion `gorm:"foreignKey:BID;references:BID" json:"BehaviorCriterion,omitempty"`
+}
@@ -0,0 +1,17 @@
+package entity
+
+import "time"
+
+// Supplier ผู้ขาย/ผู้จัดส่งพัสดุ (อ้างอิงในใบสั่งซื้อ)
+type Supplier struct {
+	ID          uint      `gorm:"primaryKey" json:"ID"`
+	Name        string    `gorm:"type:varchar(255);unique;not null" json:"Name"`
+	ContactName string    `gorm:"type:varchar(255)" json:"ContactName"`
+	Phone       string    `gorm:"type:varchar(50)" json:"Phone"`
+	Email       string    `gorm:"type:varchar(255)" json:"Email"`
+	Address     string    `gorm:"type:text" json:"Address"`
+	TaxID       string    `gorm:"type:varchar(20)" json:"TaxID"`
+	IsActive    bool      `gorm:"not null;default:true" json:"IsActive"` // เลิกใช้แล้วสร้างใบสั่งซื้อใหม่ไม่ได้
+	CreatedAt   time.Time `json:"CreatedAt"`
+	UpdatedAt   time.Time `json:"UpdatedAt"`
+}
@@ -0,0 +1,50 @@
+package entity
+
+import "time"
+
+// VisitationRuleSet กฎการเยี่ยมที่ตรวจตอนจองเยี่ยม (ใช้แถวเดียว ID = 1, ค่า 0 = ไม่จำกัด/ไม่ใช้กฎนั้น)
+type VisitationRuleSet struct {
+	ID      uint `gorm:"primaryKey" json:"ID"`
+	Enabled bool `json:"Enabled"`
+
+	// จำนวนครั้งที่ผู้ต้องขังรับเยี่ยมได้ต่อสัปดาห์ (จันทร์ - อาทิตย์)
+	MaxVisitsPerWeek int `json:"MaxVisitsPerWeek"`
+	// จำนวนผู้มาเยี่ยมสูงสุดต่อการเยี่ยมหนึ่งครั้ง
+	MaxVisitorsPerVisit int `json:"MaxVisitorsPerVisit"`
+	// คะแนนความประพฤติต่ำกว่านี้ = งดเยี่ยม
+	MinScore int `json:"MinScore"`
+	// งดเยี่ยมกี่วันนับจากวันที่ตรวจที่แพทย์สั่งแยกกักตัว
+	IsolationDays int `json:"IsolationDays"`
+
+	// ผู้เยี่ยมไม่มาตามนัดครบ NoShowLimit ครั้งภายใน NoShowWindowDays วัน = ระงับการจอง NoShowRestrictDays วัน
+	NoShowLimit        int `gorm:"default:3" json:"NoShowLimit"`
+	NoShowWindowDays   int `gorm:"default:90" json:"NoShowWindowDays"`
+	NoShowRestrictDays int `gorm:"default:30" json:"NoShowRestrictDays"`
+
+	UpdatedAt time.Time `json:"UpdatedAt"`
+}
+
+// VisitBlackout ช่วงวันที่งดเยี่ยมทั้งเรือนจำ (วันหยุด, ปิดเรือนจำ ฯลฯ)
+type VisitBlackout struct {
+	ID        uint      `gorm:"primaryKey" json:"ID"`
+	StartDate time.Time `gorm:"not null;index" json:"StartDate"`
+	EndDate   time.Time `gorm:"not null;index" json:"EndDate"`
+	Reason    string    `gorm:"type:varchar(255);not null" json:"Reason"`
+
+	CreatedByMID *int      `gorm:"column:created_by_m_id" json:"CreatedByMID"`
+	CreatedAt    time.Time `json:"CreatedAt"`
+}
+
+// VisitSuspension การงดเยี่ยมรายบุคคลที่เจ้าหน้าที่สั่ง (EndDate = nil คือจนกว่าจะยกเลิก)
+type VisitSuspension struct {
+	ID          uint       `gorm:"primaryKey" json:"ID"`
+	Prisoner_ID uint       `gorm:"not null;index" json:"Prisoner_ID"`
+	StartDate   time.Time  `gorm:"not null" json:"StartDate"`
+	EndDate     *time.Time `json:"EndDate"`
+	Reason      string     `gorm:"type:varchar(255);not null" json:"Reason"`
+
+	CreatedByMID *int      `gorm:"column:created_by_m_id" json:"CreatedByMID"`
+	CreatedAt    time.Time `json:"CreatedAt"`
+
+	Prisoner *Prisoner `gorm:"foreignKey:Prisoner_ID;references:Prisoner_ID" json:"Prisoner,omitempty"`
+}
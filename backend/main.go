@@ -15,113 +15,261 @@ func main() {
 
 	// This function ensures that every prisoner has a score behavior record.
 	backfillScoreBehaviors()
+	// Prisoners created before room history existed get an open assignment for their current room.
+	backfillRoomAssignments()
+	// Rooms created before rooms had a gender designation keep the old M/F name-prefix rule.
+	backfillRoomGenders()
+	// Visitations booked before visiting areas existed are placed in the first area.
+	backfillVisitingAreas()
 
-	r := gin.Default()
+	// Time-driven jobs (room status, expired visitations, appointment reminders).
+	controller.StartScheduler()
+
+	// ใช้ logger ของเราแทน gin.Default() เพื่อไม่ให้ JWT ใน ?access_token= ของคำขอ SSE หลุดลง log
+	r := gin.New()
+	r.Use(middleware.Logger(), gin.Recovery())
+	// ไม่เชื่อ X-Forwarded-For จากใครเลย: c.ClientIP() ใช้กับการบล็อก IP ตอน login จึงต้องปลอมไม่ได้
+	if err := r.SetTrustedProxies(nil); err != nil {
+		panic(err)
+	}
 	r.Use(CORSMiddleware())
 	r.Use(middleware.AuthOptional())
 
 	api := r.Group("/api")
 	api.POST("/auth/register", controller.Register)
 	api.POST("/auth/login", controller.Login)
+	api.POST("/auth/refresh", controller.Refresh)
+	api.POST("/auth/logout", middleware.AuthRequired(), controller.Logout)
+	api.POST("/auth/change-password", middleware.AuthRequired(), controller.ChangePassword)
+	api.POST("/auth/forgot-password", controller.ForgotPassword)
+	api.POST("/auth/reset-password", controller.ResetPassword)
+	api.POST("/auth/login/totp-setup", controller.LoginTOTPSetup)
+	api.POST("/auth/login/verify", controller.LoginVerify)
 	api.GET("/me", middleware.AuthRequired(), controller.Me)
+	api.PATCH("/me", middleware.AuthRequired(), controller.UpdateMe)
+	api.GET("/me/totp", middleware.AuthRequired(), controller.GetMyTOTP)
+	api.POST("/me/totp/setup", middleware.AuthRequired(), controller.SetupMyTOTP)
+	api.POST("/me/totp/enable", middleware.AuthRequired(), controller.EnableMyTOTP)
+	api.POST("/me/totp/disable", middleware.AuthRequired(), controller.DisableMyTOTP)
+	api.POST("/me/totp/recovery-codes", middleware.AuthRequired(), controller.RegenerateMyRecoveryCodes)
+	// real-time: ทุก rank เปิดได้ event ถูกกรองตามสิทธิ์ read ใน controller
+	api.GET("/events", middleware.AuthRequired(), controller.StreamEvents)
 
+	// ทุก group ด้านล่างต้อง login และผ่าน policy ใน middleware/rbac.go
 	{
 		// --- Prisoner & Related Routes ---
-		api.GET("/prisoners", controller.GetPrisoners)
-		api.POST("/prisoners", controller.CreatePrisoner)
-		api.PUT("/prisoners/:id", controller.UpdatePrisoner)
-		api.DELETE("/prisoners/:id", controller.DeletePrisoner)
-		api.GET("/prisoners/:id", controller.GetPrisonerByID)
-		api.GET("/prisoners/next-inmate-id", controller.GetNextInmateID)
+		prisoners := api.Group("/prisoners", middleware.Authorize(middleware.ResPrisoners))
+		prisoners.GET("", controller.GetPrisoners)
+		prisoners.POST("", controller.CreatePrisoner)
+		prisoners.PUT("/:id", controller.UpdatePrisoner)
+		prisoners.DELETE("/:id", controller.DeletePrisoner)
+		prisoners.GET("/:id", controller.GetPrisonerByID)
+		prisoners.GET("/next-inmate-id", controller.GetNextInmateID)
+		prisoners.POST("/:id/transfer", controller.TransferPrisoner)
+		api.GET("/prisoners/:id/room-history", middleware.Authorize(middleware.ResRooms), controller.GetPrisonerRoomHistory)
+
+		// --- Release (เอกสารปล่อยตัวมีเลขบัตรประชาชน: เฉพาะเจ้าหน้าที่) ---
+		releases := api.Group("", middleware.Authorize(middleware.ResReleases))
+		releases.POST("/prisoners/:id/release", controller.ReleasePrisoner)
+		releases.GET("/prisoners/:id/release", controller.GetPrisonerRelease)
+		releases.GET("/releases/upcoming", controller.GetUpcomingReleases)
+
+		// --- Sentence Computation ---
+		sentences := api.Group("/prisoners", middleware.Authorize(middleware.ResSentences))
+		sentences.GET("/:id/sentence", controller.GetPrisonerSentence)
+		sentences.GET("/:id/charges", controller.GetPrisonerCharges)
+		sentences.POST("/:id/charges", controller.CreateCharge)
+		sentences.PUT("/:id/charges/:chargeId", controller.UpdateCharge)
+		sentences.DELETE("/:id/charges/:chargeId", controller.DeleteCharge)
+		api.GET("/sentence-policy", middleware.Authorize(middleware.ResSentencePolicy), controller.GetRemissionPolicy)
+		api.PUT("/sentence-policy", middleware.Authorize(middleware.ResSentencePolicy), controller.UpdateRemissionPolicy)
 
 		// --- Staff & Permissions Routes ---
-		api.GET("/staffs", controller.GetStaffs)
-		api.POST("/staffs", controller.CreateStaff)
-		api.PUT("/staffs/:id", controller.UpdateStaff)
-		api.DELETE("/staffs/:id", controller.DeleteStaff)
-		api.GET("/staffs/:id", controller.GetStaffByID)
-		api.GET("/ranks", controller.GetRanks)
+		staffs := api.Group("/staffs", middleware.Authorize(middleware.ResStaffs))
+		staffs.GET("", controller.GetStaffs)
+		staffs.POST("", controller.CreateStaff)
+		staffs.PUT("/:id", controller.UpdateStaff)
+		staffs.DELETE("/:id", controller.DeleteStaff)
+		staffs.GET("/:id", controller.GetStaffByID)
 
 		// --- Score & Adjustment Routes ---
-		api.GET("/scorebehaviors", controller.GetScoreBehaviors)
-		api.PUT("/scorebehaviors/:id", controller.UpdateScoreBehavior)
-		api.GET("/adjustments", controller.GetAdjustments)
-		api.POST("/adjustments", controller.CreateAdjustment)
+		scores := api.Group("", middleware.Authorize(middleware.ResScores))
+		scores.GET("/scorebehaviors", controller.GetScoreBehaviors)
+		scores.PUT("/scorebehaviors/:id", controller.UpdateScoreBehavior)
+		scores.GET("/adjustments", controller.GetAdjustments)
+		scores.POST("/adjustments", controller.CreateAdjustment)
+		scores.GET("/scorebehavior/prisoner/:id", controller.GetScoreByPrisoner)
 
 		// --- Medical & Inventory Routes ---
-		api.GET("/medical_histories", controller.GetMedicalHistories)
-		api.POST("/medical_histories", controller.CreateMedicalHistory)
-		api.PUT("/medical_histories/:id", controller.UpdateMedicalHistory)
-		api.DELETE("/medical_histories/:id", controller.DeleteMedicalHistory)
-		api.GET("/parcels", controller.GetParcels)
-		api.POST("/parcels", controller.CreateParcel)
-		api.PUT("/parcels/:id", controller.UpdateParcel)
-		api.POST("/parcels/:id/add", controller.AddParcel)
-		api.POST("/parcels/:id/reduce", controller.ReduceParcel)
-		api.GET("/operations", controller.GetOperations)
-	    api.DELETE("/parcels/:id", controller.DeleteParcel)
+		medical := api.Group("/medical_histories", middleware.Authorize(middleware.ResMedical))
+		medical.GET("", controller.GetMedicalHistories)
+		medical.POST("", controller.CreateMedicalHistory)
+		medical.PUT("/:id", controller.UpdateMedicalHistory)
+		medical.DELETE("/:id", controller.DeleteMedicalHistory)
+
+		parcels := api.Group("", middleware.Authorize(middleware.ResParcels))
+		parcels.GET("/parcels", controller.GetParcels)
+		parcels.GET("/parcels/expiring", controller.GetExpiringLots)
+		parcels.GET("/parcels/reorder-suggestions", controller.GetReorderSuggestions)
+		parcels.GET("/parcels/:id/lots", controller.GetParcelLots)
+		parcels.POST("/parcels", controller.CreateParcel)
+		parcels.PUT("/parcels/:id", controller.UpdateParcel)
+		parcels.POST("/parcels/:id/add", controller.AddParcel)
+		parcels.POST("/parcels/:id/reduce", controller.ReduceParcel)
+		parcels.DELETE("/parcels/:id", controller.DeleteParcel)
+		parcels.GET("/operations", controller.GetOperations)
+
+		suppliers := api.Group("/suppliers", middleware.Authorize(middleware.ResSuppliers))
+		suppliers.GET("", controller.GetSuppliers)
+		suppliers.POST("", controller.CreateSupplier)
+		suppliers.PUT("/:id", controller.UpdateSupplier)
+		suppliers.DELETE("/:id", controller.DeleteSupplier)
+
+		purchaseOrders := api.Group("/purchase-orders", middleware.Authorize(middleware.ResPurchaseOrders))
+		purchaseOrders.GET("", controller.GetPurchaseOrders)
+		purchaseOrders.GET("/:id", controller.GetPurchaseOrder)
+		purchaseOrders.POST("", controller.CreatePurchaseOrder)
+		purchaseOrders.PUT("/:id", controller.UpdatePurchaseOrder)
+		purchaseOrders.POST("/:id/submit", controller.SubmitPurchaseOrder)
+		purchaseOrders.POST("/:id/cancel", controller.CancelPurchaseOrder)
+		purchaseOrders.POST("/:id/close", controller.ClosePurchaseOrder)
+		api.POST("/purchase-orders/:id/receive", middleware.Authorize(middleware.ResGoodsReceipts), controller.ReceivePurchaseOrder)
 
 		// --- Room, Work & Requesting Routes ---
-		api.GET("/rooms", controller.GetRooms)
-		api.POST("/rooms", controller.CreateRoom)
-		api.PUT("/rooms/:id", controller.UpdateRoom)
-		api.DELETE("/rooms/:id", controller.DeleteRoom)
-		api.GET("/works", controller.GetWorks)
-		api.GET("/requestings", controller.GetRequestings)
-		api.POST("/requestings", controller.CreateRequesting)
-		api.PUT("/requestings/:id", controller.UpdateRequesting)
-		api.DELETE("/requestings/:id", controller.DeleteRequesting)
-		api.GET("/requestings/next-request-no", controller.GetNextRequestNo)
-		api.PUT("/requestings/:id/status", controller.UpdateRequestingStatus)
+		rooms := api.Group("/rooms", middleware.Authorize(middleware.ResRooms))
+		rooms.GET("", controller.GetRooms)
+		rooms.GET("/occupancy", controller.GetRoomOccupancy)
+		rooms.POST("", controller.CreateRoom)
+		rooms.PUT("/:id", controller.UpdateRoom)
+		rooms.DELETE("/:id", controller.DeleteRoom)
+		rooms.GET("/:id/occupants", controller.GetRoomOccupantsOnDate)
+
+		requestings := api.Group("/requestings", middleware.Authorize(middleware.ResRequestings))
+		requestings.GET("", controller.GetRequestings)
+		requestings.POST("", controller.CreateRequesting)
+		requestings.PUT("/:id", controller.UpdateRequesting)
+		requestings.DELETE("/:id", controller.DeleteRequesting)
+		requestings.GET("/next-request-no", controller.GetNextRequestNo)
+		requestings.GET("/:id", controller.GetRequesting)
+		requestings.PUT("/:id/status", controller.UpdateRequestingStatus)
 
 		// --- Visitation System ---
-		api.GET("/visitations", controller.GetVisitations)
-		api.POST("/visitations", controller.CreateVisitation)
-		api.PUT("/visitations/:id", controller.UpdateVisitation)
-		api.DELETE("/visitations/:id", controller.DeleteVisitation)
+		visitations := api.Group("/visitations", middleware.Authorize(middleware.ResVisitations))
+		visitations.GET("", controller.GetVisitations)
+		visitations.GET("/check", controller.CheckVisitationRules)
+		visitations.POST("", controller.CreateVisitation)
+		visitations.PUT("/:id", controller.UpdateVisitation)
+		visitations.DELETE("/:id", controller.DeleteVisitation)
+		api.POST("/visitations/:id/checkin", middleware.Authorize(middleware.ResVisitCheckIns), controller.CheckInVisitation)
+		api.POST("/visitations/:id/checkout", middleware.Authorize(middleware.ResVisitCheckIns), controller.CheckOutVisitation)
+
+		api.GET("/visitors", middleware.Authorize(middleware.ResVisitors), controller.GetVisitors)
+		api.DELETE("/visitors/:id/restriction", middleware.Authorize(middleware.ResVisitors), controller.LiftVisitorRestriction)
+
+		// --- Approved Visitor Lists ---
+		approvedVisitors := api.Group("/approved-visitors", middleware.Authorize(middleware.ResApprovedVisitors))
+		approvedVisitors.GET("", controller.GetApprovedVisitors)
+		approvedVisitors.POST("", controller.CreateApprovedVisitor)
+		approvedVisitors.PUT("/:id/approve", controller.ApproveVisitor)
+		approvedVisitors.PUT("/:id/reject", controller.RejectVisitor)
+		approvedVisitors.DELETE("/:id", controller.DeleteApprovedVisitor)
+
+		// --- Visiting Areas & Slot Capacity ---
+		visitingAreas := api.Group("/visiting-areas", middleware.Authorize(middleware.ResVisitingAreas))
+		visitingAreas.GET("", controller.GetVisitingAreas)
+		visitingAreas.POST("", controller.CreateVisitingArea)
+		visitingAreas.PUT("/:id", controller.UpdateVisitingArea)
+		visitingAreas.DELETE("/:id", controller.DeleteVisitingArea)
+		api.PUT("/timeslots/:id/capacity", middleware.Authorize(middleware.ResVisitingAreas), controller.SetTimeSlotCapacity)
+
+		emailOutbox := api.Group("/email-outbox", middleware.Authorize(middleware.ResEmailOutbox))
+		emailOutbox.GET("", controller.GetEmailOutbox)
+		emailOutbox.POST("/:id/retry", controller.RetryEmail)
+
+		notifications := api.Group("/notifications", middleware.Authorize(middleware.ResNotifications))
+		notifications.GET("", controller.GetNotifications)
+		notifications.GET("/unread-count", controller.GetUnreadNotificationCount)
+		notifications.PUT("/read-all", controller.MarkAllNotificationsRead)
+		notifications.PUT("/:id/read", controller.MarkNotificationRead)
+
+		lockdowns := api.Group("/lockdowns", middleware.Authorize(middleware.ResLockdowns))
+		lockdowns.GET("", controller.GetLockdowns)
+		lockdowns.POST("", controller.StartLockdown)
+		lockdowns.POST("/:id/end", controller.EndLockdown)
+
+		visitationRules := api.Group("/visitation-rules", middleware.Authorize(middleware.ResVisitationRules))
+		visitationRules.GET("", controller.GetVisitationRules)
+		visitationRules.PUT("", controller.UpdateVisitationRules)
+		visitationRules.GET("/blackouts", controller.GetVisitBlackouts)
+		visitationRules.POST("/blackouts", controller.CreateVisitBlackout)
+		visitationRules.DELETE("/blackouts/:id", controller.DeleteVisitBlackout)
+		visitationRules.GET("/suspensions", controller.GetVisitSuspensions)
+		visitationRules.POST("/suspensions", controller.CreateVisitSuspension)
+		visitationRules.DELETE("/suspensions/:id", controller.DeleteVisitSuspension)
+
+		applications := api.Group("/visitor-applications", middleware.Authorize(middleware.ResVisitorApplications))
+		applications.POST("", controller.ApplyApprovedVisitor)
+		applications.GET("/mine", controller.GetMyVisitorApplications)
 
 		// --- Petition System ---
-		api.GET("/petitions", controller.GetPetitions)
-		api.POST("/petitions", controller.CreatePetition)
-		api.PUT("/petitions/:id", controller.UpdatePetition)
-		api.DELETE("/petitions/:id", controller.DeletePetition)
+		petitions := api.Group("/petitions", middleware.Authorize(middleware.ResPetitions))
+		petitions.GET("", controller.GetPetitions)
+		petitions.POST("", controller.CreatePetition)
+		petitions.PUT("/:id", controller.UpdatePetition)
+		petitions.DELETE("/:id", controller.DeletePetition)
 
 		// --- General & Dropdown Data ---
-		api.GET("/genders", controller.GetGenders)
-		api.GET("/types", controller.GetTypes)
-		api.GET("/statuses", controller.GetStatuses)
-		api.GET("/visitors", controller.GetVisitors)
-		api.GET("/relationships", controller.GetRelationships)
-		api.GET("/typesc", controller.GetTypeCums)
-		api.GET("/timeslots", controller.GetTimeSlots)
-
-		api.GET("/evaluations", controller.GetEvaluations)
-		api.POST("/evaluations", controller.CreateEvaluation)
-		api.PUT("/evaluations/:id", controller.UpdateEvaluation)
-		api.DELETE("/evaluations/:id", controller.DeleteEvaluation)
-		api.GET("/scorebehavior/prisoner/:id", controller.GetScoreByPrisoner)
+		lookups := api.Group("", middleware.Authorize(middleware.ResLookups))
+		lookups.GET("/genders", controller.GetGenders)
+		lookups.GET("/types", controller.GetTypes)
+		lookups.GET("/statuses", controller.GetStatuses)
+		lookups.GET("/relationships", controller.GetRelationships)
+		lookups.GET("/typesc", controller.GetTypeCums)
+		lookups.GET("/timeslots", controller.GetTimeSlots)
+		lookups.GET("/timeslots/availability", controller.GetTimeSlotAvailability)
+		lookups.GET("/ranks", controller.GetRanks)
+		lookups.GET("/works", controller.GetWorks)
+		lookups.GET("/behaviorcriteria", controller.GetBehaviorCriteria)
+
+		evaluations := api.Group("/evaluations", middleware.Authorize(middleware.ResEvaluations))
+		evaluations.GET("", controller.GetEvaluations)
+		evaluations.POST("", controller.CreateEvaluation)
+		evaluations.PUT("/:id", controller.UpdateEvaluation)
+		evaluations.DELETE("/:id", controller.DeleteEvaluation)
 
 		// --- Activity Schedule Routes ---
-		api.POST("/activities", controller.CreateActivity)
-		api.PUT("/activities/:id", controller.UpdateActivity)
-		api.DELETE("/activities/:id", controller.DeleteActivity)
-		api.GET("/activities", controller.GetActivities) 
-		api.GET("/schedules", controller.GetActivitySchedules)
-		api.POST("/schedules", controller.CreateActivitySchedule)
-		api.PUT("/schedules/:id", controller.UpdateActivitySchedule)
-		api.DELETE("/schedules/:id", controller.DeleteActivitySchedule)
-		api.POST("/enrollments", controller.EnrollParticipant)
-		api.PUT("/enrollments/:id/status", controller.UpdateEnrollmentStatus)
-		api.DELETE("/enrollments/:id", controller.DeleteEnrollment)
-		api.GET("/members", controller.GetMember)
-		api.GET("/behaviorcriteria", controller.GetBehaviorCriteria)
+		activities := api.Group("", middleware.Authorize(middleware.ResActivities))
+		activities.POST("/activities", controller.CreateActivity)
+		activities.PUT("/activities/:id", controller.UpdateActivity)
+		activities.DELETE("/activities/:id", controller.DeleteActivity)
+		activities.GET("/activities", controller.GetActivities)
+		activities.GET("/schedules", controller.GetActivitySchedules)
+		activities.POST("/schedules", controller.CreateActivitySchedule)
+		activities.PUT("/schedules/:id", controller.UpdateActivitySchedule)
+		activities.DELETE("/schedules/:id", controller.DeleteActivitySchedule)
+		activities.POST("/enrollments", controller.EnrollParticipant)
+		activities.PUT("/enrollments/:id/status", controller.UpdateEnrollmentStatus)
+		activities.DELETE("/enrollments/:id", controller.DeleteEnrollment)
 
 		// --- Member Management ---
-		api.PATCH("/members/:id", controller.UpdateMember)        // เปลี่ยน Rank (และอนาคตเปลี่ยนฟิลด์อื่น)
-		api.PUT("/members/:id/rank", controller.UpdateMemberRank) // ทางลัดเฉพาะเปลี่ยน Rank
-		api.DELETE("/member/:id", controller.DeleteMemberById)    // ใส่เอกพจน์ให้ตรง FE
-		// ถ้าอยากเคร่งสิทธิ์ ให้ครอบด้วย middleware.AuthRequired() ได้
+		members := api.Group("", middleware.Authorize(middleware.ResMembers))
+		members.GET("/members", controller.GetMember)
+		members.PATCH("/members/:id", controller.UpdateMember)        // เปลี่ยน Rank (และอนาคตเปลี่ยนฟิลด์อื่น)
+		members.PUT("/members/:id/rank", controller.UpdateMemberRank) // ทางลัดเฉพาะเปลี่ยน Rank
+		members.DELETE("/member/:id", controller.DeleteMemberById)    // ใส่เอกพจน์ให้ตรง FE
+		members.POST("/members/:id/unlock", controller.UnlockMember)
+		members.DELETE("/members/:id/totp", controller.ResetMemberTOTP)
+		members.PUT("/ranks/:id/totp", controller.UpdateRankTOTP)
+		api.GET("/members/:id/logins", middleware.Authorize(middleware.ResLoginHistory), controller.GetMemberLogins)
 
+		// --- Audit Trail ---
+		api.GET("/audit", middleware.Authorize(middleware.ResAudit), controller.GetAuditLogs)
+
+		// --- Background Jobs ---
+		jobs := api.Group("/jobs", middleware.Authorize(middleware.ResJobs))
+		jobs.GET("", controller.GetJobs)
+		jobs.GET("/runs", controller.GetJobRuns)
+		jobs.POST("/:name/run", controller.TriggerJob)
 	}
 
 	r.Run("localhost:" + PORT)
@@ -137,12 +285,36 @@ func backfillScoreBehaviors() {
 	`)
 }
 
+func backfillRoomAssignments() {
+	configs.DB().Exec(`
+		INSERT INTO room_assignments (prisoner_id, room_id, from_date, reason)
+		SELECT p.prisoner_id, p.room_id, p.entry_date, 'ย้อนหลัง: ห้องปัจจุบันก่อนมีประวัติห้อง'
+		FROM prisoners p
+		LEFT JOIN room_assignments ra ON ra.prisoner_id = p.prisoner_id
+		WHERE p.room_id IS NOT NULL AND ra.prisoner_id IS NULL
+	`)
+}
+
+func backfillRoomGenders() {
+	db := configs.DB()
+	db.Exec(`UPDATE rooms SET gender_id = 1 WHERE gender_id IS NULL AND is_mixed = 0 AND room_name LIKE 'M%'`)
+	db.Exec(`UPDATE rooms SET gender_id = 2 WHERE gender_id IS NULL AND is_mixed = 0 AND room_name LIKE 'F%'`)
+}
+
+func backfillVisitingAreas() {
+	configs.DB().Exec(`
+		UPDATE visitations
+		SET visiting_area_id = (SELECT MIN(id) FROM visiting_areas WHERE deleted_at IS NULL)
+		WHERE visiting_area_id IS NULL
+	`)
+}
+
 func CORSMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
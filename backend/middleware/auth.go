@@ -7,18 +7,23 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/sa-project/configs"
+	"github.com/sa-project/entity"
 )
 
 func AuthOptional() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		auth := strings.TrimSpace(c.GetHeader("Authorization"))
+		// EventSource ของ browser ตั้ง header เองไม่ได้ -> คำขอ SSE ส่ง token ทาง ?access_token= แทน
+		if auth == "" && c.GetHeader("Accept") == "text/event-stream" && c.Query("access_token") != "" {
+			auth = "Bearer " + c.Query("access_token")
+		}
 		if strings.HasPrefix(strings.ToLower(auth), "bearer ") {
 			tokenStr := strings.TrimSpace(auth[7:]) // ตัด "Bearer "
 			claims := jwt.MapClaims{}
 			tkn, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
 				return configs.JWTSecret(), nil
 			})
-			if err == nil && tkn.Valid {
+			if err == nil && tkn.Valid && !isRevoked(claims) {
 				// mid ใน JWT ปกติเป็น number(float64) -> แปลงเป็น int
 				if v, ok := claims["mid"]; ok {
 					switch x := v.(type) {
@@ -36,12 +41,26 @@ func AuthOptional() gin.HandlerFunc {
 				if v, ok := claims["citizenId"].(string); ok {
 					c.Set("citizenId", v)
 				}
+				if v, ok := claims["jti"].(string); ok {
+					c.Set("jti", v)
+				}
 			}
 		}
 		c.Next()
 	}
 }
 
+// isRevoked ตรวจว่า jti ของ token ถูกเพิกถอนแล้ว (logout / ลบสมาชิก / เปลี่ยน rank)
+func isRevoked(claims jwt.MapClaims) bool {
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return false
+	}
+	var cnt int64
+	configs.DB().Model(&entity.RevokedToken{}).Where("jti = ?", jti).Count(&cnt)
+	return cnt > 0
+}
+
 func AuthRequired() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// ยอมรับทั้ง "mid" และ "memberID" เพื่อความเข้ากันได้
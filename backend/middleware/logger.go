@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Logger เหมือน logger ของ gin.Default แต่ตัดค่า ?access_token= (JWT ของคำขอ SSE) ออกก่อนเขียนลง log
+func Logger() gin.HandlerFunc {
+	return gin.LoggerWithFormatter(func(p gin.LogFormatterParams) string {
+		if p.Latency > time.Minute {
+			p.Latency = p.Latency.Truncate(time.Second)
+		}
+		return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+			p.TimeStamp.Format("2006/01/02 - 15:04:05"),
+			p.StatusCode,
+			p.Latency,
+			p.ClientIP,
+			p.Method,
+			redactQueryToken(p.Path),
+			p.ErrorMessage,
+		)
+	})
+}
+
+// redactQueryToken แทนค่า access_token ใน query string ด้วย "REDACTED"
+func redactQueryToken(path string) string {
+	u, err := url.Parse(path)
+	if err != nil {
+		return path
+	}
+	q := u.Query()
+	if !q.Has("access_token") {
+		return path
+	}
+	q.Set("access_token", "REDACTED")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
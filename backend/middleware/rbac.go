@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Rank IDs ตรงกับที่ seed ไว้ใน configs.SetupDatabase
+const (
+	RankAdmin    = 1 // แอดมิน
+	RankGuard    = 2 // ผู้คุม
+	RankRelative = 3 // ญาติ
+)
+
+type Action string
+
+const (
+	ActionRead   Action = "read"
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+// ชื่อ resource ที่ใช้ทั้งใน policy และตอนผูก route group ใน main.go
+const (
+	ResPrisoners           = "prisoners"
+	ResStaffs              = "staffs"
+	ResScores              = "scores"
+	ResMedical             = "medical"
+	ResParcels             = "parcels"
+	ResRooms               = "rooms"
+	ResRequestings         = "requestings"
+	ResVisitations         = "visitations"
+	ResVisitors            = "visitors"
+	ResPetitions           = "petitions"
+	ResEvaluations         = "evaluations"
+	ResActivities          = "activities"
+	ResMembers             = "members"
+	ResLookups             = "lookups" // dropdown data: genders, types, statuses, ranks ฯลฯ
+	ResAudit               = "audit"
+	ResJobs                = "jobs" // job เบื้องหลัง: เฉพาะแอดมิน
+	ResSentences           = "sentences"
+	ResSentencePolicy      = "sentence_policy"
+	ResApprovedVisitors    = "approved_visitors"
+	ResVisitorApplications = "visitor_applications" // ญาติยื่นขอเป็นผู้มีสิทธิ์เยี่ยม
+	ResVisitingAreas       = "visiting_areas"
+	ResVisitationRules     = "visitation_rules" // กฎการเยี่ยม: แอดมินแก้ไข, ผู้คุมดูได้
+	ResVisitCheckIns       = "visit_checkins"   // เช็คอิน/เช็คเอาท์ที่จุดตรวจเยี่ยม
+	ResLockdowns           = "lockdowns"        // ปิดควบคุมพิเศษ: แอดมินสั่ง, ผู้คุมดูได้
+	ResNotifications       = "notifications"    // กล่องแจ้งเตือนของตัวเอง (กรองด้วย mid ใน controller)
+	ResEmailOutbox         = "email_outbox"     // คิวอีเมลขาออก: เฉพาะแอดมิน
+	ResLoginHistory        = "login_history"    // ประวัติ login (IP/อุปกรณ์): เฉพาะแอดมิน
+	ResReleases            = "releases"         // ปล่อยตัว/รายการใกล้พ้นโทษ: เฉพาะเจ้าหน้าที่
+	ResSuppliers           = "suppliers"        // ผู้ขาย: แอดมินจัดการ, ผู้คุมดูได้
+	ResPurchaseOrders      = "purchase_orders"  // ใบสั่งซื้อ: แอดมินออก/ยกเลิก/ปิด, ผู้คุมดูได้
+	ResGoodsReceipts       = "goods_receipts"   // รับของตามใบสั่งซื้อ (ผู้คุมคลังบันทึกได้)
+)
+
+// resourceAll ใช้แทน "ทุก resource" ใน policy
+const resourceAll = "*"
+
+var allActions = []Action{ActionRead, ActionCreate, ActionUpdate, ActionDelete}
+
+// policy: rank -> resource -> actions ที่อนุญาต
+var policy = map[int]map[string][]Action{
+	RankAdmin: {
+		resourceAll: allActions,
+	},
+	RankGuard: {
+		ResPrisoners:           allActions,
+		ResStaffs:              allActions,
+		ResScores:              allActions,
+		ResMedical:             allActions,
+		ResParcels:             allActions,
+		ResSuppliers:           {ActionRead},
+		ResPurchaseOrders:      {ActionRead},
+		ResGoodsReceipts:       {ActionRead, ActionCreate},
+		ResRooms:               allActions,
+		ResRequestings:         allActions,
+		ResVisitations:         allActions,
+		ResVisitors:            allActions,
+		ResPetitions:           allActions,
+		ResEvaluations:         allActions,
+		ResActivities:          allActions,
+		ResSentences:           allActions,
+		ResReleases:            allActions,
+		ResSentencePolicy:      {ActionRead},
+		ResApprovedVisitors:    allActions,
+		ResVisitorApplications: allActions,
+		ResVisitingAreas:       allActions,
+		ResVisitationRules:     {ActionRead},
+		ResVisitCheckIns:       allActions,
+		ResLockdowns:           {ActionRead},
+		ResNotifications:       {ActionRead, ActionUpdate},
+		ResMembers:             {ActionRead},
+		ResLookups:             {ActionRead},
+	},
+	RankRelative: {
+		// หน้าเยี่ยมญาติต้องใช้รายชื่อผู้ต้องขัง/เจ้าหน้าที่สำหรับ dropdown
+		ResPrisoners: {ActionRead},
+		ResStaffs:    {ActionRead},
+		// ความเป็นเจ้าของรายการเยี่ยมตรวจซ้ำใน visitation_controller.go
+		ResVisitations:         allActions,
+		ResVisitorApplications: {ActionRead, ActionCreate},
+		ResNotifications:       {ActionRead, ActionUpdate},
+		ResLookups:             {ActionRead},
+	},
+}
+
+// Can ตรวจว่า rank นี้ทำ action กับ resource ได้หรือไม่
+func Can(rankID int, resource string, action Action) bool {
+	rules, ok := policy[rankID]
+	if !ok {
+		return false
+	}
+	for _, res := range []string{resource, resourceAll} {
+		for _, a := range rules[res] {
+			if a == action {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// actionFromMethod แปลง HTTP method เป็น action
+func actionFromMethod(method string) Action {
+	switch method {
+	case http.MethodPost:
+		return ActionCreate
+	case http.MethodPut, http.MethodPatch:
+		return ActionUpdate
+	case http.MethodDelete:
+		return ActionDelete
+	default:
+		return ActionRead
+	}
+}
+
+// RankFromContext คืน rankId ที่ AuthOptional ใส่ไว้ (ok=false ถ้าไม่ได้ login)
+func RankFromContext(c *gin.Context) (int, bool) {
+	v, ok := c.Get("rankId")
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(int)
+	return id, ok
+}
+
+// Authorize ใช้กับ route group: action อนุมานจาก HTTP method
+func Authorize(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		enforce(c, resource, actionFromMethod(c.Request.Method))
+	}
+}
+
+// Permit ใช้กับ route เดี่ยวที่ action ไม่ตรงกับ method
+func Permit(resource string, action Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		enforce(c, resource, action)
+	}
+}
+
+func enforce(c *gin.Context, resource string, action Action) {
+	if _, ok := c.Get("mid"); !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	rankID, ok := RankFromContext(c)
+	if !ok || !Can(rankID, resource, action) {
+		Forbidden(c, resource, action)
+		return
+	}
+	c.Next()
+}
+
+// Forbidden ตอบ 403 ด้วยรูปแบบ body เดียวกันทั้งระบบ
+func Forbidden(c *gin.Context, resource string, action Action) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error":    "forbidden",
+		"message":  "คุณไม่มีสิทธิ์ดำเนินการนี้",
+		"resource": resource,
+		"action":   action,
+	})
+}
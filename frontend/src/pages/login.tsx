@@ -10,6 +10,10 @@ import LoginIcon from "@mui/icons-material/Login";
 import Visibility from "@mui/icons-material/Visibility";
 import VisibilityOff from "@mui/icons-material/VisibilityOff";
 
+// ขั้นที่สองของการล็อกอิน (rank ที่บังคับ TOTP)
+// method = "totp": กรอกรหัสจากแอป, "setup": ยังไม่ลงทะเบียน ต้องสแกน secret ก่อน
+type MfaChallenge = { token: string; method: "totp" | "setup" };
+
 export default function LoginPage() {
   const nav = useNavigate();
   const loc = useLocation();
@@ -21,6 +25,22 @@ export default function LoginPage() {
   const [submitting, setSubmitting] = useState(false);
   const [error, setError] = useState<string | null>(null);
 
+  const [mfa, setMfa] = useState<MfaChallenge | null>(null);
+  const [setupInfo, setSetupInfo] = useState<{ secret: string; otpauth_uri: string } | null>(null);
+  const [code, setCode] = useState("");
+  const [useRecovery, setUseRecovery] = useState(false);
+  // recovery codes แสดงครั้งเดียวหลังลงทะเบียน TOTP: เก็บ session ไว้ก่อนจนกว่าผู้ใช้กดดำเนินการต่อ
+  const [recoveryCodes, setRecoveryCodes] = useState<string[] | null>(null);
+  const [pendingSession, setPendingSession] = useState<any>(null);
+
+  const finishLogin = (data: any) => {
+    // backend: { access_token, user: { MID, username, firstName, lastName, rankId } }
+    saveAuth(data.access_token, data.user);
+    // แจ้ง component อื่น ๆ (เช่น Sidebar) ให้รีเฟรชผู้ใช้
+    window.dispatchEvent(new Event("auth:changed"));
+    nav(redirectTo, { replace: true });
+  };
+
   const submit = async (e: React.FormEvent) => {
     e.preventDefault();
     setError(null);
@@ -33,11 +53,19 @@ export default function LoginPage() {
     try {
       setSubmitting(true);
       const res = await api.post("/auth/login", { username, password });
-      // backend: { access_token, user: { MID, username, firstName, lastName, rankId } }
-      saveAuth(res.data.access_token, res.data.user);
-      // แจ้ง component อื่น ๆ (เช่น Sidebar) ให้รีเฟรชผู้ใช้
-      window.dispatchEvent(new Event("auth:changed"));
-      nav(redirectTo, { replace: true });
+      if (res.data.mfa_required) {
+        // backend: { mfa_required, mfa_method, challenge_token, expires_in }
+        const challenge: MfaChallenge = { token: res.data.challenge_token, method: res.data.mfa_method };
+        if (challenge.method === "setup") {
+          const setup = await api.post("/auth/login/totp-setup", { challenge_token: challenge.token });
+          setSetupInfo(setup.data);
+        }
+        setMfa(challenge);
+        setCode("");
+        setUseRecovery(false);
+        return;
+      }
+      finishLogin(res.data);
     } catch (e: any) {
       const msg = e?.response?.data?.error || "เข้าสู่ระบบไม่สำเร็จ";
       setError(msg);
@@ -46,6 +74,43 @@ export default function LoginPage() {
     }
   };
 
+  const verify = async (e: React.FormEvent) => {
+    e.preventDefault();
+    if (!mfa) return;
+    setError(null);
+    if (!code.trim()) {
+      setError(useRecovery ? "กรุณากรอกรหัสสำรอง" : "กรุณากรอกรหัส 6 หลักจากแอปยืนยันตัวตน");
+      return;
+    }
+
+    try {
+      setSubmitting(true);
+      const body = useRecovery
+        ? { challenge_token: mfa.token, recovery_code: code.trim() }
+        : { challenge_token: mfa.token, code: code.trim() };
+      const res = await api.post("/auth/login/verify", body);
+      if (res.data.recovery_codes) {
+        setRecoveryCodes(res.data.recovery_codes);
+        setPendingSession(res.data);
+        return;
+      }
+      finishLogin(res.data);
+    } catch (e: any) {
+      setError(e?.response?.data?.error || "รหัสยืนยันไม่ถูกต้อง");
+    } finally {
+      setSubmitting(false);
+    }
+  };
+
+  const backToPassword = () => {
+    setMfa(null);
+    setSetupInfo(null);
+    setCode("");
+    setError(null);
+  };
+
+  const fieldSx = { bgcolor: "rgba(255,255,255,.9)", borderRadius: 1 };
+
   return (
     <Box
       sx={{
@@ -88,6 +153,84 @@ export default function LoginPage() {
 
         {error && <Alert severity="error" sx={{ mb: 2 }}>{error}</Alert>}
 
+        {recoveryCodes ? (
+          <Box>
+            <Alert severity="warning" sx={{ mb: 2 }}>
+              เก็บรหัสสำรองเหล่านี้ไว้ในที่ปลอดภัย ใช้แทนรหัสจากแอปได้รหัสละครั้ง และจะไม่แสดงอีก
+            </Alert>
+            <Box sx={{ fontFamily: "monospace", bgcolor: "rgba(0,0,0,.35)", p: 2, borderRadius: 1, mb: 2 }}>
+              {recoveryCodes.map((rc) => (
+                <div key={rc}>{rc}</div>
+              ))}
+            </Box>
+            <Button fullWidth variant="contained" sx={{ py: 1.2, fontWeight: 700 }} onClick={() => finishLogin(pendingSession)}>
+              บันทึกแล้ว ดำเนินการต่อ
+            </Button>
+          </Box>
+        ) : mfa ? (
+          <form onSubmit={verify} noValidate>
+            {mfa.method === "setup" && setupInfo && (
+              <Box sx={{ mb: 2 }}>
+                <Typography variant="body2" sx={{ mb: 1 }}>
+                  บัญชีนี้ต้องใช้การยืนยันตัวตนสองขั้นตอน เพิ่มบัญชีในแอปยืนยันตัวตน (เช่น Google Authenticator) ด้วยรหัสนี้
+                  แล้วกรอกรหัส 6 หลักที่แอปแสดง
+                </Typography>
+                <Box sx={{ fontFamily: "monospace", bgcolor: "rgba(0,0,0,.35)", p: 1.5, borderRadius: 1, wordBreak: "break-all" }}>
+                  {setupInfo.secret}
+                </Box>
+                <Link href={setupInfo.otpauth_uri} sx={{ color: "#fff", fontSize: 13 }}>
+                  เปิดในแอปยืนยันตัวตน
+                </Link>
+              </Box>
+            )}
+            {mfa.method === "totp" && (
+              <Typography variant="body2" sx={{ mb: 1 }}>
+                {useRecovery ? "กรอกรหัสสำรองที่ได้รับตอนลงทะเบียน" : "กรอกรหัส 6 หลักจากแอปยืนยันตัวตน"}
+              </Typography>
+            )}
+
+            <TextField
+              fullWidth
+              autoFocus
+              label={useRecovery ? "Recovery code" : "รหัสยืนยัน"}
+              margin="dense"
+              value={code}
+              onChange={(e) => setCode(e.target.value)}
+              variant="filled"
+              inputProps={useRecovery ? {} : { inputMode: "numeric", maxLength: 6, autoComplete: "one-time-code" }}
+              InputProps={{ disableUnderline: true }}
+              sx={fieldSx}
+            />
+
+            <Button
+              fullWidth
+              sx={{ mt: 2, py: 1.2, fontWeight: 700 }}
+              type="submit"
+              variant="contained"
+              disabled={submitting}
+            >
+              {submitting ? "กำลังตรวจสอบ..." : "ยืนยัน"}
+            </Button>
+
+            <Divider sx={{ my: 2, borderColor: "rgba(255,255,255,.25)" }} />
+
+            <Box sx={{ display: "flex", justifyContent: "space-between" }}>
+              <Link component="button" type="button" onClick={backToPassword} sx={{ color: "#fff" }}>
+                กลับ
+              </Link>
+              {mfa.method === "totp" && (
+                <Link
+                  component="button"
+                  type="button"
+                  onClick={() => { setUseRecovery((v) => !v); setCode(""); }}
+                  sx={{ color: "#fff" }}
+                >
+                  {useRecovery ? "ใช้รหัสจากแอป" : "ใช้รหัสสำรอง"}
+                </Link>
+              )}
+            </Box>
+          </form>
+        ) : (
         <form onSubmit={submit} noValidate>
           <TextField
             fullWidth
@@ -146,6 +289,7 @@ export default function LoginPage() {
             </Link>
           </Typography>
         </form>
+        )}
       </Paper>
     </Box>
   );